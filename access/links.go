@@ -0,0 +1,140 @@
+package access
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+var (
+	// ErrUnknownLink is returned for links that were never minted, or were minted before a restart
+	ErrUnknownLink = errors.New("unknown access link")
+	// ErrRevokedLink is returned for links that were revoked
+	ErrRevokedLink = errors.New("access link revoked")
+	// ErrLinkUsedUp is returned for links that reached their maximum number of uses
+	ErrLinkUsedUp = errors.New("access link has no uses left")
+)
+
+// Link is a minted access link. The token itself is not kept.
+type Link struct {
+	ID        string    `json:"id"`
+	Session   string    `json:"session_id"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	ViewOnly  bool      `json:"view_only"`
+	MaxUses   int       `json:"max_uses,omitempty"` // 0 means unlimited
+	Uses      int       `json:"uses"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+
+	revoked chan struct{}
+}
+
+// Links mints access links and tracks their uses and revocation. Links are
+// kept in memory, so a restart invalidates them.
+type Links struct {
+	signer *Signer
+	mu     sync.Mutex
+	links  map[string]*Link
+}
+
+// NewLinks returns an empty link store signing tokens with signer
+func NewLinks(signer *Signer) *Links {
+	return &Links{signer: signer, links: make(map[string]*Link)}
+}
+
+// Mint records a new link for a session and returns it with its token
+func (l *Links) Mint(session string, createdBy string, viewOnly bool, maxUses int, ttl time.Duration) (Link, string) {
+	now := time.Now()
+	link := &Link{
+		ID:        utils.GenerateID()[:12],
+		Session:   session,
+		CreatedBy: createdBy,
+		ViewOnly:  viewOnly,
+		MaxUses:   maxUses,
+		CreatedAt: now,
+		// Tokens carry whole seconds
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+		revoked:   make(chan struct{}),
+	}
+	token := l.signer.Mint(Claims{
+		ID:        link.ID,
+		Session:   session,
+		Subject:   createdBy,
+		ViewOnly:  viewOnly,
+		ExpiresAt: link.ExpiresAt.Unix(),
+	})
+
+	l.mu.Lock()
+	l.prune(now)
+	l.links[link.ID] = link
+	l.mu.Unlock()
+	return *link, token
+}
+
+// Use verifies a token and counts one use of its link. The returned channel
+// is closed when the link is revoked. Links that are revoked or used up are
+// returned along with the error.
+func (l *Links) Use(token string) (Link, <-chan struct{}, error) {
+	claims, err := l.signer.Verify(token)
+	if err != nil {
+		return Link{}, nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, ok := l.links[claims.ID]
+	switch {
+	case !ok || link.Session != claims.Session:
+		return Link{}, nil, ErrUnknownLink
+	case link.Revoked:
+		return *link, nil, ErrRevokedLink
+	case link.MaxUses > 0 && link.Uses >= link.MaxUses:
+		return *link, nil, ErrLinkUsedUp
+	}
+	link.Uses++
+	return *link, link.revoked, nil
+}
+
+// List returns the unexpired links of a session, oldest first
+func (l *Links) List(session string) []Link {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(time.Now())
+
+	links := []Link{}
+	for _, link := range l.links {
+		if link.Session == session {
+			links = append(links, *link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links
+}
+
+// Revoke invalidates a link of a session and disconnects its viewers
+func (l *Links) Revoke(session string, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, ok := l.links[id]
+	if !ok || link.Session != session {
+		return ErrUnknownLink
+	}
+	if !link.Revoked {
+		link.Revoked = true
+		close(link.revoked)
+	}
+	return nil
+}
+
+// prune forgets expired links. The caller holds the lock.
+func (l *Links) prune(now time.Time) {
+	for id, link := range l.links {
+		if !now.Before(link.ExpiresAt) {
+			delete(l.links, id)
+		}
+	}
+}
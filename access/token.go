@@ -0,0 +1,85 @@
+// Package access mints and verifies the signed, short-lived tokens that
+// grant a viewer access to the desktop of one session.
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or not signed by this server
+	ErrInvalidToken = errors.New("invalid access token")
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("access token expired")
+)
+
+// Claims are the grants carried by an access token
+type Claims struct {
+	ID        string `json:"jti"`
+	Session   string `json:"sid"` // Tracking ID of the session
+	Subject   string `json:"sub"` // Caller that minted the token
+	ViewOnly  bool   `json:"vo,omitempty"`
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+}
+
+// Signer mints and verifies tokens with an HMAC-SHA256 key
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer for the given secret. An empty secret is
+// replaced by a random key, so tokens do not survive a restart.
+func NewSigner(secret string) *Signer {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Signer{key: key}
+}
+
+// Mint returns the signed token for the claims
+func (s *Signer) Mint(c Claims) string {
+	payload, _ := json.Marshal(c)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+}
+
+// Verify checks the signature and expiry of a token and returns its claims
+func (s *Signer) Verify(token string) (*Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, s.sign(encoded)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if time.Now().Unix() >= c.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &c, nil
+}
+
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,184 @@
+// Package audit records management actions as structured, append-only events.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionSessionCreate     = "session.create"
+	ActionSessionKill       = "session.kill"
+	ActionSessionStop       = "session.stop"
+	ActionSessionExtend     = "session.extend"
+	ActionSessionExec       = "session.exec"
+	ActionSessionInput      = "session.input"
+	ActionClipboardRead     = "clipboard.read"
+	ActionClipboardWrite    = "clipboard.write"
+	ActionDevToolsConnect   = "devtools.connect"
+	ActionFileUpload        = "file.upload"
+	ActionFileDownload      = "file.download"
+	ActionRecordingStart    = "recording.start"
+	ActionRecordingStop     = "recording.stop"
+	ActionRecordingDownload = "recording.download"
+	ActionBatchCreate       = "batch.create"
+	ActionLinkMint          = "link.mint"
+	ActionLinkRevoke        = "link.revoke"
+	ActionLinkUse           = "link.use"
+	ActionConfigLoad        = "config.load"
+)
+
+// Outcomes of an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// ActorSystem is the actor of actions the orchestrator takes on its own
+const ActorSystem = "system"
+
+// Event is one audit record
+type Event struct {
+	Time    time.Time              `json:"time"`
+	Actor   string                 `json:"actor"`
+	Tenant  string                 `json:"tenant,omitempty"`
+	Action  string                 `json:"action"`
+	Session string                 `json:"session,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Outcome string                 `json:"outcome"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(e Event) error
+}
+
+// Filter selects events in a query. Empty fields match everything.
+type Filter struct {
+	Actor   string
+	Tenant  string
+	Action  string
+	Session string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // Most recent events returned, newest first
+}
+
+// Querier is a sink that can be searched
+type Querier interface {
+	Query(f Filter) ([]Event, error)
+}
+
+// Match reports whether an event passes the filter, ignoring the limit
+func (f Filter) Match(e Event) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Tenant == "" || e.Tenant == f.Tenant) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Session == "" || e.Session == f.Session) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Logger writes events to its sinks and answers queries from the first one that can be searched
+type Logger struct {
+	sinks   []Sink
+	querier Querier
+}
+
+// NewLogger returns a logger writing to every sink
+func NewLogger(sinks ...Sink) *Logger {
+	l := &Logger{sinks: sinks}
+	for _, s := range sinks {
+		if q, ok := s.(Querier); ok {
+			l.querier = q
+			break
+		}
+	}
+	return l
+}
+
+// Record timestamps an event, redacts its parameters and writes it to every
+// sink. Sink failures are logged, they never fail the action being audited.
+func (l *Logger) Record(e Event) {
+	e.Time = time.Now().UTC()
+	e.Params = redact(e.Params)
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			log.Printf("Error writing audit event %s: %v", e.Action, err)
+		}
+	}
+}
+
+// Query searches the recorded events
+func (l *Logger) Query(f Filter) ([]Event, error) {
+	if l.querier == nil {
+		return []Event{}, nil
+	}
+	return l.querier.Query(f)
+}
+
+// Params converts a request body or other value to audit parameters
+func Params(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var params map[string]interface{}
+	if json.Unmarshal(data, &params) != nil {
+		return nil
+	}
+	return params
+}
+
+// secretKey matches parameter names whose values must not be recorded
+var secretKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key)$`)
+
+// redact replaces secret values, at any depth, with a placeholder
+func redact(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if secretKey.MatchString(k) {
+			if v != nil && v != "" {
+				out[k] = "[REDACTED]"
+			}
+			continue
+		}
+		out[k] = redactValue(v)
+	}
+	return out
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return redact(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = redactValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+// newest returns the last limit matching events of a chronological list, newest first
+func newest(events []Event, f Filter) []Event {
+	matched := []Event{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if f.Match(events[i]) {
+			matched = append(matched, events[i])
+			if f.Limit > 0 && len(matched) == f.Limit {
+				break
+			}
+		}
+	}
+	return matched
+}
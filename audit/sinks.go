@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends events to a JSON lines file
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileSink opens, or creates, the audit file for appending
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return &FileSink{path: path, file: f}, nil
+}
+
+// Write implements Sink
+func (s *FileSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// maxEventLine bounds the events read back from the file, longer lines
+// are skipped
+const maxEventLine = 1 << 20
+
+// Query implements Querier by scanning the file. The file is read through
+// a handle of its own without the write lock, so queries do not hold up
+// audited requests, and only the last f.Limit matches are kept.
+func (s *FileSink) Query(f Filter) ([]Event, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer file.Close()
+
+	// Matches are kept in a ring, next is the oldest once it is full
+	var ring []Event
+	next := 0
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := readLine(reader, maxEventLine)
+		var e Event
+		// A line being written while the file is read is incomplete and skipped
+		if line != nil && json.Unmarshal(line, &e) == nil && f.Match(e) {
+			if f.Limit <= 0 || len(ring) < f.Limit {
+				ring = append(ring, e)
+			} else {
+				ring[next] = e
+				next = (next + 1) % f.Limit
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %v", err)
+		}
+	}
+	return newest(append(ring[next:], ring[:next]...), f), nil
+}
+
+// readLine returns the next line without its newline, or nil for a line
+// longer than max, which is skipped
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+1 {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong {
+			return nil, err
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), err
+	}
+}
+
+// MemorySink keeps the most recent events in memory
+type MemorySink struct {
+	mu     sync.Mutex
+	size   int
+	events []Event
+}
+
+// NewMemorySink returns a sink keeping up to size events
+func NewMemorySink(size int) *MemorySink {
+	return &MemorySink{size: size}
+}
+
+// Write implements Sink
+func (s *MemorySink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	// Trim in batches rather than on every write
+	if len(s.events) >= 2*s.size {
+		s.events = append(s.events[:0:0], s.events[len(s.events)-s.size:]...)
+	}
+	return nil
+}
+
+// Query implements Querier
+func (s *MemorySink) Query(f Filter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events
+	if len(events) > s.size {
+		events = events[len(events)-s.size:]
+	}
+	return newest(events, f), nil
+}
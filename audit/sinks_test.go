@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSinkQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		action := ActionSessionCreate
+		if i%2 == 1 {
+			action = ActionSessionKill
+		}
+		if err := sink.Write(Event{Actor: "basic:alice", Action: action, Session: fmt.Sprintf("s%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 4 {
+			// An oversized line and an incomplete one are skipped
+			sink.file.WriteString(`{"actor":"` + strings.Repeat("x", maxEventLine) + "\"}\n")
+			sink.file.WriteString("{\"actor\":\n")
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		sessions []string
+	}{
+		{"limit keeps the newest", Filter{Limit: 3}, []string{"s9", "s8", "s7"}},
+		{"limit above the matches", Filter{Action: ActionSessionKill, Limit: 10}, []string{"s9", "s7", "s5", "s3", "s1"}},
+		{"limit across the skipped lines", Filter{Action: ActionSessionCreate, Limit: 4}, []string{"s8", "s6", "s4", "s2"}},
+		{"no limit", Filter{Action: ActionSessionCreate}, []string{"s8", "s6", "s4", "s2", "s0"}},
+		{"no match", Filter{Actor: "jwt:alice", Limit: 5}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := sink.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sessions []string
+			for _, e := range events {
+				sessions = append(sessions, e.Session)
+			}
+			if fmt.Sprint(sessions) != fmt.Sprint(tt.sessions) {
+				t.Errorf("got sessions %v, want %v", sessions, tt.sessions)
+			}
+		})
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() < maxEventLine {
+		t.Fatalf("oversized line was not written: %v", err)
+	}
+}
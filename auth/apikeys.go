@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIKeyHeader carries a static API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is an entry of the API keys file. Only the SHA-256 hash of the key
+// is stored, written as "sha256:<hex>".
+type APIKey struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"`
+	Tenant string   `yaml:"tenant"`
+	Roles  []string `yaml:"roles"`
+}
+
+// APIKeyAuthenticator checks the X-API-Key header against hashed keys
+type APIKeyAuthenticator struct {
+	keys []apiKeyHash
+}
+
+type apiKeyHash struct {
+	identity Identity
+	sum      []byte
+}
+
+// LoadAPIKeys reads a YAML list of API keys
+func LoadAPIKeys(path string) (*APIKeyAuthenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %v", err)
+	}
+
+	var entries []APIKey
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("API keys file %s: %v", path, err)
+	}
+
+	a := &APIKeyAuthenticator{}
+	for i, entry := range entries {
+		hexSum, ok := strings.CutPrefix(entry.Hash, "sha256:")
+		sum, err := hex.DecodeString(hexSum)
+		if entry.Name == "" || !ok || err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("API keys file %s entry %d: expected a name and a sha256:<hex> hash", path, i+1)
+		}
+		a.keys = append(a.keys, apiKeyHash{
+			identity: Identity{Subject: entry.Name, Tenant: entry.Tenant, Roles: entry.Roles, Method: "api_key"},
+			sum:      sum,
+		})
+	}
+	return a, nil
+}
+
+// HashAPIKey returns the stored form of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], k.sum) == 1 {
+			id := k.identity
+			return &id, nil
+		}
+	}
+	return nil, errors.New("unknown API key")
+}
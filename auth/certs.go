@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// CertificateAuthenticator identifies callers by the client certificate
+// verified during the TLS handshake. The subject is the certificate common
+// name. Tenant and roles are granted in grants; subjects without a grant
+// get the first organizational unit of the certificate as their tenant.
+type CertificateAuthenticator struct {
+	grants map[string]config.UserConfig
+}
+
+// NewCertificateAuthenticator returns an authenticator for verified client certificates
+func NewCertificateAuthenticator(grants map[string]config.UserConfig) *CertificateAuthenticator {
+	return &CertificateAuthenticator{grants: grants}
+}
+
+// Authenticate implements Authenticator
+func (a *CertificateAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	// Only verified chains count, unverified certificates are never accepted
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	subject := cert.Subject.CommonName
+	if subject == "" {
+		return nil, ErrNoCredentials
+	}
+
+	id := &Identity{Subject: subject, Method: "client_cert"}
+	if grant, ok := a.grants[subject]; ok {
+		id.Tenant, id.Roles = grant.Tenant, grant.Roles
+	} else if len(cert.Subject.OrganizationalUnit) > 0 {
+		id.Tenant = cert.Subject.OrganizationalUnit[0]
+	}
+	return id, nil
+}
@@ -0,0 +1,24 @@
+package auth
+
+import "context"
+
+// Identity describes an authenticated caller
+type Identity struct {
+	Subject string   `json:"subject"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Method  string   `json:"method"` // Authenticator that accepted the request, e.g. "basic"
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity attached by the middleware, or nil
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
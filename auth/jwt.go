@@ -0,0 +1,441 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// clockSkew is tolerated when checking exp and nbf
+const clockSkew = time.Minute
+
+// jwksRetryInterval separates fetches of the JWKS URL, successful or not,
+// so unknown kids and an unavailable provider do not cause a fetch per request
+const jwksRetryInterval = 30 * time.Second
+
+// JWTAuthenticator validates bearer tokens signed by keys from a JWKS and
+// maps their claims to an identity.
+type JWTAuthenticator struct {
+	cfg    config.JWTConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey // kid -> key, unnamed keys get their index as kid
+	fetchedAt   time.Time                   // Last successful fetch
+	attemptedAt time.Time                   // Last fetch, successful or not
+	refreshing  chan struct{}               // Closed when the running fetch ends, nil when none runs
+}
+
+// NewJWTAuthenticator loads the JWKS from the configured file or URL
+func NewJWTAuthenticator(cfg config.JWTConfig) (*JWTAuthenticator, error) {
+	j := &JWTAuthenticator{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+	j.attemptedAt = j.fetchedAt
+	return j, nil
+}
+
+// Authenticate implements Authenticator
+func (j *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := j.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return j.identity(claims)
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature and the registered claims of a token
+func (j *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding")
+	}
+
+	keys := j.candidateKeys(header.Kid)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key found for kid %q", header.Kid)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if err := verifySignature(header.Alg, key, signed, signature); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %v", err)
+	}
+
+	now := time.Now()
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return nil, errors.New("token has no exp claim")
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	if j.cfg.Issuer != "" && claims["iss"] != j.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if j.cfg.Audience != "" && !containsString(stringsClaim(claims["aud"]), j.cfg.Audience) {
+		return nil, fmt.Errorf("token not issued for audience %q", j.cfg.Audience)
+	}
+	return claims, nil
+}
+
+// identity maps the configured claims to a caller identity
+func (j *JWTAuthenticator) identity(claims map[string]interface{}) (*Identity, error) {
+	subject, _ := lookupClaim(claims, j.cfg.SubjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %s claim", j.cfg.SubjectClaim)
+	}
+	tenant, _ := lookupClaim(claims, j.cfg.TenantClaim).(string)
+	return &Identity{
+		Subject: subject,
+		Tenant:  tenant,
+		Roles:   stringsClaim(lookupClaim(claims, j.cfg.RolesClaim)),
+		Method:  "jwt",
+	}, nil
+}
+
+// candidateKeys returns the keys that may have signed a token, refreshing
+// the JWKS when it is stale or the kid is unknown.
+func (j *JWTAuthenticator) candidateKeys(kid string) []crypto.PublicKey {
+	if done := j.startRefresh(kid); done != nil {
+		<-done
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if kid != "" {
+		if key, ok := j.keys[kid]; ok {
+			return []crypto.PublicKey{key}
+		}
+		return nil
+	}
+	keys := make([]crypto.PublicKey, 0, len(j.keys))
+	for _, key := range j.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startRefresh fetches the JWKS URL in the background when the keys are
+// stale or kid is unknown. Concurrent callers share one fetch. It returns a
+// channel closed when the fetch ends if the caller has to wait for it, which
+// is only when kid is unknown: stale keys keep being used meanwhile.
+func (j *JWTAuthenticator) startRefresh(kid string) <-chan struct{} {
+	if j.cfg.JWKSURL == "" {
+		return nil
+	}
+	// due reports whether a fetch should start and whether to wait for it
+	due := func() (bool, bool) {
+		_, known := j.keys[kid]
+		unknown := kid != "" && !known
+		stale := time.Since(j.fetchedAt) > j.cfg.RefreshInterval
+		return (stale || unknown) && time.Since(j.attemptedAt) > jwksRetryInterval, unknown
+	}
+
+	j.mu.RLock()
+	refreshing := j.refreshing
+	fetch, wait := due()
+	j.mu.RUnlock()
+	if refreshing != nil || !fetch {
+		if wait {
+			return refreshing
+		}
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// Another caller may have started the fetch in between
+	if j.refreshing == nil {
+		if fetch, _ = due(); !fetch {
+			return nil
+		}
+		j.attemptedAt = time.Now()
+		done := make(chan struct{})
+		j.refreshing = done
+		go func() {
+			if err := j.refresh(); err != nil {
+				// Keep using the previous keys, the provider may be briefly unavailable
+				log.Printf("Failed to refresh JWKS: %v", err)
+			}
+			j.mu.Lock()
+			j.refreshing = nil
+			j.mu.Unlock()
+			close(done)
+		}()
+	}
+	if wait {
+		return j.refreshing
+	}
+	return nil
+}
+
+// refresh reloads the JWKS
+func (j *JWTAuthenticator) refresh() error {
+	var data []byte
+	var err error
+	if j.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(j.cfg.JWKSFile)
+	} else {
+		data, err = j.fetch(j.cfg.JWKSURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS: %v", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWTAuthenticator) fetch(url string) ([]byte, error) {
+	resp, err := j.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d from %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// jsonWebKey is the subset of RFC 7517 used for signature verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the RSA and EC signing keys of a key set
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %d: %v", i, err)
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := decodeBigInt(k.N)
+		e, err2 := decodeBigInt(k.E)
+		if err1 != nil || err2 != nil || !e.IsInt64() {
+			return nil, errors.New("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := decodeBigInt(k.X)
+		y, err2 := decodeBigInt(k.Y)
+		if err1 != nil || err2 != nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("malformed EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks a JWS signature for the RS, PS and ES algorithms
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		if pub, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		}
+	case strings.HasPrefix(alg, "PS"):
+		if pub, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case strings.HasPrefix(alg, "ES"):
+		if pub, ok := key.(*ecdsa.PublicKey); ok {
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return errors.New("invalid ECDSA signature length")
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(pub, digest, r, s) {
+				return nil
+			}
+			return errors.New("invalid ECDSA signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return fmt.Errorf("key type does not match algorithm %q", alg)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// lookupClaim resolves a dotted claim path such as realm_access.roles
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var v interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// stringsClaim accepts a string array or a space-separated string
+func stringsClaim(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Fields(t)
+	case []interface{}:
+		values := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// testKey is a signing key published in a test JWKS
+type testKey struct {
+	kid string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, rsa: key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, ec: key}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwks encodes the public halves of keys as a key set
+func jwks(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for _, k := range keys {
+		if k.rsa != nil {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "RSA", Kid: k.kid, Use: "sig",
+				N: b64(k.rsa.N.Bytes()), E: b64(big.NewInt(int64(k.rsa.E)).Bytes()),
+			})
+		} else {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "EC", Kid: k.kid, Crv: "P-256",
+				X: b64(k.ec.X.FillBytes(make([]byte, 32))), Y: b64(k.ec.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signToken builds a token with the given header, signed by key for the RS
+// and ES algorithms, by secret for HS256 and not at all for none
+func signToken(t *testing.T, header map[string]interface{}, claims map[string]interface{}, key testKey, secret []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch header["alg"] {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, key.rsa, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		r, s, signErr := ecdsa.Sign(rand.Reader, key.ec, digest[:])
+		err = signErr
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case "HS256":
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/containers", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func testJWTConfig() config.JWTConfig {
+	return config.JWTConfig{
+		RefreshInterval: 15 * time.Minute,
+		Issuer:          "https://idp.example.com",
+		Audience:        "orchestrator",
+		SubjectClaim:    "sub",
+		TenantClaim:     "tenant",
+		RolesClaim:      "realm_access.roles",
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1")
+	unpublished := newRSAKey(t, "rsa-1")
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwks(t, rsaKey, ecKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testJWTConfig()
+	cfg.JWKSFile = file
+	j, err := NewJWTAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":          "alice",
+			"tenant":       "acme",
+			"iss":          "https://idp.example.com",
+			"aud":          []string{"account", "orchestrator"},
+			"exp":          now.Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"operator"}},
+		}
+		for name, v := range changes {
+			if v == nil {
+				delete(c, name)
+			} else {
+				c[name] = v
+			}
+		}
+		return c
+	}
+	header := func(alg, kid string) map[string]interface{} {
+		h := map[string]interface{}{"alg": alg, "typ": "JWT"}
+		if kid != "" {
+			h["kid"] = kid
+		}
+		return h
+	}
+	// The modulus is public, an HMAC keyed with it must not pass as RS256
+	modulus := rsaKey.rsa.N.Bytes()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", signToken(t, header("RS256", "rsa-1"), claims(nil), rsaKey, nil), true},
+		{"PS256", signToken(t, header("PS256", "rsa-1"), claims(nil), rsaKey, nil), true},
+		{"ES256", signToken(t, header("ES256", "ec-1"), claims(nil), ecKey, nil), true},
+		{"no kid tries every key", signToken(t, header("ES256", ""), claims(nil), ecKey, nil), true},
+		{"audience as string", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"aud": "orchestrator"}), rsaKey, nil), true},
+		{"expired within skew", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), rsaKey, nil), true},
+
+		{"alg none", signToken(t, header("none", "rsa-1"), claims(nil), rsaKey, nil), false},
+		{"alg HS256 keyed with the public key", signToken(t, header("HS256", "rsa-1"), claims(nil), rsaKey, modulus), false},
+		{"RS256 header on EC key", signToken(t, header("RS256", "ec-1"), claims(nil), rsaKey, nil), false},
+		{"signed by another key", signToken(t, header("RS256", "rsa-1"), claims(nil), unpublished, nil), false},
+		{"unknown kid", signToken(t, header("RS256", "rsa-2"), claims(nil), rsaKey, nil), false},
+		{"expired", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}), rsaKey, nil), false},
+		{"no exp", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"exp": nil}), rsaKey, nil), false},
+		{"not valid yet", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}), rsaKey, nil), false},
+		{"wrong issuer", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"iss": "https://evil.example.com"}), rsaKey, nil), false},
+		{"wrong audience", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"aud": "other"}), rsaKey, nil), false},
+		{"no subject", signToken(t, header("RS256", "rsa-1"), claims(map[string]interface{}{"sub": nil}), rsaKey, nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := j.Authenticate(bearerRequest(tt.token))
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("token accepted as %+v", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("token rejected: %v", err)
+			}
+			if id.Subject != "alice" || id.Tenant != "acme" || len(id.Roles) != 1 || id.Roles[0] != "operator" || id.Method != "jwt" {
+				t.Errorf("unexpected identity %+v", id)
+			}
+		})
+	}
+}
+
+// jwksServer serves a key set that can be swapped or made to fail, and
+// counts the fetches
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	body    []byte
+	fail    bool
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, body []byte) *jwksServer {
+	s := &jwksServer{body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(body []byte, fail bool) {
+	s.mu.Lock()
+	s.body, s.fail = body, fail
+	s.mu.Unlock()
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey := newRSAKey(t, "old")
+	newKey := newRSAKey(t, "new")
+	server := newJWKSServer(t, jwks(t, oldKey))
+
+	cfg := testJWTConfig()
+	cfg.JWKSURL = server.URL
+	j, err := NewJWTAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{
+		"sub": "alice", "iss": cfg.Issuer, "aud": cfg.Audience, "exp": time.Now().Add(time.Hour).Unix(),
+	}
+	oldToken := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "old"}, claims, oldKey, nil)
+	newToken := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "new"}, claims, newKey, nil)
+
+	if _, err := j.Authenticate(bearerRequest(oldToken)); err != nil {
+		t.Fatalf("token of the old key rejected: %v", err)
+	}
+
+	server.set(jwks(t, newKey), false)
+	// Unknown kids are only fetched again after the retry interval
+	if _, err := j.Authenticate(bearerRequest(newToken)); err == nil {
+		t.Fatal("token of the new key accepted before the JWKS was fetched again")
+	}
+	j.mu.Lock()
+	j.attemptedAt = time.Now().Add(-jwksRetryInterval - time.Second)
+	j.mu.Unlock()
+
+	if _, err := j.Authenticate(bearerRequest(newToken)); err != nil {
+		t.Fatalf("token of the new key rejected after rotation: %v", err)
+	}
+	if _, err := j.Authenticate(bearerRequest(oldToken)); err == nil {
+		t.Fatal("token of the retired key accepted after rotation")
+	}
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
+
+func TestJWTRefreshFailure(t *testing.T) {
+	key := newRSAKey(t, "current")
+	server := newJWKSServer(t, jwks(t, key))
+
+	cfg := testJWTConfig()
+	cfg.JWKSURL = server.URL
+	j, err := NewJWTAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{
+		"sub": "alice", "iss": cfg.Issuer, "aud": cfg.Audience, "exp": time.Now().Add(time.Hour).Unix(),
+	}
+	token := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "current"}, claims, key, nil)
+	unknown := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "unknown"}, claims, key, nil)
+
+	// The provider goes down while the keys are stale
+	server.set(nil, true)
+	j.mu.Lock()
+	j.fetchedAt = time.Now().Add(-cfg.RefreshInterval - time.Second)
+	j.attemptedAt = j.fetchedAt
+	j.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				if _, err := j.Authenticate(bearerRequest(token)); err != nil {
+					t.Errorf("token rejected while the provider is down: %v", err)
+				}
+			} else {
+				j.Authenticate(bearerRequest(unknown))
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Requests after the failed fetch do not fetch again
+	for i := 0; i < 5; i++ {
+		if _, err := j.Authenticate(bearerRequest(token)); err != nil {
+			t.Errorf("token rejected while the provider is down: %v", err)
+		}
+		j.Authenticate(bearerRequest(unknown))
+	}
+
+	j.mu.RLock()
+	for j.refreshing != nil {
+		done := j.refreshing
+		j.mu.RUnlock()
+		<-done
+		j.mu.RLock()
+	}
+	j.mu.RUnlock()
+	// One fetch at construction, one shared by every request since
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it understands, so the next one can be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator verifies the credentials of a request
+type Authenticator interface {
+	// Authenticate returns the caller identity, ErrNoCredentials if the
+	// request has no credentials for this authenticator, or another error
+	// if the credentials are invalid.
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// FromConfig builds the authenticators enabled in the configuration
+func FromConfig(cfg config.AuthConfig) ([]Authenticator, error) {
+	var authenticators []Authenticator
+	if cfg.HtpasswdFile != "" {
+		h, err := LoadHtpasswd(cfg.HtpasswdFile, cfg.Users)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, h)
+	}
+	if cfg.APIKeysFile != "" {
+		k, err := LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, k)
+	}
+	if cfg.JWT.Enabled() {
+		j, err := NewJWTAuthenticator(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, j)
+	}
+	return authenticators, nil
+}
+
+// Middleware rejects requests that no authenticator accepts. Paths listed
+// in exempt are served without authentication.
+func Middleware(authenticators []Authenticator, exempt ...string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, a := range authenticators {
+				id, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					log.Printf("Authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+					unauthorized(w, r)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+
+			unauthorized(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="orchestrator"`)
+	utils.ErrorResponse(w, r, http.StatusUnauthorized, models.CodeUnauthorized, "Unauthorized")
+}
@@ -1,37 +1,368 @@
 package config
 
-import "os"
+import (
+	"net"
+	"strings"
+	"time"
 
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the orchestrator settings. Values are layered: built-in
+// defaults, then the YAML config file, then environment variables, then
+// command-line flags.
 type Config struct {
-    TraefikNetwork   string
-    Domain           string
-    LetsEncryptEmail string
-    AuthCredentials  string // Basic auth in htpasswd format
-    DefaultVNCConfig VNCConfig
-    BehindProxy bool
+	ListenAddr       string            `yaml:"listen_addr"`
+	BehindProxy      bool              `yaml:"behind_proxy"`
+	PublicURL        string            `yaml:"public_url"` // URL clients reach the API at, e.g. https://gateway.example.com/orchestrator
+	TLS              TLSConfig         `yaml:"tls"`
+	Timeouts         TimeoutConfig     `yaml:"timeouts"`
+	Network          string            `yaml:"network"` // Docker network shared with the proxy
+	Registry         RegistryConfig    `yaml:"registry"`
+	Auth             AuthConfig        `yaml:"auth"`
+	DefaultVNCConfig VNCConfig         `yaml:"default_vnc"`
+	WarmPool         map[string]int    `yaml:"warm_pool"` // Idle pre-started containers per catalog image ID
+	Capacity         CapacityConfig    `yaml:"capacity"`
+	DefaultResources Resources         `yaml:"default_resources"` // Applied when neither the request nor the image sets a value
+	MaxResources     Resources         `yaml:"max_resources"`     // Upper bounds for requested resources, unset fields are unbounded
+	Quotas           QuotaConfig       `yaml:"quotas"`
+	Access           AccessConfig      `yaml:"access"`
+	Audit            AuditConfig       `yaml:"audit"`
+	RateLimit        RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency      IdempotencyConfig `yaml:"idempotency"`
+	Exec             ExecConfig        `yaml:"exec"`
+	Files            FilesConfig       `yaml:"files"`
+	Desktop          DesktopConfig     `yaml:"desktop"`
+}
+
+// TimeoutConfig holds the HTTP server timeouts
+type TimeoutConfig struct {
+	Read    time.Duration `yaml:"read"`
+	Write   time.Duration `yaml:"write"`
+	Idle    time.Duration `yaml:"idle"`
+	Request time.Duration `yaml:"request"` // Per-request handler deadline
+}
+
+// TLSConfig serves the API over HTTPS. The certificate and the client CA
+// bundle are reloaded when their files change.
+type TLSConfig struct {
+	CertFile          string `yaml:"cert_file"`           // PEM certificate chain, plain HTTP when empty
+	KeyFile           string `yaml:"key_file"`            // PEM private key
+	ClientCAFile      string `yaml:"client_ca_file"`      // CA bundle client certificates are verified against
+	RequireClientCert bool   `yaml:"require_client_cert"` // Reject connections without a verified client certificate
+}
+
+// Enabled reports whether the API is served over TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// RegistryConfig selects where container services are registered for routing
+type RegistryConfig struct {
+	Backend string          `yaml:"backend"` // "consul" or "none"
+	Address string          `yaml:"address"`
+	TLS     ClientTLSConfig `yaml:"tls"`
+}
+
+// ClientTLSConfig secures outbound connections
+type ClientTLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CAFile     string `yaml:"ca_file"`     // CA bundle the server is verified against, system roots when empty
+	CertFile   string `yaml:"cert_file"`   // Client certificate for mutual TLS
+	KeyFile    string `yaml:"key_file"`    // Private key of the client certificate
+	ServerName string `yaml:"server_name"` // Name expected in the server certificate, the address host when empty
+}
+
+// AuthConfig selects how API callers are authenticated. At least one
+// backend must be configured unless authentication is explicitly disabled.
+type AuthConfig struct {
+	Disabled     bool                  `yaml:"disabled"`
+	HtpasswdFile string                `yaml:"htpasswd_file"` // Basic auth users, bcrypt or apr1 hashes
+	APIKeysFile  string                `yaml:"api_keys_file"` // YAML list of named, SHA-256 hashed API keys
+	JWT          JWTConfig             `yaml:"jwt"`
+	Users        map[string]UserConfig `yaml:"users"` // Tenant and roles of htpasswd users and client certificate subjects
+	// Origins of web pages besides the API's own that may open WebSockets
+	// and DevTools connections, e.g. https://console.example.com
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// UserConfig grants a tenant and roles to a basic auth user
+type UserConfig struct {
+	Tenant string   `yaml:"tenant"`
+	Roles  []string `yaml:"roles"` // "operator", "tenant-admin" or none for a regular user
+}
+
+// JWTConfig validates bearer tokens against a JWKS read from a file or URL
+type JWTConfig struct {
+	JWKSFile        string        `yaml:"jwks_file"`
+	JWKSURL         string        `yaml:"jwks_url"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // How often the JWKS URL is fetched again
+	Issuer          string        `yaml:"issuer"`           // Required iss claim when set
+	Audience        string        `yaml:"audience"`         // Required aud claim when set
+	SubjectClaim    string        `yaml:"subject_claim"`
+	TenantClaim     string        `yaml:"tenant_claim"`
+	RolesClaim      string        `yaml:"roles_claim"` // Dotted paths such as realm_access.roles are allowed
+}
+
+// Enabled reports whether a key source is configured
+func (j JWTConfig) Enabled() bool {
+	return j.JWKSFile != "" || j.JWKSURL != ""
+}
+
+// CapacityConfig limits how many sessions run and start at once. Zero means unlimited.
+type CapacityConfig struct {
+	MaxSessions         int            `yaml:"max_sessions"`           // Sessions starting or running across all images
+	MaxSessionsPerImage map[string]int `yaml:"max_sessions_per_image"` // Sessions starting or running per catalog image ID
+	MaxConcurrentStarts int            `yaml:"max_concurrent_starts"`  // Containers being created at the same time
+	MaxQueueLength      int            `yaml:"max_queue_length"`       // Requests waiting for capacity before new ones are rejected
+	MaxPriority         int            `yaml:"max_priority"`           // Requests may have priorities from -max_priority to max_priority
+}
+
+// AccessConfig controls the signed links that give viewers access to a session desktop
+type AccessConfig struct {
+	Secret     string        `yaml:"secret"`      // HMAC key for link tokens, random per process when empty
+	DefaultTTL time.Duration `yaml:"default_ttl"` // Link lifetime when the request sets none
+	MaxTTL     time.Duration `yaml:"max_ttl"`     // Longest lifetime a link may be minted with
+}
+
+// AuditConfig selects where management actions are recorded
+type AuditConfig struct {
+	File string `yaml:"file"` // JSON lines file, recent events are only kept in memory when empty
+}
+
+// IdempotencyConfig controls how long Idempotency-Key results are remembered
+type IdempotencyConfig struct {
+	Retention time.Duration `yaml:"retention"` // Window in which a retried request returns the original result
+}
+
+// ExecConfig bounds commands run in sessions
+type ExecConfig struct {
+	DefaultTimeout time.Duration `yaml:"default_timeout"` // For commands run to completion without a timeout of their own
+	MaxTimeout     time.Duration `yaml:"max_timeout"`     // Longest any command may run, also the default for streamed commands
+}
+
+// FilesConfig bounds file transfers with sessions
+type FilesConfig struct {
+	AllowedPaths    []string            `yaml:"allowed_paths"`     // Directories files may be transferred under, unless the image has its own
+	ImagePaths      map[string][]string `yaml:"image_paths"`       // Per catalog image ID, replacing the catalog and allowed_paths
+	MaxUploadSize   string              `yaml:"max_upload_size"`   // e.g. 100m
+	MaxDownloadSize string              `yaml:"max_download_size"` // e.g. 1g
+}
+
+// DesktopConfig controls the VNC connections the orchestrator itself opens
+// to session desktops, for screenshots, input and recordings
+type DesktopConfig struct {
+	ScreenshotCacheTTL time.Duration   `yaml:"screenshot_cache_ttl"` // Screenshots younger than this are served again, 0 to always capture
+	IdleTimeout        time.Duration   `yaml:"idle_timeout"`         // Unused connections are closed after this long
+	Recording          RecordingConfig `yaml:"recording"`
+}
+
+// RecordingConfig controls recordings of session desktops
+type RecordingConfig struct {
+	Directory string        `yaml:"directory"`  // Local directory recordings are stored in, one subdirectory per session
+	FrameRate int           `yaml:"frame_rate"` // Frames per second
+	Quality   int           `yaml:"quality"`    // JPEG quality of frames, 1 to 100
+	Retention time.Duration `yaml:"retention"`  // Finished recordings are deleted after this long, 0 to keep them
+}
+
+// RateLimitConfig throttles callers with a token bucket per caller and
+// route. Callers are authenticated identities, or client IPs without one.
+type RateLimitConfig struct {
+	Default    RateRule            `yaml:"default"`
+	Routes     map[string]RateRule `yaml:"routes"`      // Keyed by "METHOD /pattern" or "/pattern", e.g. "POST /containers"
+	FailedAuth RateRule            `yaml:"failed_auth"` // Failed authentications per client IP, checked before credentials
+}
+
+// RateRule is a token bucket. A zero rate disables limiting.
+type RateRule struct {
+	Rate  float64 `yaml:"rate"`  // Requests per second
+	Burst int     `yaml:"burst"` // Requests allowed at once
+}
+
+// QuotaConfig limits what each tenant may run. Tenants without an entry get the default quota.
+type QuotaConfig struct {
+	Default Quota            `yaml:"default"`
+	Tenants map[string]Quota `yaml:"tenants"`
+}
+
+// Quota holds the limits of one tenant. Zero values and an empty category list mean unlimited.
+type Quota struct {
+	MaxSessions       int           `yaml:"max_sessions"`       // Sessions queued, starting or running
+	MaxCPUs           float64       `yaml:"max_cpus"`           // CPUs reserved by those sessions
+	MaxMemory         string        `yaml:"max_memory"`         // Memory reserved by those sessions, e.g. 16g
+	AllowedCategories []string      `yaml:"allowed_categories"` // Catalog image categories the tenant may start
+	MaxTTL            time.Duration `yaml:"max_ttl"`            // Longest lifetime of a session, also its default TTL
+}
+
+// For returns the quota of a tenant
+func (q QuotaConfig) For(tenant string) Quota {
+	if quota, ok := q.Tenants[tenant]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+// Resources holds the host resources of a session. Sizes use Docker notation such as "512m" or "2g".
+type Resources struct {
+	CPUs       float64 `json:"cpus,omitempty" yaml:"cpus"`
+	Memory     string  `json:"memory,omitempty" yaml:"memory"`
+	MemorySwap string  `json:"memory_swap,omitempty" yaml:"memory_swap"`
+	PidsLimit  int64   `json:"pids_limit,omitempty" yaml:"pids_limit"`
+	ShmSize    string  `json:"shm_size,omitempty" yaml:"shm_size"`
 }
 
 type VNCConfig struct {
-    Password   string `json:"password"`
-    Resolution string `json:"resolution"`
-    ColDepth   int    `json:"colDepth"`
-    ViewOnly   bool   `json:"viewOnly"`
-    Display    string `json:"display"`
-}
-
-func Load() *Config {
-    return &Config{
-        TraefikNetwork:   "traefik_network",
-        Domain:           "yourdomain.com",
-        LetsEncryptEmail: "admin@yourdomain.com",
-        AuthCredentials:  "user:$apr1$...", // Generated htpasswd
-        BehindProxy:      os.Getenv("BEHIND_PROXY") == "true",
-        DefaultVNCConfig: VNCConfig{
-            Password:   "headless",
-            Resolution: "1360x768",
-            ColDepth:   24,
-            ViewOnly:   false,
-            Display:    ":1",
-        },
-    }
-}
\ No newline at end of file
+	Password   string `json:"password" yaml:"password"`
+	Resolution string `json:"resolution" yaml:"resolution"`
+	ColDepth   int    `json:"colDepth" yaml:"col_depth"`
+	ViewOnly   bool   `json:"viewOnly" yaml:"view_only"`
+	Display    string `json:"display" yaml:"display"`
+}
+
+// Defaults returns the built-in configuration
+func Defaults() *Config {
+	return &Config{
+		ListenAddr: "0.0.0.0:8090",
+		Timeouts: TimeoutConfig{
+			Read:    5 * time.Second,
+			Write:   10 * time.Second,
+			Idle:    15 * time.Second,
+			Request: 30 * time.Second,
+		},
+		Network: "fabio_network",
+		Registry: RegistryConfig{
+			Backend: "consul",
+			Address: "localhost:8500",
+		},
+		Auth: AuthConfig{
+			JWT: JWTConfig{
+				RefreshInterval: 15 * time.Minute,
+				SubjectClaim:    "sub",
+				TenantClaim:     "tenant",
+				RolesClaim:      "roles",
+			},
+		},
+		DefaultVNCConfig: VNCConfig{
+			Resolution: "1360x768",
+			ColDepth:   24,
+			ViewOnly:   false,
+			Display:    ":1",
+		},
+		WarmPool: map[string]int{},
+		Capacity: CapacityConfig{
+			MaxSessions:         50,
+			MaxSessionsPerImage: map[string]int{},
+			MaxConcurrentStarts: 4,
+			MaxQueueLength:      100,
+			MaxPriority:         100,
+		},
+		DefaultResources: Resources{
+			CPUs:      2,
+			Memory:    "2g",
+			PidsLimit: 1024,
+			ShmSize:   "1g", // Docker's 64m default crashes Chromium
+		},
+		MaxResources: Resources{
+			CPUs:       4,
+			Memory:     "8g",
+			MemorySwap: "8g",
+			PidsLimit:  4096,
+			ShmSize:    "4g",
+		},
+		Quotas: QuotaConfig{
+			Tenants: map[string]Quota{},
+		},
+		RateLimit: RateLimitConfig{
+			Default: RateRule{Rate: 10, Burst: 20},
+			Routes: map[string]RateRule{
+				"POST /containers":       {Rate: 0.5, Burst: 10},
+				"POST /containers/batch": {Rate: 0.1, Burst: 3}, // Up to 100 sessions each
+				"/health":                {},                    // Polled by Consul and the load balancer
+			},
+			FailedAuth: RateRule{Rate: 0.2, Burst: 10},
+		},
+		Access: AccessConfig{
+			DefaultTTL: 15 * time.Minute,
+			MaxTTL:     24 * time.Hour,
+		},
+		Idempotency: IdempotencyConfig{
+			Retention: 24 * time.Hour,
+		},
+		Exec: ExecConfig{
+			DefaultTimeout: 30 * time.Second,
+			MaxTimeout:     time.Hour,
+		},
+		Desktop: DesktopConfig{
+			ScreenshotCacheTTL: time.Second,
+			IdleTimeout:        2 * time.Minute,
+			Recording: RecordingConfig{
+				Directory: "recordings",
+				FrameRate: 2,
+				Quality:   70,
+				Retention: 7 * 24 * time.Hour,
+			},
+		},
+		Files: FilesConfig{
+			AllowedPaths:    []string{"/home/headless"}, // Home of the desktop user, with Desktop and Downloads
+			MaxUploadSize:   "100m",
+			MaxDownloadSize: "1g",
+		},
+	}
+}
+
+// APIBaseURL returns the URL clients reach the API at: public_url, or
+// without it the local address the Swagger docs are served for
+func (c *Config) APIBaseURL() string {
+	if c.PublicURL != "" {
+		return strings.TrimSuffix(c.PublicURL, "/")
+	}
+	if c.BehindProxy {
+		return "http://localhost:9999/orchestrator"
+	}
+	scheme := "http"
+	if c.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	_, port, _ := net.SplitHostPort(c.ListenAddr)
+	return scheme + "://localhost:" + port
+}
+
+// Map returns the settings keyed by their config file names, for the audit log
+func (c *Config) Map() map[string]interface{} {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if yaml.Unmarshal(data, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the given command-line arguments, and validates it.
+func Load(args []string) (*Config, error) {
+	flags, configFile, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Defaults()
+	if configFile != "" {
+		if err := loadFile(cfg, configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := applyFlags(cfg, flags); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
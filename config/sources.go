@@ -0,0 +1,282 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is an option that can be set from the environment and the command line
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	apply  func(cfg *Config, value string) error
+}
+
+var settings = []setting{
+	stringSetting("listen-addr", "LISTEN_ADDR", "address the API listens on", func(c *Config) *string { return &c.ListenAddr }),
+	boolSetting("behind-proxy", "BEHIND_PROXY", "serve the API under the /orchestrator prefix of the proxy", func(c *Config) *bool { return &c.BehindProxy }),
+	stringSetting("public-url", "PUBLIC_URL", "URL clients reach the API at, used in the URLs handed out", func(c *Config) *string { return &c.PublicURL }),
+	stringSetting("tls-cert-file", "TLS_CERT_FILE", "PEM certificate to serve the API over HTTPS", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key-file", "TLS_KEY_FILE", "PEM private key of the API certificate", func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls-client-ca-file", "TLS_CLIENT_CA_FILE", "CA bundle to verify client certificates against", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+	boolSetting("tls-require-client-cert", "TLS_REQUIRE_CLIENT_CERT", "reject API connections without a verified client certificate", func(c *Config) *bool { return &c.TLS.RequireClientCert }),
+	durationSetting("read-timeout", "READ_TIMEOUT", "maximum duration for reading a request", func(c *Config) *time.Duration { return &c.Timeouts.Read }),
+	durationSetting("write-timeout", "WRITE_TIMEOUT", "maximum duration for writing a response", func(c *Config) *time.Duration { return &c.Timeouts.Write }),
+	durationSetting("idle-timeout", "IDLE_TIMEOUT", "maximum keep-alive idle time", func(c *Config) *time.Duration { return &c.Timeouts.Idle }),
+	durationSetting("request-timeout", "REQUEST_TIMEOUT", "deadline for handling a request", func(c *Config) *time.Duration { return &c.Timeouts.Request }),
+	stringSetting("network", "DOCKER_NETWORK", "Docker network shared by the containers and the proxy", func(c *Config) *string { return &c.Network }),
+	stringSetting("registry-backend", "REGISTRY_BACKEND", "service registry backend: consul or none", func(c *Config) *string { return &c.Registry.Backend }),
+	stringSetting("registry-addr", "CONSUL_HTTP_ADDR", "service registry address", func(c *Config) *string { return &c.Registry.Address }),
+	boolSetting("registry-tls", "CONSUL_HTTP_SSL", "connect to the registry over HTTPS", func(c *Config) *bool { return &c.Registry.TLS.Enabled }),
+	stringSetting("registry-tls-ca-file", "CONSUL_CACERT", "CA bundle to verify the registry against", func(c *Config) *string { return &c.Registry.TLS.CAFile }),
+	stringSetting("registry-tls-cert-file", "CONSUL_CLIENT_CERT", "client certificate for the registry", func(c *Config) *string { return &c.Registry.TLS.CertFile }),
+	stringSetting("registry-tls-key-file", "CONSUL_CLIENT_KEY", "private key of the registry client certificate", func(c *Config) *string { return &c.Registry.TLS.KeyFile }),
+	stringSetting("registry-tls-server-name", "CONSUL_TLS_SERVER_NAME", "name expected in the registry certificate", func(c *Config) *string { return &c.Registry.TLS.ServerName }),
+	boolSetting("auth-disabled", "AUTH_DISABLED", "serve the API without authentication", func(c *Config) *bool { return &c.Auth.Disabled }),
+	stringSetting("auth-htpasswd-file", "AUTH_HTPASSWD_FILE", "htpasswd file for basic authentication", func(c *Config) *string { return &c.Auth.HtpasswdFile }),
+	stringSetting("auth-api-keys-file", "AUTH_API_KEYS_FILE", "YAML file of hashed API keys", func(c *Config) *string { return &c.Auth.APIKeysFile }),
+	stringSetting("auth-jwks-file", "AUTH_JWKS_FILE", "JWKS file for bearer token validation", func(c *Config) *string { return &c.Auth.JWT.JWKSFile }),
+	stringSetting("auth-jwks-url", "AUTH_JWKS_URL", "JWKS URL for bearer token validation", func(c *Config) *string { return &c.Auth.JWT.JWKSURL }),
+	stringSetting("auth-jwt-issuer", "AUTH_JWT_ISSUER", "required token issuer", func(c *Config) *string { return &c.Auth.JWT.Issuer }),
+	stringSetting("auth-jwt-audience", "AUTH_JWT_AUDIENCE", "required token audience", func(c *Config) *string { return &c.Auth.JWT.Audience }),
+	stringSetting("auth-jwt-subject-claim", "AUTH_JWT_SUBJECT_CLAIM", "claim holding the caller subject", func(c *Config) *string { return &c.Auth.JWT.SubjectClaim }),
+	stringSetting("auth-jwt-tenant-claim", "AUTH_JWT_TENANT_CLAIM", "claim holding the caller tenant", func(c *Config) *string { return &c.Auth.JWT.TenantClaim }),
+	stringSetting("auth-jwt-roles-claim", "AUTH_JWT_ROLES_CLAIM", "claim holding the caller roles", func(c *Config) *string { return &c.Auth.JWT.RolesClaim }),
+	listSetting("auth-allowed-origins", "AUTH_ALLOWED_ORIGINS", "origins of other web pages allowed to open WebSockets, comma separated", func(c *Config) *[]string { return &c.Auth.AllowedOrigins }),
+	stringSetting("vnc-resolution", "DEFAULT_VNC_RESOLUTION", "default VNC resolution, e.g. 1360x768", func(c *Config) *string { return &c.DefaultVNCConfig.Resolution }),
+	intSetting("vnc-col-depth", "DEFAULT_VNC_COL_DEPTH", "default VNC color depth: 16, 24 or 32", func(c *Config) *int { return &c.DefaultVNCConfig.ColDepth }),
+	stringSetting("vnc-display", "DEFAULT_VNC_DISPLAY", "default X display, e.g. :1", func(c *Config) *string { return &c.DefaultVNCConfig.Display }),
+	boolSetting("vnc-view-only", "DEFAULT_VNC_VIEW_ONLY", "start sessions in view-only mode by default", func(c *Config) *bool { return &c.DefaultVNCConfig.ViewOnly }),
+	countsSetting("warm-pool", "WARM_POOL", "idle containers per image, e.g. ubuntu-chromium=2,debian-base=1", func(c *Config) *map[string]int { return &c.WarmPool }),
+	intSetting("max-sessions", "MAX_SESSIONS", "sessions starting or running across all images (0 = unlimited)", func(c *Config) *int { return &c.Capacity.MaxSessions }),
+	countsSetting("max-sessions-per-image", "MAX_SESSIONS_PER_IMAGE", "sessions per image, e.g. ubuntu-chromium=10", func(c *Config) *map[string]int { return &c.Capacity.MaxSessionsPerImage }),
+	intSetting("max-concurrent-starts", "MAX_CONCURRENT_STARTS", "containers created at the same time (0 = unlimited)", func(c *Config) *int { return &c.Capacity.MaxConcurrentStarts }),
+	intSetting("max-queue-length", "MAX_QUEUE_LENGTH", "queued creation requests before rejecting (0 = unlimited)", func(c *Config) *int { return &c.Capacity.MaxQueueLength }),
+	intSetting("max-priority", "MAX_PRIORITY", "largest queue priority operators may give a request", func(c *Config) *int { return &c.Capacity.MaxPriority }),
+	floatSetting("default-cpus", "DEFAULT_CPUS", "default CPUs per session", func(c *Config) *float64 { return &c.DefaultResources.CPUs }),
+	stringSetting("default-memory", "DEFAULT_MEMORY", "default memory per session, e.g. 2g", func(c *Config) *string { return &c.DefaultResources.Memory }),
+	stringSetting("default-memory-swap", "DEFAULT_MEMORY_SWAP", "default memory plus swap per session", func(c *Config) *string { return &c.DefaultResources.MemorySwap }),
+	int64Setting("default-pids-limit", "DEFAULT_PIDS_LIMIT", "default process limit per session", func(c *Config) *int64 { return &c.DefaultResources.PidsLimit }),
+	stringSetting("default-shm-size", "DEFAULT_SHM_SIZE", "default /dev/shm size per session", func(c *Config) *string { return &c.DefaultResources.ShmSize }),
+	floatSetting("max-cpus", "MAX_CPUS", "maximum CPUs per session", func(c *Config) *float64 { return &c.MaxResources.CPUs }),
+	stringSetting("max-memory", "MAX_MEMORY", "maximum memory per session", func(c *Config) *string { return &c.MaxResources.Memory }),
+	stringSetting("max-memory-swap", "MAX_MEMORY_SWAP", "maximum memory plus swap per session", func(c *Config) *string { return &c.MaxResources.MemorySwap }),
+	int64Setting("max-pids-limit", "MAX_PIDS_LIMIT", "maximum process limit per session", func(c *Config) *int64 { return &c.MaxResources.PidsLimit }),
+	stringSetting("max-shm-size", "MAX_SHM_SIZE", "maximum /dev/shm size per session", func(c *Config) *string { return &c.MaxResources.ShmSize }),
+	intSetting("quota-max-sessions", "QUOTA_MAX_SESSIONS", "default per-tenant session quota (0 = unlimited)", func(c *Config) *int { return &c.Quotas.Default.MaxSessions }),
+	floatSetting("quota-max-cpus", "QUOTA_MAX_CPUS", "default per-tenant CPU quota (0 = unlimited)", func(c *Config) *float64 { return &c.Quotas.Default.MaxCPUs }),
+	stringSetting("quota-max-memory", "QUOTA_MAX_MEMORY", "default per-tenant memory quota, e.g. 16g", func(c *Config) *string { return &c.Quotas.Default.MaxMemory }),
+	listSetting("quota-allowed-categories", "QUOTA_ALLOWED_CATEGORIES", "default per-tenant image categories, comma separated", func(c *Config) *[]string { return &c.Quotas.Default.AllowedCategories }),
+	durationSetting("quota-max-ttl", "QUOTA_MAX_TTL", "default per-tenant session lifetime, e.g. 8h (0 = unlimited)", func(c *Config) *time.Duration { return &c.Quotas.Default.MaxTTL }),
+	stringSetting("access-secret", "ACCESS_TOKEN_SECRET", "HMAC key for desktop access links (random when empty)", func(c *Config) *string { return &c.Access.Secret }),
+	durationSetting("access-default-ttl", "ACCESS_LINK_TTL", "default lifetime of desktop access links", func(c *Config) *time.Duration { return &c.Access.DefaultTTL }),
+	durationSetting("access-max-ttl", "ACCESS_LINK_MAX_TTL", "maximum lifetime of desktop access links", func(c *Config) *time.Duration { return &c.Access.MaxTTL }),
+	floatSetting("rate-limit", "RATE_LIMIT", "requests per second per caller on routes without their own rule (0 = unlimited)", func(c *Config) *float64 { return &c.RateLimit.Default.Rate }),
+	intSetting("rate-limit-burst", "RATE_LIMIT_BURST", "requests per caller allowed at once on routes without their own rule", func(c *Config) *int { return &c.RateLimit.Default.Burst }),
+	floatSetting("rate-limit-failed-auth", "RATE_LIMIT_FAILED_AUTH", "failed authentications per second per client IP (0 = unlimited)", func(c *Config) *float64 { return &c.RateLimit.FailedAuth.Rate }),
+	intSetting("rate-limit-failed-auth-burst", "RATE_LIMIT_FAILED_AUTH_BURST", "failed authentications per client IP allowed at once", func(c *Config) *int { return &c.RateLimit.FailedAuth.Burst }),
+	durationSetting("idempotency-retention", "IDEMPOTENCY_RETENTION", "how long Idempotency-Key results are remembered", func(c *Config) *time.Duration { return &c.Idempotency.Retention }),
+	durationSetting("exec-default-timeout", "EXEC_DEFAULT_TIMEOUT", "timeout of commands run in sessions that set none", func(c *Config) *time.Duration { return &c.Exec.DefaultTimeout }),
+	durationSetting("exec-max-timeout", "EXEC_MAX_TIMEOUT", "longest a command run in a session may take", func(c *Config) *time.Duration { return &c.Exec.MaxTimeout }),
+	listSetting("files-allowed-paths", "FILES_ALLOWED_PATHS", "directories files may be transferred under, comma separated", func(c *Config) *[]string { return &c.Files.AllowedPaths }),
+	stringSetting("files-max-upload-size", "FILES_MAX_UPLOAD_SIZE", "largest file that may be uploaded to a session, e.g. 100m", func(c *Config) *string { return &c.Files.MaxUploadSize }),
+	stringSetting("files-max-download-size", "FILES_MAX_DOWNLOAD_SIZE", "largest file that may be downloaded from a session, e.g. 1g", func(c *Config) *string { return &c.Files.MaxDownloadSize }),
+	durationSetting("desktop-screenshot-cache-ttl", "DESKTOP_SCREENSHOT_CACHE_TTL", "how long a screenshot is served again (0 = always capture)", func(c *Config) *time.Duration { return &c.Desktop.ScreenshotCacheTTL }),
+	durationSetting("desktop-idle-timeout", "DESKTOP_IDLE_TIMEOUT", "when unused VNC connections of the orchestrator are closed", func(c *Config) *time.Duration { return &c.Desktop.IdleTimeout }),
+	stringSetting("recording-dir", "RECORDING_DIR", "directory session recordings are stored in", func(c *Config) *string { return &c.Desktop.Recording.Directory }),
+	intSetting("recording-frame-rate", "RECORDING_FRAME_RATE", "frames per second of session recordings", func(c *Config) *int { return &c.Desktop.Recording.FrameRate }),
+	durationSetting("recording-retention", "RECORDING_RETENTION", "when finished recordings are deleted (0 = never)", func(c *Config) *time.Duration { return &c.Desktop.Recording.Retention }),
+	stringSetting("audit-log-file", "AUDIT_LOG_FILE", "JSON lines audit log (kept in memory when empty)", func(c *Config) *string { return &c.Audit.File }),
+}
+
+// settingFlag records whether a flag was given on the command line
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string     { return f.value }
+func (f *settingFlag) Set(v string) error { f.value = v; return nil }
+func (f *settingFlag) IsBoolFlag() bool   { return f.isBool }
+
+// parseFlags parses the command line and returns the settings given on it and the config file path
+func parseFlags(args []string) (map[string]string, string, error) {
+	fs := flag.NewFlagSet("orchestrator", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("ORCHESTRATOR_CONFIG"), "path to a YAML config file (env ORCHESTRATOR_CONFIG)")
+
+	values := make(map[string]*settingFlag)
+	for _, s := range settings {
+		values[s.flag] = &settingFlag{isBool: s.isBool}
+		fs.Var(values[s.flag], s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	given := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if v, ok := values[f.Name]; ok {
+			given[f.Name] = v.value
+		}
+	})
+	return given, *configFile, nil
+}
+
+// loadFile overlays the YAML config file on the configuration
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %v", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv overlays the environment variables that are set
+func applyEnv(cfg *Config) error {
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+		if err := s.apply(cfg, value); err != nil {
+			return fmt.Errorf("environment variable %s: %v", s.env, err)
+		}
+	}
+	return nil
+}
+
+// applyFlags overlays the command-line flags that were given
+func applyFlags(cfg *Config, given map[string]string) error {
+	for _, s := range settings {
+		value, ok := given[s.flag]
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, value); err != nil {
+			return fmt.Errorf("flag -%s: %v", s.flag, err)
+		}
+	}
+	return nil
+}
+
+func stringSetting(name, env, usage string, field func(*Config) *string) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func boolSetting(name, env, usage string, field func(*Config) *bool) setting {
+	return setting{flag: name, env: env, usage: usage, isBool: true, apply: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func intSetting(name, env, usage string, field func(*Config) *int) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func int64Setting(name, env, usage string, field func(*Config) *int64) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(name, env, usage string, field func(*Config) *float64) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func durationSetting(name, env, usage string, field func(*Config) *time.Duration) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s", v)
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func listSetting(name, env, usage string, field func(*Config) *[]string) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func countsSetting(name, env, usage string, field func(*Config) *map[string]int) setting {
+	return setting{flag: name, env: env, usage: usage, apply: func(c *Config, v string) error {
+		counts, err := parseImageCounts(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = counts
+		return nil
+	}}
+}
+
+// parseImageCounts parses a per-image specification such as "ubuntu-chromium=2,debian-base=1"
+func parseImageCounts(spec string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		imageID, size, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in image=count form", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q has an invalid count", entry)
+		}
+		counts[strings.TrimSpace(imageID)] = n
+	}
+	return counts, nil
+}
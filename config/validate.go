@@ -0,0 +1,350 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+var (
+	resolutionPattern  = regexp.MustCompile(`^([1-9][0-9]{2,4})x([1-9][0-9]{2,4})$`)
+	displayPattern     = regexp.MustCompile(`^(:[0-9]{1,3})(\.[0-9]{1,2})?$`)
+	vncPasswordPattern = regexp.MustCompile(`^[!-~]{6,8}$`)
+)
+
+// Bounds of a VNC resolution
+const (
+	MinResolutionWidth  = 320
+	MinResolutionHeight = 200
+	MaxResolutionWidth  = 7680
+	MaxResolutionHeight = 4320
+)
+
+// Validate checks the configuration and reports every problem found
+func (c *Config) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		fail("listen_addr %q must be host:port", c.ListenAddr)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		fail("listen_addr %q has an invalid port", c.ListenAddr)
+	}
+
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			fail("public_url %q must be an http or https URL such as https://gateway.example.com/orchestrator", c.PublicURL)
+		}
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"timeouts.read", c.Timeouts.Read},
+		{"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle},
+		{"timeouts.request", c.Timeouts.Request},
+	} {
+		if timeout.value <= 0 {
+			fail("%s must be positive", timeout.name)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls: set both cert_file and key_file")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		fail("tls.client_ca_file requires tls.cert_file")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		fail("tls.require_client_cert requires tls.client_ca_file")
+	}
+
+	if c.Network == "" {
+		fail("network must not be empty")
+	}
+
+	switch c.Registry.Backend {
+	case "consul":
+		if _, _, err := net.SplitHostPort(c.Registry.Address); err != nil {
+			fail("registry.address %q must be host:port", c.Registry.Address)
+		}
+	case "none":
+	default:
+		fail("registry.backend %q must be consul or none", c.Registry.Backend)
+	}
+	if (c.Registry.TLS.CertFile == "") != (c.Registry.TLS.KeyFile == "") {
+		fail("registry.tls: set both cert_file and key_file")
+	}
+	if !c.Registry.TLS.Enabled && (c.Registry.TLS.CAFile != "" || c.Registry.TLS.CertFile != "" || c.Registry.TLS.ServerName != "") {
+		fail("registry.tls: set enabled to use its options")
+	}
+
+	if !c.Auth.Disabled && c.Auth.HtpasswdFile == "" && c.Auth.APIKeysFile == "" && !c.Auth.JWT.Enabled() && c.TLS.ClientCAFile == "" {
+		fail("auth: no authentication backend configured, set auth.htpasswd_file, auth.api_keys_file, auth.jwt or tls.client_ca_file (or auth.disabled to run an open API)")
+	}
+	if c.Auth.JWT.JWKSFile != "" && c.Auth.JWT.JWKSURL != "" {
+		fail("auth.jwt: set only one of jwks_file and jwks_url")
+	}
+	if c.Auth.JWT.Enabled() {
+		if c.Auth.JWT.SubjectClaim == "" {
+			fail("auth.jwt.subject_claim must not be empty")
+		}
+		if c.Auth.JWT.JWKSURL != "" && c.Auth.JWT.RefreshInterval <= 0 {
+			fail("auth.jwt.refresh_interval must be positive")
+		}
+	}
+
+	for _, origin := range c.Auth.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			fail("auth.allowed_origins %q must look like https://console.example.com", origin)
+		}
+	}
+
+	if c.DefaultVNCConfig.Resolution != "" && !ValidResolution(c.DefaultVNCConfig.Resolution) {
+		fail("default_vnc.resolution %q %s", c.DefaultVNCConfig.Resolution, ResolutionRule)
+	}
+	if c.DefaultVNCConfig.ColDepth != 0 && !ValidColDepth(c.DefaultVNCConfig.ColDepth) {
+		fail("default_vnc.col_depth %d must be 16, 24 or 32", c.DefaultVNCConfig.ColDepth)
+	}
+	if c.DefaultVNCConfig.Display != "" && !ValidDisplay(c.DefaultVNCConfig.Display) {
+		fail("default_vnc.display %q must look like :1", c.DefaultVNCConfig.Display)
+	}
+	if c.DefaultVNCConfig.Password != "" && !ValidVNCPassword(c.DefaultVNCConfig.Password) {
+		fail("default_vnc.password %s", VNCPasswordRule)
+	}
+
+	if c.Capacity.MaxSessions < 0 {
+		fail("capacity.max_sessions must not be negative")
+	}
+	if c.Capacity.MaxConcurrentStarts < 0 {
+		fail("capacity.max_concurrent_starts must not be negative")
+	}
+	if c.Capacity.MaxQueueLength < 0 {
+		fail("capacity.max_queue_length must not be negative")
+	}
+	if c.Capacity.MaxPriority < 0 {
+		fail("capacity.max_priority must not be negative")
+	}
+	for imageID, n := range c.Capacity.MaxSessionsPerImage {
+		if n < 0 {
+			fail("capacity.max_sessions_per_image.%s must not be negative", imageID)
+		}
+	}
+	for imageID, n := range c.WarmPool {
+		if n < 0 {
+			fail("warm_pool.%s must not be negative", imageID)
+		}
+	}
+
+	validateResources("default_resources", c.DefaultResources, fail)
+	validateResources("max_resources", c.MaxResources, fail)
+	if c.MaxResources.CPUs > 0 && c.DefaultResources.CPUs > c.MaxResources.CPUs {
+		fail("default_resources.cpus exceeds max_resources.cpus")
+	}
+	if c.MaxResources.PidsLimit > 0 && c.DefaultResources.PidsLimit > c.MaxResources.PidsLimit {
+		fail("default_resources.pids_limit exceeds max_resources.pids_limit")
+	}
+	for _, size := range []struct{ name, value, max string }{
+		{"memory", c.DefaultResources.Memory, c.MaxResources.Memory},
+		{"memory_swap", c.DefaultResources.MemorySwap, c.MaxResources.MemorySwap},
+		{"shm_size", c.DefaultResources.ShmSize, c.MaxResources.ShmSize},
+	} {
+		value, err1 := units.RAMInBytes(size.value)
+		limit, err2 := units.RAMInBytes(size.max)
+		if size.value != "" && size.max != "" && err1 == nil && err2 == nil && value > limit {
+			fail("default_resources.%s exceeds max_resources.%s", size.name, size.name)
+		}
+	}
+
+	if c.Access.Secret != "" && len(c.Access.Secret) < 32 {
+		fail("access.secret must be at least 32 characters")
+	}
+	if c.Access.DefaultTTL <= 0 || c.Access.MaxTTL <= 0 {
+		fail("access.default_ttl and access.max_ttl must be positive")
+	} else if c.Access.DefaultTTL > c.Access.MaxTTL {
+		fail("access.default_ttl exceeds access.max_ttl")
+	}
+
+	if c.Idempotency.Retention <= 0 {
+		fail("idempotency.retention must be positive")
+	}
+
+	if c.Exec.DefaultTimeout <= 0 || c.Exec.MaxTimeout <= 0 {
+		fail("exec.default_timeout and exec.max_timeout must be positive")
+	} else if c.Exec.DefaultTimeout > c.Exec.MaxTimeout {
+		fail("exec.default_timeout exceeds exec.max_timeout")
+	}
+
+	if c.Desktop.ScreenshotCacheTTL < 0 {
+		fail("desktop.screenshot_cache_ttl must not be negative")
+	}
+	if c.Desktop.IdleTimeout <= 0 {
+		fail("desktop.idle_timeout must be positive")
+	}
+	if c.Desktop.Recording.Directory == "" {
+		fail("desktop.recording.directory must not be empty")
+	}
+	if c.Desktop.Recording.FrameRate < 1 || c.Desktop.Recording.FrameRate > 30 {
+		fail("desktop.recording.frame_rate %d must be between 1 and 30", c.Desktop.Recording.FrameRate)
+	}
+	if c.Desktop.Recording.Quality < 1 || c.Desktop.Recording.Quality > 100 {
+		fail("desktop.recording.quality %d must be between 1 and 100", c.Desktop.Recording.Quality)
+	}
+	if c.Desktop.Recording.Retention < 0 {
+		fail("desktop.recording.retention must not be negative")
+	}
+
+	validateFilePaths("files.allowed_paths", c.Files.AllowedPaths, fail)
+	images := make([]string, 0, len(c.Files.ImagePaths))
+	for imageID := range c.Files.ImagePaths {
+		images = append(images, imageID)
+	}
+	sort.Strings(images)
+	for _, imageID := range images {
+		validateFilePaths("files.image_paths."+imageID, c.Files.ImagePaths[imageID], fail)
+	}
+	for _, size := range []struct{ name, value string }{
+		{"max_upload_size", c.Files.MaxUploadSize},
+		{"max_download_size", c.Files.MaxDownloadSize},
+	} {
+		if n, err := units.RAMInBytes(size.value); err != nil || n <= 0 {
+			fail("files.%s %q is not a size such as 512m or 2g", size.name, size.value)
+		}
+	}
+
+	validateRateRule("rate_limit.default", c.RateLimit.Default, fail)
+	validateRateRule("rate_limit.failed_auth", c.RateLimit.FailedAuth, fail)
+	routes := make([]string, 0, len(c.RateLimit.Routes))
+	for route := range c.RateLimit.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		if !strings.HasPrefix(route, "/") && !strings.Contains(route, " /") {
+			fail("rate_limit.routes %q must look like \"POST /containers\" or \"/containers\"", route)
+		}
+		validateRateRule("rate_limit.routes."+route, c.RateLimit.Routes[route], fail)
+	}
+
+	validateQuota("quotas.default", c.Quotas.Default, fail)
+	tenants := make([]string, 0, len(c.Quotas.Tenants))
+	for tenant := range c.Quotas.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	for _, tenant := range tenants {
+		validateQuota("quotas.tenants."+tenant, c.Quotas.Tenants[tenant], fail)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+// validateResources checks that resource values are well formed
+func validateResources(section string, r Resources, fail func(string, ...interface{})) {
+	if r.CPUs < 0 {
+		fail("%s.cpus must not be negative", section)
+	}
+	if r.PidsLimit < 0 {
+		fail("%s.pids_limit must not be negative", section)
+	}
+	for _, size := range []struct{ name, value string }{
+		{"memory", r.Memory},
+		{"memory_swap", r.MemorySwap},
+		{"shm_size", r.ShmSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		if n, err := units.RAMInBytes(size.value); err != nil || n <= 0 {
+			fail("%s.%s %q is not a size such as 512m or 2g", section, size.name, size.value)
+		}
+	}
+}
+
+// validateFilePaths checks that transfer directories are absolute and clean
+func validateFilePaths(section string, paths []string, fail func(string, ...interface{})) {
+	for _, p := range paths {
+		if !path.IsAbs(p) || path.Clean(p) != p || p == "/" {
+			fail("%s %q must be a clean absolute path below /", section, p)
+		}
+	}
+}
+
+// validateRateRule checks that a token bucket is well formed
+func validateRateRule(section string, r RateRule, fail func(string, ...interface{})) {
+	if r.Rate < 0 {
+		fail("%s.rate must not be negative", section)
+	}
+	if r.Rate > 0 && r.Burst < 1 {
+		fail("%s.burst must be at least 1", section)
+	}
+}
+
+// validateQuota checks that quota limits are well formed
+func validateQuota(section string, q Quota, fail func(string, ...interface{})) {
+	if q.MaxSessions < 0 {
+		fail("%s.max_sessions must not be negative", section)
+	}
+	if q.MaxCPUs < 0 {
+		fail("%s.max_cpus must not be negative", section)
+	}
+	if q.MaxMemory != "" {
+		if n, err := units.RAMInBytes(q.MaxMemory); err != nil || n <= 0 {
+			fail("%s.max_memory %q is not a size such as 512m or 2g", section, q.MaxMemory)
+		}
+	}
+	if q.MaxTTL < 0 {
+		fail("%s.max_ttl must not be negative", section)
+	}
+}
+
+// ResolutionRule describes the resolutions ValidResolution accepts
+var ResolutionRule = fmt.Sprintf("must be WIDTHxHEIGHT between %dx%d and %dx%d, e.g. 1360x768",
+	MinResolutionWidth, MinResolutionHeight, MaxResolutionWidth, MaxResolutionHeight)
+
+// ValidResolution reports whether a VNC resolution has the WIDTHxHEIGHT form and is within bounds
+func ValidResolution(resolution string) bool {
+	m := resolutionPattern.FindStringSubmatch(resolution)
+	if m == nil {
+		return false
+	}
+	width, _ := strconv.Atoi(m[1])
+	height, _ := strconv.Atoi(m[2])
+	return width >= MinResolutionWidth && width <= MaxResolutionWidth &&
+		height >= MinResolutionHeight && height <= MaxResolutionHeight
+}
+
+// ValidColDepth reports whether a VNC color depth is supported
+func ValidColDepth(depth int) bool {
+	return depth == 16 || depth == 24 || depth == 32
+}
+
+// ValidDisplay reports whether an X display name such as :1 is well formed
+func ValidDisplay(display string) bool {
+	return displayPattern.MatchString(display)
+}
+
+// VNCPasswordRule describes the passwords ValidVNCPassword accepts
+const VNCPasswordRule = "must be 6 to 8 printable ASCII characters without spaces"
+
+// ValidVNCPassword reports whether a password can be used for VNC
+// authentication, which only uses the first 8 characters and which
+// vncpasswd refuses below 6.
+func ValidVNCPassword(password string) bool {
+	return vncPasswordPattern.MatchString(password)
+}
@@ -0,0 +1,180 @@
+package desktop
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// maxAVISize keeps recordings below the 4 GiB limit of RIFF files, with
+// room for the index
+const maxAVISize = 3800 << 20
+
+// errAVIFull is returned when a frame would grow a recording past maxAVISize
+var errAVIFull = errors.New("recording reached the maximum file size")
+
+// Offsets of the header fields patched when an AVI file is closed
+const (
+	aviRIFFSize       = 4
+	aviTotalFrames    = 48
+	aviStreamLength   = 140
+	aviMoviSize       = 216
+	aviMoviFourCC     = 220
+	aviHeaderSize     = 224
+	aviIndexEntrySize = 16
+)
+
+// aviWriter writes Motion JPEG video to an AVI file, which common players
+// and ffmpeg read without conversion. Frames are written as they come and
+// the headers are completed on close.
+type aviWriter struct {
+	f     *os.File
+	size  int64  // Bytes written so far
+	index []byte // idx1 entries
+	count int
+}
+
+// newAVIWriter creates an AVI file for frames of the given size and rate
+func newAVIWriter(name string, width, height, fps int) (*aviWriter, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	h := make([]byte, 0, aviHeaderSize)
+	h = append(h, "RIFF\x00\x00\x00\x00AVI "...)
+	h = append(h, "LIST"...)
+	h = le32(h, 192) // hdrl
+	h = append(h, "hdrl"...)
+
+	h = append(h, "avih"...)
+	h = le32(h, 56)
+	h = le32(h, uint32(1000000/fps)) // Microseconds per frame
+	h = le32(h, 0)                   // Max bytes per second
+	h = le32(h, 0)                   // Padding granularity
+	h = le32(h, 0x10)                // AVIF_HASINDEX
+	h = le32(h, 0)                   // Total frames, patched on close
+	h = le32(h, 0)                   // Initial frames
+	h = le32(h, 1)                   // Streams
+	h = le32(h, 0)                   // Suggested buffer size
+	h = le32(h, uint32(width))
+	h = le32(h, uint32(height))
+	h = append(h, make([]byte, 16)...)
+
+	h = append(h, "LIST"...)
+	h = le32(h, 116) // strl
+	h = append(h, "strl"...)
+	h = append(h, "strh"...)
+	h = le32(h, 56)
+	h = append(h, "vidsMJPG"...)
+	h = le32(h, 0) // Flags
+	h = le32(h, 0) // Priority and language
+	h = le32(h, 0) // Initial frames
+	h = le32(h, 1) // Scale
+	h = le32(h, uint32(fps))
+	h = le32(h, 0)          // Start
+	h = le32(h, 0)          // Length, patched on close
+	h = le32(h, 0)          // Suggested buffer size
+	h = le32(h, 0xffffffff) // Default quality
+	h = le32(h, 0)          // Sample size
+	h = le16(h, 0)
+	h = le16(h, 0)
+	h = le16(h, uint16(width))
+	h = le16(h, uint16(height))
+
+	h = append(h, "strf"...)
+	h = le32(h, 40)
+	h = le32(h, 40) // BITMAPINFOHEADER size
+	h = le32(h, uint32(width))
+	h = le32(h, uint32(height))
+	h = le16(h, 1)  // Planes
+	h = le16(h, 24) // Bits per pixel
+	h = append(h, "MJPG"...)
+	h = le32(h, uint32(width*height*3))
+	h = append(h, make([]byte, 16)...)
+
+	h = append(h, "LIST\x00\x00\x00\x00movi"...)
+
+	if _, err := f.Write(h); err != nil {
+		f.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	return &aviWriter{f: f, size: int64(len(h))}, nil
+}
+
+// WriteFrame appends one JPEG image
+func (a *aviWriter) WriteFrame(jpeg []byte) error {
+	padded := int64(len(jpeg) + len(jpeg)%2)
+	if a.size+8+padded+int64(len(a.index))+aviIndexEntrySize+8 > maxAVISize {
+		return errAVIFull
+	}
+
+	chunk := make([]byte, 0, 8+padded)
+	chunk = append(chunk, "00dc"...)
+	chunk = le32(chunk, uint32(len(jpeg)))
+	chunk = append(chunk, jpeg...)
+	if len(jpeg)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	if _, err := a.f.Write(chunk); err != nil {
+		return err
+	}
+
+	a.index = append(a.index, "00dc"...)
+	a.index = le32(a.index, 0x10) // AVIIF_KEYFRAME
+	a.index = le32(a.index, uint32(a.size-aviMoviFourCC))
+	a.index = le32(a.index, uint32(len(jpeg)))
+	a.size += int64(len(chunk))
+	a.count++
+	return nil
+}
+
+// Frames returns the number of frames written
+func (a *aviWriter) Frames() int {
+	return a.count
+}
+
+// Size returns the size of the file so far
+func (a *aviWriter) Size() int64 {
+	return a.size
+}
+
+// Close writes the index, completes the headers and closes the file
+func (a *aviWriter) Close() error {
+	moviSize := a.size - aviMoviFourCC
+	index := append([]byte("idx1"), binary.LittleEndian.AppendUint32(nil, uint32(len(a.index)))...)
+	index = append(index, a.index...)
+	_, err := a.f.Write(index)
+	a.size += int64(len(index))
+
+	for _, field := range []struct {
+		offset int64
+		value  uint32
+	}{
+		{aviRIFFSize, uint32(a.size - 8)},
+		{aviTotalFrames, uint32(a.count)},
+		{aviStreamLength, uint32(a.count)},
+		{aviMoviSize, uint32(moviSize)},
+	} {
+		if err != nil {
+			break
+		}
+		_, err = a.f.WriteAt(binary.LittleEndian.AppendUint32(nil, field.value), field.offset)
+	}
+	if err == nil {
+		err = a.f.Sync()
+	}
+	if closeErr := a.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func le32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func le16(b []byte, v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(b, v)
+}
@@ -0,0 +1,39 @@
+package desktop
+
+import (
+	"fmt"
+	"time"
+)
+
+// clipboardTimeout bounds the wait for the clipboard of a session. Servers
+// may not answer at all when nothing was copied.
+const clipboardTimeout = 2 * time.Second
+
+// Clipboard returns the text clipboard of a session's desktop
+func (m *Manager) Clipboard(sessionID string) (string, error) {
+	s, client, err := m.client(sessionID)
+	if err != nil {
+		return "", err
+	}
+	text, err := client.Clipboard(clipboardTimeout)
+	if err != nil {
+		m.disconnect(s, client)
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return text, nil
+}
+
+// SetClipboard makes text the clipboard of a session's desktop. Pasting
+// reads it from the orchestrator's connection, which is therefore kept open
+// until something else is copied on the desktop.
+func (m *Manager) SetClipboard(sessionID, text string) error {
+	s, client, err := m.client(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := client.SetClipboard(text); err != nil {
+		m.disconnect(s, client)
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return nil
+}
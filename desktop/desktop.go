@@ -0,0 +1,169 @@
+// Package desktop drives the desktops of sessions through VNC connections
+// of the orchestrator's own. Connections are opened on first use, shared by
+// every caller of a session and closed once idle.
+package desktop
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/rfb"
+)
+
+// ErrUnavailable is returned when the VNC server of a session cannot be used
+var ErrUnavailable = errors.New("desktop unavailable")
+
+// Targets resolves sessions to the address and password of their VNC server
+type Targets interface {
+	VNCTarget(id string) (string, string, error)
+	SessionReady(id string) bool
+}
+
+// Manager keeps one VNC connection per session in use
+type Manager struct {
+	targets Targets
+	cfg     config.DesktopConfig
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	recorders map[string]*recorder // Active recordings by session
+}
+
+// session is the connection to the desktop of one session
+type session struct {
+	id string
+
+	mu       sync.Mutex // Guards dialing and client
+	client   *rfb.Client
+	lastUsed time.Time
+	closed   bool // Dropped by closeIdle, users look the session up again
+
+	shots screenshotCache
+
+	input   sync.Mutex  // Serialises input, guards pointer
+	pointer image.Point // Last position sent
+}
+
+// NewManager returns a manager resolving sessions through targets
+func NewManager(targets Targets, cfg config.DesktopConfig) *Manager {
+	m := &Manager{
+		targets:   targets,
+		cfg:       cfg,
+		sessions:  make(map[string]*session),
+		recorders: make(map[string]*recorder),
+	}
+	go m.closeIdle()
+	if cfg.Recording.Retention > 0 {
+		go m.pruneRecordings()
+	}
+	return m
+}
+
+// client returns the entry of a session and its open connection, dialing
+// it when there is none or the last one failed
+func (m *Manager) client(id string) (*session, *rfb.Client, error) {
+	for {
+		m.mu.Lock()
+		s, ok := m.sessions[id]
+		if !ok {
+			s = &session{id: id}
+			m.sessions[id] = s
+		}
+		m.mu.Unlock()
+
+		client, err := m.connect(s)
+		if err != errSessionClosed {
+			return s, client, err
+		}
+	}
+}
+
+// errSessionClosed is returned by connect for entries dropped by closeIdle
+var errSessionClosed = errors.New("desktop session closed")
+
+func (m *Manager) connect(s *session) (*rfb.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errSessionClosed
+	}
+	s.lastUsed = time.Now()
+	if s.client != nil {
+		select {
+		case <-s.client.Done():
+			log.Printf("VNC connection to session %s ended: %v", s.id, s.client.Err())
+			s.client = nil
+		default:
+			return s.client, nil
+		}
+	}
+
+	addr, password, err := m.targets.VNCTarget(s.id)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	client, err := rfb.NewClient(conn, password)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	s.client = client
+	return client, nil
+}
+
+// disconnect drops a connection that misbehaved, the next use dials again
+func (m *Manager) disconnect(s *session, client *rfb.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		s.client = nil
+	}
+	client.Close()
+}
+
+// closeIdle closes connections that were not used for the idle timeout,
+// and those of sessions that ended
+func (m *Manager) closeIdle() {
+	ticker := time.NewTicker(m.cfg.IdleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mu.Lock()
+		for id, s := range m.sessions {
+			// A busy session is not idle
+			if !s.mu.TryLock() {
+				continue
+			}
+			// Closing the connection would clear a clipboard set through
+			// it, unless the connection has already ended
+			owner := false
+			if s.client != nil {
+				select {
+				case <-s.client.Done():
+				default:
+					owner = s.client.OwnsClipboard()
+				}
+			}
+			idle := time.Since(s.lastUsed) > m.cfg.IdleTimeout && !owner
+			if idle || !m.targets.SessionReady(id) {
+				if s.client != nil {
+					s.client.Close()
+				}
+				s.closed = true
+				delete(m.sessions, id)
+			}
+			s.mu.Unlock()
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,250 @@
+package desktop
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/rfb"
+)
+
+// ErrInvalidInput is returned when an input action cannot be performed on
+// the desktop of a session, e.g. a position outside the screen
+var ErrInvalidInput = errors.New("invalid input")
+
+// dragSteps is the number of pointer moves a drag is split into, so
+// applications see the pointer travel
+const dragSteps = 10
+
+// dragStepDelay separates the moves of a drag
+const dragStepDelay = 10 * time.Millisecond
+
+// Input action types
+const (
+	ActionMove        = "move"
+	ActionClick       = "click"
+	ActionDoubleClick = "double_click"
+	ActionDrag        = "drag"
+	ActionScroll      = "scroll"
+	ActionKey         = "key"
+	ActionType        = "type"
+)
+
+// Action is one step of input sent to the desktop of a session
+type Action struct {
+	// move, click, double_click, drag, scroll, key or type
+	// @example click
+	Type string `json:"type"`
+	// Pointer position for move, click, double_click and scroll, and the
+	// start of a drag. The current position when omitted.
+	// @example 640
+	X *int `json:"x,omitempty"`
+	// @example 360
+	Y *int `json:"y,omitempty"`
+	// End of a drag
+	ToX *int `json:"to_x,omitempty"`
+	ToY *int `json:"to_y,omitempty"`
+	// left, middle or right, left when empty
+	// @example left
+	Button string `json:"button,omitempty"`
+	// Wheel clicks of a scroll, positive to the right and down
+	// @example 3
+	ScrollX int `json:"scroll_x,omitempty"`
+	ScrollY int `json:"scroll_y,omitempty"`
+	// Key or combination of a key action, e.g. Enter or ctrl+shift+t
+	// @example ctrl+c
+	Key string `json:"key,omitempty"`
+	// Text of a type action
+	Text string `json:"text,omitempty"`
+}
+
+// InputResult reports the input performed on a desktop
+type InputResult struct {
+	Actions int `json:"actions"` // Number of actions performed
+	X       int `json:"x"`       // Pointer position afterwards
+	Y       int `json:"y"`
+}
+
+// buttonMasks maps button names to their bit in pointer events
+var buttonMasks = map[string]uint8{
+	"":       rfb.ButtonLeft,
+	"left":   rfb.ButtonLeft,
+	"middle": rfb.ButtonMiddle,
+	"right":  rfb.ButtonRight,
+}
+
+// ButtonMask returns the pointer event mask of a button name
+func ButtonMask(name string) (uint8, bool) {
+	mask, ok := buttonMasks[name]
+	return mask, ok
+}
+
+// Input performs actions in order on the desktop of a session. Input of
+// concurrent calls is not interleaved. When an action fails, the ones
+// before it have been performed.
+func (m *Manager) Input(sessionID string, actions []Action) (*InputResult, error) {
+	s, client, err := m.client(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.input.Lock()
+	defer s.input.Unlock()
+	width, height := client.Size()
+	for i, action := range actions {
+		if err := m.perform(s, client, action, width, height); err != nil {
+			if !errors.Is(err, ErrInvalidInput) {
+				m.disconnect(s, client)
+				err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+			return nil, fmt.Errorf("actions[%d]: %w", i, err)
+		}
+	}
+	return &InputResult{Actions: len(actions), X: s.pointer.X, Y: s.pointer.Y}, nil
+}
+
+// perform sends the events of one action
+func (m *Manager) perform(s *session, client *rfb.Client, action Action, width, height int) error {
+	position := func(x, y *int) (int, int, error) {
+		px, py := s.pointer.X, s.pointer.Y
+		if x != nil {
+			px = *x
+		}
+		if y != nil {
+			py = *y
+		}
+		if px < 0 || py < 0 || px >= width || py >= height {
+			return 0, 0, fmt.Errorf("%w: %d,%d is outside the %dx%d screen", ErrInvalidInput, px, py, width, height)
+		}
+		return px, py, nil
+	}
+	move := func(x, y int, buttons uint8) error {
+		if err := client.PointerEvent(buttons, x, y); err != nil {
+			return err
+		}
+		s.pointer = image.Pt(x, y)
+		return nil
+	}
+	click := func(x, y int, buttons uint8) error {
+		if err := move(x, y, buttons); err != nil {
+			return err
+		}
+		return move(x, y, 0)
+	}
+
+	switch action.Type {
+	case ActionMove:
+		x, y, err := position(action.X, action.Y)
+		if err != nil {
+			return err
+		}
+		return move(x, y, 0)
+
+	case ActionClick, ActionDoubleClick:
+		button, ok := ButtonMask(action.Button)
+		if !ok {
+			return fmt.Errorf("%w: unknown button %q", ErrInvalidInput, action.Button)
+		}
+		x, y, err := position(action.X, action.Y)
+		if err != nil {
+			return err
+		}
+		if err := move(x, y, 0); err != nil {
+			return err
+		}
+		if err := click(x, y, button); err != nil {
+			return err
+		}
+		if action.Type == ActionDoubleClick {
+			return click(x, y, button)
+		}
+		return nil
+
+	case ActionDrag:
+		button, ok := ButtonMask(action.Button)
+		if !ok {
+			return fmt.Errorf("%w: unknown button %q", ErrInvalidInput, action.Button)
+		}
+		fromX, fromY, err := position(action.X, action.Y)
+		if err != nil {
+			return err
+		}
+		toX, toY, err := position(action.ToX, action.ToY)
+		if err != nil {
+			return err
+		}
+		if err := move(fromX, fromY, 0); err != nil {
+			return err
+		}
+		if err := move(fromX, fromY, button); err != nil {
+			return err
+		}
+		for step := 1; step <= dragSteps; step++ {
+			time.Sleep(dragStepDelay)
+			x := fromX + (toX-fromX)*step/dragSteps
+			y := fromY + (toY-fromY)*step/dragSteps
+			if err := move(x, y, button); err != nil {
+				return err
+			}
+		}
+		return move(toX, toY, 0)
+
+	case ActionScroll:
+		x, y, err := position(action.X, action.Y)
+		if err != nil {
+			return err
+		}
+		if err := move(x, y, 0); err != nil {
+			return err
+		}
+		for _, wheel := range []struct {
+			clicks             int
+			negative, positive uint8
+		}{
+			{action.ScrollY, rfb.ButtonWheelUp, rfb.ButtonWheelDown},
+			{action.ScrollX, rfb.ButtonWheelLeft, rfb.ButtonWheelRight},
+		} {
+			button, clicks := wheel.positive, wheel.clicks
+			if clicks < 0 {
+				button, clicks = wheel.negative, -clicks
+			}
+			for i := 0; i < clicks; i++ {
+				if err := click(x, y, button); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case ActionKey:
+		syms, err := ParseKeys(action.Key)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		for _, sym := range syms {
+			if err := client.KeyEvent(sym, true); err != nil {
+				return err
+			}
+		}
+		for i := len(syms) - 1; i >= 0; i-- {
+			if err := client.KeyEvent(syms[i], false); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ActionType:
+		for _, r := range action.Text {
+			sym := runeKeysym(r)
+			if err := client.KeyEvent(sym, true); err != nil {
+				return err
+			}
+			if err := client.KeyEvent(sym, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown action type %q", ErrInvalidInput, action.Type)
+}
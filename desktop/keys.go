@@ -0,0 +1,103 @@
+package desktop
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keysyms names the X keysyms of keys that are not characters. Names are
+// matched case-insensitively, the common aliases of agents and xdotool are
+// included.
+var keysyms = map[string]uint32{
+	"backspace":   0xff08,
+	"tab":         0xff09,
+	"enter":       0xff0d,
+	"return":      0xff0d,
+	"pause":       0xff13,
+	"escape":      0xff1b,
+	"esc":         0xff1b,
+	"delete":      0xffff,
+	"del":         0xffff,
+	"home":        0xff50,
+	"left":        0xff51,
+	"up":          0xff52,
+	"right":       0xff53,
+	"down":        0xff54,
+	"pageup":      0xff55,
+	"page_up":     0xff55,
+	"pagedown":    0xff56,
+	"page_down":   0xff56,
+	"end":         0xff57,
+	"insert":      0xff63,
+	"menu":        0xff67,
+	"printscreen": 0xff61,
+	"print":       0xff61,
+	"capslock":    0xffe5,
+	"space":       0x0020,
+	"plus":        0x002b,
+	"minus":       0x002d,
+
+	"shift":   0xffe1,
+	"ctrl":    0xffe3,
+	"control": 0xffe3,
+	"alt":     0xffe9,
+	"super":   0xffeb,
+	"meta":    0xffeb,
+	"win":     0xffeb,
+	"cmd":     0xffeb,
+}
+
+func init() {
+	for i := uint32(1); i <= 12; i++ {
+		keysyms[fmt.Sprintf("f%d", i)] = 0xffbd + i
+	}
+}
+
+// ParseKeys parses a key or a combination of keys joined with +, such as
+// Enter, ctrl+c or ctrl+shift+t, into the keysyms to press in order
+func ParseKeys(combo string) ([]uint32, error) {
+	if combo == "" {
+		return nil, fmt.Errorf("no key")
+	}
+	names := strings.Split(combo, "+")
+	if combo == "+" {
+		names = []string{"+"}
+	}
+	syms := make([]uint32, 0, len(names))
+	for _, name := range names {
+		sym, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		syms = append(syms, sym)
+	}
+	return syms, nil
+}
+
+// parseKey returns the keysym of a key name or of a single character
+func parseKey(name string) (uint32, error) {
+	if sym, ok := keysyms[strings.ToLower(name)]; ok {
+		return sym, nil
+	}
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r != utf8.RuneError && unicode.IsPrint(r) {
+		return runeKeysym(unicode.ToLower(r)), nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// runeKeysym returns the keysym typing a character. Latin-1 characters are
+// their own keysym, the rest of Unicode is offset by 0x01000000.
+func runeKeysym(r rune) uint32 {
+	switch r {
+	case '\n':
+		return keysyms["enter"]
+	case '\t':
+		return keysyms["tab"]
+	}
+	if r < 0x100 {
+		return uint32(r)
+	}
+	return 0x01000000 | uint32(r)
+}
@@ -0,0 +1,457 @@
+package desktop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/rfb"
+)
+
+// ErrNoRecording is returned for recordings that do not exist
+var ErrNoRecording = errors.New("recording not found")
+
+// ErrRecordingInProgress is returned when a session is already recorded, or
+// when a recording is downloaded before it was stopped
+var ErrRecordingInProgress = errors.New("recording in progress")
+
+// Recording states
+const (
+	RecordingActive      = "recording"
+	RecordingCompleted   = "completed"
+	RecordingFailed      = "failed"
+	RecordingInterrupted = "interrupted" // The orchestrator stopped while recording
+)
+
+// recordingIDLayout names recordings after their start, so they sort in order
+const recordingIDLayout = "20060102T150405.000Z"
+
+// recordingRetry bounds how long a recording waits for a session's VNC server
+const recordingRetry = 2 * time.Minute
+
+// sessionIDPattern matches session IDs that are safe as directory names
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Recording describes a video of a session's desktop
+type Recording struct {
+	ID        string     `json:"id"`
+	Session   string     `json:"session"`
+	Owner     string     `json:"owner,omitempty"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Status    string     `json:"status"`            // recording, completed, failed or interrupted
+	Message   string     `json:"message,omitempty"` // Why the recording ended
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	FrameRate int        `json:"frame_rate"`
+	Frames    int        `json:"frames"`
+	Size      int64      `json:"size"` // Bytes
+}
+
+// recorder writes the video of one session until it is stopped or the
+// session ends
+type recorder struct {
+	mu  sync.Mutex // Guards rec
+	rec Recording
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (r *recorder) snapshot() Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rec
+}
+
+// sessionDir returns the directory holding the recordings of a session
+func (m *Manager) sessionDir(sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("%w: invalid session ID %q", ErrNoRecording, sessionID)
+	}
+	return filepath.Join(m.cfg.Recording.Directory, sessionID), nil
+}
+
+// StartRecording starts recording the desktop of a ready session. The
+// recording runs until StopRecording is called or the session ends.
+func (m *Manager) StartRecording(sessionID, owner, tenant string) (*Recording, error) {
+	dir, err := m.sessionDir(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{stop: make(chan struct{}), done: make(chan struct{})}
+	m.mu.Lock()
+	if _, ok := m.recorders[sessionID]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: session %s is already recorded", ErrRecordingInProgress, sessionID)
+	}
+	m.recorders[sessionID] = r
+	m.mu.Unlock()
+
+	avi, client, first, err := m.openRecording(r, sessionID, owner, tenant, dir)
+	if err != nil {
+		m.mu.Lock()
+		delete(m.recorders, sessionID)
+		m.mu.Unlock()
+		close(r.done)
+		return nil, err
+	}
+	go m.record(r, dir, avi, client, first)
+	rec := r.snapshot()
+	return &rec, nil
+}
+
+// openRecording captures the first frame of a session and creates its video
+func (m *Manager) openRecording(r *recorder, sessionID, owner, tenant, dir string) (*aviWriter, *rfb.Client, *image.RGBA, error) {
+	s, client, err := m.client(sessionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	first, err := client.Capture(captureTimeout)
+	if err != nil {
+		m.disconnect(s, client)
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	startedAt := time.Now().UTC()
+	r.mu.Lock()
+	r.rec = Recording{
+		ID:        startedAt.Format(recordingIDLayout),
+		Session:   sessionID,
+		Owner:     owner,
+		Tenant:    tenant,
+		Status:    RecordingActive,
+		StartedAt: startedAt,
+		Width:     first.Rect.Dx(),
+		Height:    first.Rect.Dy(),
+		FrameRate: m.cfg.Recording.FrameRate,
+	}
+	rec := r.rec
+	r.mu.Unlock()
+
+	avi, err := newAVIWriter(filepath.Join(dir, rec.ID+".avi"), rec.Width, rec.Height, rec.FrameRate)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create recording: %v", err)
+	}
+	if err := writeRecording(dir, rec); err != nil {
+		avi.Close()
+		os.Remove(filepath.Join(dir, rec.ID+".avi"))
+		return nil, nil, nil, err
+	}
+	return avi, client, first, nil
+}
+
+// record writes frames at the configured rate. Frames are taken from the
+// mirrored framebuffer, which incremental updates keep current; when it did
+// not change, the previous frame is repeated. Missed ticks are filled with
+// the last frame, so the video keeps the pace of the session.
+func (m *Manager) record(r *recorder, dir string, avi *aviWriter, client *rfb.Client, first *image.RGBA) {
+	rec := r.snapshot()
+	fps := rec.FrameRate
+	bounds := image.Rect(0, 0, rec.Width, rec.Height)
+	updates := client.Updates()
+	frame, err := m.encodeFrame(first, bounds)
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+	sessionEnded := false
+	lastSeen := time.Now()
+	for err == nil {
+		due := int(time.Since(rec.StartedAt)*time.Duration(fps)/time.Second) + 1
+		for avi.Frames() < due && err == nil {
+			err = avi.WriteFrame(frame)
+		}
+		if err != nil {
+			break
+		}
+		r.mu.Lock()
+		r.rec.Frames, r.rec.Size = avi.Frames(), avi.Size()
+		r.mu.Unlock()
+
+		select {
+		case <-r.stop:
+			err = errStopped
+			continue
+		case <-ticker.C:
+		}
+
+		s, current, connectErr := m.client(rec.Session)
+		if connectErr != nil {
+			if !errors.Is(connectErr, ErrUnavailable) {
+				err, sessionEnded = connectErr, true
+			} else if time.Since(lastSeen) > recordingRetry {
+				err = connectErr
+			}
+			continue
+		}
+		if current != client {
+			// The connection was dialed again, the mirror starts empty
+			img, captureErr := current.Capture(captureTimeout)
+			if captureErr != nil {
+				m.disconnect(s, current)
+				continue
+			}
+			client, updates = current, current.Updates()
+			frame, err = m.encodeFrame(img, bounds)
+		} else if n := client.Updates(); n != updates {
+			updates = n
+			frame, err = m.encodeFrame(client.Framebuffer(), bounds)
+		}
+		lastSeen = time.Now()
+		if err == nil {
+			width, height := client.Size()
+			client.RequestUpdate(true, 0, 0, width, height)
+		}
+	}
+
+	status, message := RecordingCompleted, "stopped"
+	switch {
+	case err == errStopped:
+	case sessionEnded:
+		message = "session ended"
+	case errors.Is(err, errAVIFull):
+		message = err.Error()
+	default:
+		status, message = RecordingFailed, err.Error()
+		log.Printf("Recording %s of session %s failed: %v", rec.ID, rec.Session, err)
+	}
+	closeErr := avi.Close()
+	if closeErr != nil && status != RecordingFailed {
+		status, message = RecordingFailed, closeErr.Error()
+		log.Printf("Error closing recording %s of session %s: %v", rec.ID, rec.Session, closeErr)
+	}
+
+	endedAt := time.Now().UTC()
+	r.mu.Lock()
+	r.rec.Status, r.rec.Message, r.rec.EndedAt = status, message, &endedAt
+	r.rec.Frames, r.rec.Size = avi.Frames(), avi.Size()
+	final := r.rec
+	r.mu.Unlock()
+	if err := writeRecording(dir, final); err != nil {
+		log.Printf("Error saving recording %s of session %s: %v", final.ID, final.Session, err)
+	}
+
+	m.mu.Lock()
+	delete(m.recorders, final.Session)
+	m.mu.Unlock()
+	close(r.done)
+}
+
+// errStopped ends a recording stopped through StopRecording
+var errStopped = errors.New("stopped")
+
+// encodeFrame encodes a framebuffer as a frame of a recording. Frames keep
+// the size the recording started with, the desktop is cropped or padded
+// when it was resized.
+func (m *Manager) encodeFrame(img *image.RGBA, bounds image.Rectangle) ([]byte, error) {
+	if img.Rect != bounds {
+		canvas := image.NewRGBA(bounds)
+		draw.Draw(canvas, bounds, image.Black, image.Point{}, draw.Src)
+		draw.Draw(canvas, bounds, img, image.Point{}, draw.Src)
+		img = canvas
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: m.cfg.Recording.Quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode frame: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// StopRecording stops the recording of a session and returns it once the
+// video is complete
+func (m *Manager) StopRecording(sessionID string) (*Recording, error) {
+	m.mu.Lock()
+	r, ok := m.recorders[sessionID]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: session %s is not recorded", ErrNoRecording, sessionID)
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+	rec := r.snapshot()
+	return &rec, nil
+}
+
+// RecordNewSession records a session from the moment it became ready. Its
+// VNC server may still be starting, so connecting is retried for a while.
+func (m *Manager) RecordNewSession(sessionID, owner, tenant string) {
+	deadline := time.Now().Add(recordingRetry)
+	for {
+		rec, err := m.StartRecording(sessionID, owner, tenant)
+		if err == nil {
+			log.Printf("Recording %s of session %s started", rec.ID, sessionID)
+			return
+		}
+		if !errors.Is(err, ErrUnavailable) || time.Now().After(deadline) {
+			log.Printf("Error starting recording of session %s: %v", sessionID, err)
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// Recordings lists the recordings of a session, oldest first
+func (m *Manager) Recordings(sessionID string) ([]Recording, error) {
+	dir, err := m.sessionDir(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Recording{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %v", err)
+	}
+
+	m.mu.Lock()
+	active := m.recorders[sessionID]
+	m.mu.Unlock()
+	recordings := []Recording{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		rec, err := m.recording(dir, id, active)
+		if err != nil {
+			log.Printf("Error reading recording %s of session %s: %v", id, sessionID, err)
+			continue
+		}
+		recordings = append(recordings, *rec)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].ID < recordings[j].ID })
+	return recordings, nil
+}
+
+// recording reads the description of a recording, or takes it from the
+// recorder writing it
+func (m *Manager) recording(dir, id string, active *recorder) (*Recording, error) {
+	if active != nil {
+		if rec := active.snapshot(); rec.ID == id {
+			return &rec, nil
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var rec Recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Status == RecordingActive {
+		// Written by an earlier run of the orchestrator, the video has no index
+		rec.Status, rec.Message = RecordingInterrupted, "the orchestrator stopped while recording"
+	}
+	return &rec, nil
+}
+
+// OpenRecording opens the video of a finished recording
+func (m *Manager) OpenRecording(sessionID, id string) (*os.File, *Recording, error) {
+	dir, err := m.sessionDir(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := time.Parse(recordingIDLayout, id); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoRecording, id)
+	}
+	m.mu.Lock()
+	active := m.recorders[sessionID]
+	m.mu.Unlock()
+	rec, err := m.recording(dir, id, active)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoRecording, id)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read recording %s: %v", id, err)
+	}
+	if rec.Status == RecordingActive {
+		return nil, nil, fmt.Errorf("%w: stop recording %s before downloading it", ErrRecordingInProgress, id)
+	}
+	f, err := os.Open(filepath.Join(dir, id+".avi"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoRecording, id)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open recording %s: %v", id, err)
+	}
+	return f, rec, nil
+}
+
+// writeRecording saves the description of a recording next to its video
+func writeRecording(dir string, rec Recording) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, rec.ID+".json")
+	if err := os.WriteFile(name+".tmp", data, 0o640); err != nil {
+		return fmt.Errorf("failed to save recording: %v", err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("failed to save recording: %v", err)
+	}
+	return nil
+}
+
+// pruneRecordings deletes recordings that ended longer than the retention ago
+func (m *Manager) pruneRecordings() {
+	interval := min(m.cfg.Recording.Retention/2, time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sessions, err := os.ReadDir(m.cfg.Recording.Directory)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Error listing recordings: %v", err)
+			}
+			continue
+		}
+		cutoff := time.Now().Add(-m.cfg.Recording.Retention)
+		for _, session := range sessions {
+			if !session.IsDir() {
+				continue
+			}
+			recordings, err := m.Recordings(session.Name())
+			if err != nil {
+				continue
+			}
+			dir := filepath.Join(m.cfg.Recording.Directory, session.Name())
+			for _, rec := range recordings {
+				ended := rec.StartedAt
+				if rec.EndedAt != nil {
+					ended = *rec.EndedAt
+				}
+				if rec.Status == RecordingActive || ended.After(cutoff) {
+					continue
+				}
+				os.Remove(filepath.Join(dir, rec.ID+".avi"))
+				if err := os.Remove(filepath.Join(dir, rec.ID+".json")); err != nil {
+					log.Printf("Error deleting recording %s of session %s: %v", rec.ID, rec.Session, err)
+					continue
+				}
+				log.Printf("Deleted recording %s of session %s after the retention period", rec.ID, rec.Session)
+			}
+			// Fails while the directory holds recordings
+			os.Remove(dir)
+		}
+	}
+}
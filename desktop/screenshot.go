@@ -0,0 +1,127 @@
+package desktop
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"sync"
+	"time"
+)
+
+// captureTimeout bounds the wait for the framebuffer of a session
+const captureTimeout = 10 * time.Second
+
+// ScreenshotOptions selects the encoding of a screenshot
+type ScreenshotOptions struct {
+	Format  string  // png or jpeg
+	Scale   float64 // Factor in (0, 1], 1 keeps the size of the display
+	Quality int     // JPEG quality from 1 to 100
+}
+
+// Screenshot is an encoded capture of a session's display
+type Screenshot struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	CapturedAt  time.Time
+}
+
+// screenshotCache keeps the last capture of a session and its encodings,
+// so clients polling the display share one framebuffer request
+type screenshotCache struct {
+	mu         sync.Mutex
+	image      *image.RGBA
+	capturedAt time.Time
+	encoded    map[ScreenshotOptions]*Screenshot
+}
+
+// Screenshot captures the display of a session. Captures younger than the
+// configured cache TTL are reused.
+func (m *Manager) Screenshot(sessionID string, opts ScreenshotOptions) (*Screenshot, error) {
+	s, client, err := m.client(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &s.shots
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.image == nil || time.Since(cache.capturedAt) >= m.cfg.ScreenshotCacheTTL {
+		img, err := client.Capture(captureTimeout)
+		if err != nil {
+			m.disconnect(s, client)
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		cache.image, cache.capturedAt = img, time.Now()
+		cache.encoded = make(map[ScreenshotOptions]*Screenshot)
+	}
+	if shot, ok := cache.encoded[opts]; ok {
+		return shot, nil
+	}
+
+	shot, err := encode(cache.image, opts)
+	if err != nil {
+		return nil, err
+	}
+	shot.CapturedAt = cache.capturedAt
+	cache.encoded[opts] = shot
+	return shot, nil
+}
+
+// encode scales and encodes a capture
+func encode(img *image.RGBA, opts ScreenshotOptions) (*Screenshot, error) {
+	if opts.Scale > 0 && opts.Scale < 1 {
+		img = downscale(img, opts.Scale)
+	}
+
+	var b bytes.Buffer
+	shot := &Screenshot{Width: img.Rect.Dx(), Height: img.Rect.Dy()}
+	switch opts.Format {
+	case "jpeg":
+		shot.ContentType = "image/jpeg"
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode screenshot: %v", err)
+		}
+	default:
+		shot.ContentType = "image/png"
+		encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+		if err := encoder.Encode(&b, img); err != nil {
+			return nil, fmt.Errorf("failed to encode screenshot: %v", err)
+		}
+	}
+	shot.Data = b.Bytes()
+	return shot, nil
+}
+
+// downscale shrinks an image by averaging the source pixels covered by
+// every target pixel
+func downscale(src *image.RGBA, scale float64) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw := int(math.Max(1, math.Round(float64(sw)*scale)))
+	dh := int(math.Max(1, math.Round(float64(sh)*scale)))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,211 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// batchRetention is how long a batch is remembered once none of its sessions is tracked any more
+const batchRetention = time.Hour
+
+// Batch groups the sessions created by one batch request
+type Batch struct {
+	ID          string            `json:"batch_id"`
+	Owner       string            `json:"owner,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	TrackingIDs []string          `json:"tracking_ids"`
+}
+
+// BatchStatus aggregates the statuses of the sessions of a batch
+type BatchStatus struct {
+	Batch
+	// in_progress while sessions are queued or starting, then ready,
+	// partially_ready, failed or terminated
+	Status string `json:"status"`
+	// Sessions per status; sessions no longer tracked count as terminated
+	Counts   map[string]int     `json:"counts"`
+	Sessions []*ContainerStatus `json:"sessions"`
+}
+
+type batchStore struct {
+	sync.Mutex
+	batches map[string]*Batch
+	idle    map[string]time.Time // Batches without tracked sessions, since when
+}
+
+func newBatchStore() *batchStore {
+	return &batchStore{batches: make(map[string]*Batch), idle: make(map[string]time.Time)}
+}
+
+// CreateBatch queues the creation of several sessions under one batch ID.
+// Every session goes through CreateContainerAsync, so quotas, capacity and
+// the queue apply to each one; the error of a session that could not be
+// queued is returned at its index. The batch labels are added to every
+// session. No batch is recorded if no session could be queued.
+func (dm *DockerManager) CreateBatch(owner, tenant string, labels map[string]string, configs []ContainerConfig) (*Batch, []error) {
+	batch := &Batch{
+		ID:        utils.GenerateID()[:12],
+		Owner:     owner,
+		Tenant:    tenant,
+		Labels:    labels,
+		CreatedAt: time.Now(),
+	}
+	errs := make([]error, len(configs))
+	if err := ValidateLabels(labels); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return nil, errs
+	}
+
+	for i, cfg := range configs {
+		cfg.Owner, cfg.Tenant, cfg.BatchID = owner, tenant, batch.ID
+		cfg.Labels = mergeLabels(cfg.Labels, labels)
+		trackingID, err := dm.CreateContainerAsync(cfg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		batch.TrackingIDs = append(batch.TrackingIDs, trackingID)
+	}
+	if len(batch.TrackingIDs) == 0 {
+		return nil, errs
+	}
+
+	dm.batches.Lock()
+	dm.pruneBatches()
+	dm.batches.batches[batch.ID] = batch
+	dm.batches.Unlock()
+	log.Printf("Queued batch %s with %d of %d sessions", batch.ID, len(batch.TrackingIDs), len(configs))
+	return batch, errs
+}
+
+// GetBatch returns a copy of a batch, or nil if it is unknown
+func (dm *DockerManager) GetBatch(id string) *Batch {
+	dm.batches.Lock()
+	defer dm.batches.Unlock()
+	batch, ok := dm.batches.batches[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *batch
+	snapshot.TrackingIDs = append([]string(nil), batch.TrackingIDs...)
+	return &snapshot
+}
+
+// GetBatchStatus returns the aggregated status of a batch
+func (dm *DockerManager) GetBatchStatus(id string) (*BatchStatus, error) {
+	batch := dm.GetBatch(id)
+	if batch == nil {
+		return nil, fmt.Errorf("%w: batch %s", ErrNotFound, id)
+	}
+
+	status := &BatchStatus{Batch: *batch, Counts: map[string]int{}, Sessions: []*ContainerStatus{}}
+	for _, trackingID := range batch.TrackingIDs {
+		session := dm.GetContainerStatus(trackingID)
+		if session == nil {
+			status.Counts["terminated"]++
+			continue
+		}
+		status.Counts[session.Status]++
+		status.Sessions = append(status.Sessions, session)
+	}
+
+	counts := status.Counts
+	switch {
+	case counts["terminated"] == len(batch.TrackingIDs):
+		status.Status = "terminated"
+	case counts["queued"]+counts["initializing"] > 0:
+		status.Status = "in_progress"
+	case counts["ready"] == 0 && counts["failed"] > 0:
+		status.Status = "failed"
+	case counts["ready"] == len(status.Sessions) && counts["terminated"] == 0:
+		status.Status = "ready"
+	default:
+		status.Status = "partially_ready"
+	}
+	return status, nil
+}
+
+// SelectSessions returns the sessions of a batch, or of every batch when
+// batchID is empty, whose labels match the selector
+func (dm *DockerManager) SelectSessions(batchID string, sel Selector) []*ContainerStatus {
+	var selected []*ContainerStatus
+	for _, status := range dm.ListContainerStatuses() {
+		if (batchID == "" || status.BatchID == batchID) && sel.Matches(status.Labels) {
+			selected = append(selected, status)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].CreatedAt.Before(selected[j].CreatedAt) })
+	return selected
+}
+
+// TerminateSession ends a session whatever its state: a queued session
+// leaves the queue, a ready one is stopped, gracefully within timeout or
+// killed when timeout is zero, and a failed one is dismissed. Sessions
+// still starting or already stopping return ErrNotReady.
+func (dm *DockerManager) TerminateSession(trackingID string, timeout time.Duration) error {
+	status := dm.GetContainerStatus(trackingID)
+	if status == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, trackingID)
+	}
+
+	switch status.Status {
+	case "queued":
+		if !dm.sched.cancel(trackingID) {
+			return fmt.Errorf("%w: session %s is starting", ErrNotReady, trackingID)
+		}
+		dm.forget(trackingID)
+		log.Printf("Removed queued session %s", trackingID)
+		return nil
+	case "failed":
+		dm.forget(trackingID)
+		return nil
+	case "ready":
+		if timeout > 0 {
+			return dm.StopContainer(status.Endpoints.ContainerID, timeout)
+		}
+		return dm.KillContainer(status.Endpoints.ContainerID)
+	}
+	return fmt.Errorf("%w: session %s is %s", ErrNotReady, trackingID, status.Status)
+}
+
+// forget stops tracking a session that has no container
+func (dm *DockerManager) forget(trackingID string) {
+	dm.containerStats.Lock()
+	delete(dm.containerStats.statuses, trackingID)
+	dm.containerStats.Unlock()
+}
+
+// pruneBatches forgets batches whose sessions have all been gone for a
+// while. The caller holds the batch lock.
+func (dm *DockerManager) pruneBatches() {
+	now := time.Now()
+	for id, batch := range dm.batches.batches {
+		tracked := false
+		for _, trackingID := range batch.TrackingIDs {
+			if dm.GetContainerStatus(trackingID) != nil {
+				tracked = true
+				break
+			}
+		}
+		if tracked {
+			delete(dm.batches.idle, id)
+			continue
+		}
+		since, ok := dm.batches.idle[id]
+		if !ok {
+			dm.batches.idle[id] = now
+		} else if now.Sub(since) > batchRetention {
+			delete(dm.batches.batches, id)
+			delete(dm.batches.idle, id)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// DevToolsHost is the address Chromium serves the DevTools protocol on
+// inside a session. Chromium accepts it as Host header and uses it in the
+// WebSocket URLs it hands out.
+const DevToolsHost = "127.0.0.1:9222"
+
+// devToolsStartTimeout bounds the wait for a browser started for DevTools
+const devToolsStartTimeout = 20 * time.Second
+
+// errNotListening is returned by devToolsTunnel when no browser listens yet
+var errNotListening = errors.New("nothing listens on the DevTools port")
+
+// devToolsTunnelScript connects to the DevTools port on the loopback
+// interface of the container and relays it over standard input and output.
+// '+' is written once connected. Whichever side ends first closes both.
+const devToolsTunnelScript = `exec 2>/dev/null 3<>/dev/tcp/127.0.0.1/$0 4<&0 || exit 1
+printf +
+cat <&3 &
+cat <&4 >&3 &
+wait -n
+kill $(jobs -p)`
+
+// devToolsBrowserScript starts Chromium with remote debugging on the port
+// given as $0. A profile of its own keeps it apart from a browser the user
+// started from the desktop, which would otherwise take over the launch.
+const devToolsBrowserScript = `bin=$(command -v chromium || command -v chromium-browser || command -v google-chrome) || exit 127
+exec "$bin" --remote-debugging-port=$0 --user-data-dir="$HOME/.config/chromium-devtools" --no-sandbox --no-first-run --no-default-browser-check --start-maximized about:blank`
+
+// DialDevTools connects to the DevTools port of a session's browser. The
+// port only listens inside the container, so the connection is relayed by a
+// command run in it. When no browser listens yet, Chromium is started on the
+// desktop of the session with remote debugging.
+func (dm *DockerManager) DialDevTools(ctx context.Context, sessionID string) (net.Conn, error) {
+	containerID, err := dm.devToolsContainer(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dm.devToolsTunnel(ctx, containerID)
+	if !errors.Is(err, errNotListening) {
+		return conn, err
+	}
+
+	// Concurrent first connections start one browser
+	dm.devtools.Lock()
+	defer dm.devtools.Unlock()
+	conn, err = dm.devToolsTunnel(ctx, containerID)
+	if !errors.Is(err, errNotListening) {
+		return conn, err
+	}
+
+	_, port, _ := net.SplitHostPort(DevToolsHost)
+	exec, err := dm.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:    []string{"bash", "-c", devToolsBrowserScript, port},
+		Detach: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %v", err)
+	}
+	if err := dm.cli.ContainerExecStart(ctx, exec.ID, container.ExecStartOptions{Detach: true}); err != nil {
+		return nil, fmt.Errorf("failed to start exec: %v", err)
+	}
+	log.Printf("Started Chromium with remote debugging in session %s", sessionID)
+
+	deadline := time.Now().Add(devToolsStartTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+		conn, err = dm.devToolsTunnel(ctx, containerID)
+		if !errors.Is(err, errNotListening) {
+			return conn, err
+		}
+		inspect, err := dm.cli.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect exec: %v", err)
+		}
+		if !inspect.Running {
+			return nil, fmt.Errorf("%w: Chromium exited with code %d", ErrBrowserUnavailable, inspect.ExitCode)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: Chromium did not open the DevTools port within %s", ErrBrowserUnavailable, devToolsStartTimeout)
+		}
+	}
+}
+
+// devToolsContainer returns the container of a ready session whose image
+// has a browser with DevTools
+func (dm *DockerManager) devToolsContainer(sessionID string) (string, error) {
+	containerID, imageID, err := dm.readyContainerImage(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if img := findImage(imageID); img == nil || !img.CDP {
+		return "", fmt.Errorf("%w: image %s has no Chromium browser", ErrNoDevTools, imageID)
+	}
+	return containerID, nil
+}
+
+// devToolsTunnel relays a connection to the DevTools port of a container
+func (dm *DockerManager) devToolsTunnel(ctx context.Context, containerID string) (net.Conn, error) {
+	_, port, _ := net.SplitHostPort(DevToolsHost)
+	exec, err := dm.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          []string{"bash", "-c", devToolsTunnelScript, port},
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %v", err)
+	}
+	hijacked, err := dm.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start exec: %v", err)
+	}
+
+	out, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, io.Discard, hijacked.Reader)
+		pw.CloseWithError(err)
+	}()
+	conn := &execConn{Conn: hijacked.Conn, hijacked: hijacked, out: out}
+
+	marker := make([]byte, 1)
+	if _, err := io.ReadFull(out, marker); err != nil || marker[0] != '+' {
+		conn.Close()
+		inspect, inspectErr := dm.cli.ContainerExecInspect(ctx, exec.ID)
+		if inspectErr == nil && inspect.ExitCode == 1 {
+			return nil, errNotListening
+		}
+		return nil, fmt.Errorf("%w: DevTools relay failed to start, bash is required", ErrBrowserUnavailable)
+	}
+	return conn, nil
+}
+
+// execConn is a connection relayed over the standard streams of a command.
+// Writes go to its input, reads come from its output.
+type execConn struct {
+	net.Conn
+	hijacked types.HijackedResponse
+	out      *io.PipeReader
+}
+
+func (c *execConn) Read(p []byte) (int, error) {
+	return c.out.Read(p)
+}
+
+func (c *execConn) Close() error {
+	c.out.Close()
+	c.hijacked.Close()
+	return nil
+}
+
+// devToolsURL returns the WebSocket URL of the DevTools endpoint of a
+// container, or "" when its image has no browser with DevTools
+func (dm *DockerManager) devToolsURL(imageID string, shortID string) string {
+	if img := findImage(imageID); img == nil || !img.CDP {
+		return ""
+	}
+	u, err := url.Parse(dm.cfg.APIBaseURL())
+	if err != nil {
+		return ""
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/containers/" + shortID + "/cdp"
+	return u.String()
+}
@@ -0,0 +1,63 @@
+package docker
+
+import "errors"
+
+// ErrNotFound is returned for sessions and containers that do not exist
+var ErrNotFound = errors.New("session not found")
+
+// ErrInvalidImage is returned when a request names an image that is not in the catalog
+var ErrInvalidImage = errors.New("invalid image ID")
+
+// ErrInvalidResources is returned when requested resources are malformed or above the maximum
+var ErrInvalidResources = errors.New("invalid resources")
+
+// ErrInvalidPriority is returned when a queue priority is out of the configured range
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// ErrInvalidTTL is returned when a requested session lifetime is malformed
+var ErrInvalidTTL = errors.New("invalid ttl")
+
+// ErrCapacityExceeded is returned when no capacity is left and the creation queue is full
+var ErrCapacityExceeded = errors.New("capacity exceeded: creation queue is full")
+
+// ErrQuotaExceeded is returned when a tenant has used up its session, CPU or memory quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrNotPermitted is returned when a tenant quota forbids an image category or lifetime
+var ErrNotPermitted = errors.New("not permitted")
+
+// ErrNotReady is returned when an operation needs a session that is running
+var ErrNotReady = errors.New("session not ready")
+
+// ErrRegistry is returned when the service registry cannot be reached or rejects a request
+var ErrRegistry = errors.New("service registry failure")
+
+// ErrInvalidLabels is returned when session labels are malformed
+var ErrInvalidLabels = errors.New("invalid labels")
+
+// ErrInvalidSelector is returned when a label selector cannot be parsed
+var ErrInvalidSelector = errors.New("invalid label selector")
+
+// ErrInvalidExec is returned when a command to run in a session is malformed
+var ErrInvalidExec = errors.New("invalid command")
+
+// ErrNoSuchFile is returned when a path does not exist in a session
+var ErrNoSuchFile = errors.New("no such file or directory")
+
+// ErrInvalidPath is returned when a path cannot be used for a transfer, e.g. a directory to upload to
+var ErrInvalidPath = errors.New("invalid path")
+
+// ErrPathNotAllowed is returned when a path is outside the transfer directories of the image
+var ErrPathNotAllowed = errors.New("path not allowed")
+
+// ErrFileTooLarge is returned when a transfer exceeds the configured size limit
+var ErrFileTooLarge = errors.New("file too large")
+
+// ErrUploadIncomplete is returned when an upload ends before its announced size
+var ErrUploadIncomplete = errors.New("upload incomplete")
+
+// ErrNoDevTools is returned when the image of a session has no browser to debug over DevTools
+var ErrNoDevTools = errors.New("no DevTools browser")
+
+// ErrBrowserUnavailable is returned when the DevTools browser of a session cannot be started or reached
+var ErrBrowserUnavailable = errors.New("browser unavailable")
@@ -3,39 +3,115 @@ package docker
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/errdefs"
 )
 
-// StartEventListener starts listening for Docker events and handles container cleanup
-func (dm *DockerManager) StartEventListener(ctx context.Context) {
-	eventsChan, errChan := dm.cli.Events(ctx, events.ListOptions{})
+// eventRetryInterval is the wait before subscribing again to Docker events
+// after the stream ended
+const eventRetryInterval = 5 * time.Second
 
+// StartEventListener starts listening for Docker events and handles container cleanup.
+// When the event stream ends it subscribes again, and checks the tracked
+// containers for the events it missed meanwhile.
+func (dm *DockerManager) StartEventListener(ctx context.Context) {
 	go func() {
 		for {
+			err := dm.listenEvents(ctx)
+			if ctx.Err() != nil {
+				log.Println("Stopping Docker event listener")
+				return
+			}
+			log.Printf("Docker event stream ended (%v), subscribing again in %s", err, eventRetryInterval)
 			select {
-			case event := <-eventsChan:
-				// Only process container events
-				if event.Type == events.ContainerEventType {
-					switch event.Action {
-					case "die", "kill", "stop", "destroy":
-						shortID := event.Actor.ID[:12]
-						dm.containerStats.Lock()
-						delete(dm.containerStats.statuses, shortID)
-						dm.containerStats.Unlock()
-						log.Printf("Removed container %s from status tracking due to event: %s", shortID, event.Action)
-					}
-				}
-			case err := <-errChan:
-				if err != nil {
-					log.Printf("Error receiving docker events: %v", err)
-				}
 			case <-ctx.Done():
 				log.Println("Stopping Docker event listener")
 				return
+			case <-time.After(eventRetryInterval):
 			}
+			dm.reconcileContainers(ctx)
 		}
 	}()
 
 	log.Println("Docker event listener started successfully")
-}
\ No newline at end of file
+}
+
+// listenEvents handles Docker events until the stream ends
+func (dm *DockerManager) listenEvents(ctx context.Context) error {
+	eventsChan, errChan := dm.cli.Events(ctx, events.ListOptions{})
+	for {
+		select {
+		case event := <-eventsChan:
+			// Only process container events
+			if event.Type == events.ContainerEventType {
+				switch event.Action {
+				case "die", "kill", "stop", "destroy":
+					shortID := event.Actor.ID[:12]
+					dm.forgetContainer(shortID, string(event.Action))
+					if event.Action == "destroy" {
+						dm.exited.remove(shortID)
+					}
+					log.Printf("Removed container %s from status tracking due to event: %s", shortID, event.Action)
+					if imageID, ok := dm.pool.remove(event.Actor.ID); ok {
+						log.Printf("Warm container %s left the pool due to event: %s", shortID, event.Action)
+						go dm.fillPool(imageID)
+					}
+				}
+			}
+		case err := <-errChan:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// forgetContainer stops tracking the session of a container that is gone and
+// frees its capacity slot. Containers no longer tracked are left alone, so it
+// may be called more than once for the same container.
+func (dm *DockerManager) forgetContainer(shortID string, reason string) {
+	dm.containerStats.Lock()
+	status, tracked := dm.containerStats.statuses[shortID]
+	if tracked {
+		delete(dm.containerStats.statuses, status.TrackingID)
+	}
+	delete(dm.containerStats.statuses, shortID)
+	dm.containerStats.Unlock()
+	if tracked {
+		dm.sched.release(status.TrackingID)
+		dm.exited.add(status, reason)
+	}
+}
+
+// containerRunning reports whether a container exists and runs. Errors other
+// than a missing container count as running, the container is checked again
+// later.
+func (dm *DockerManager) containerRunning(ctx context.Context, containerID string) bool {
+	inspect, err := dm.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return !errdefs.IsNotFound(err)
+	}
+	return inspect.State != nil && inspect.State.Running
+}
+
+// reconcileContainers forgets the ready sessions whose container stopped
+// while no events were received
+func (dm *DockerManager) reconcileContainers(ctx context.Context) {
+	dm.containerStats.RLock()
+	var containerIDs []string
+	for id, status := range dm.containerStats.statuses {
+		if status.Endpoints != nil && id == status.Endpoints.ContainerID {
+			containerIDs = append(containerIDs, id)
+		}
+	}
+	dm.containerStats.RUnlock()
+
+	for _, containerID := range containerIDs {
+		if !dm.containerRunning(ctx, containerID) {
+			log.Printf("Container %s stopped while Docker events were not received", containerID)
+			dm.forgetContainer(containerID, "die")
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// runInContainer runs a command inside a container and waits for it to finish
+func (dm *DockerManager) runInContainer(ctx context.Context, containerID string, cmd []string, env []string) error {
+	exec, err := dm.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec: %v", err)
+	}
+
+	hijacked, err := dm.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start exec: %v", err)
+	}
+	defer hijacked.Close()
+
+	// The stream is closed once the command exits
+	var output bytes.Buffer
+	stdcopy.StdCopy(&output, &output, hijacked.Reader)
+
+	inspect, err := dm.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect exec: %v", err)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("command %q exited with code %d: %s", cmd[0], inspect.ExitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// maxExecOutput bounds the output captured per stream by Exec
+const maxExecOutput = 1 << 20
+
+// killGrace is how long a timed out command may take to exit after SIGTERM
+const killGrace = 5 * time.Second
+
+// ExecOptions describes a command to run in a session
+type ExecOptions struct {
+	Cmd        []string
+	User       string        // User or UID[:GID], the image default when empty
+	WorkingDir string        // The image default when empty
+	Env        []string      // KEY=value pairs added to the container environment
+	Timeout    time.Duration // The command is terminated once it runs longer
+	TTY        bool          // Allocate a terminal, stdout and stderr are then merged
+	Stdin      bool          // Attach stdin, for ExecStream
+}
+
+// ExecResult is the outcome of a command run to completion
+type ExecResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"` // Output beyond 1 MiB per stream was dropped
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Duration  int64  `json:"duration_ms"`
+}
+
+// ExecStream is a command attached to its caller. Stdin is written with
+// Write, output is read with Copy, and Wait returns the exit code.
+type ExecStream struct {
+	dm       *DockerManager
+	id       string
+	tty      bool
+	timeout  time.Duration
+	started  time.Time
+	hijacked types.HijackedResponse
+}
+
+// readyContainer returns the container of a ready session
+func (dm *DockerManager) readyContainer(id string) (string, error) {
+	containerID, _, err := dm.readyContainerImage(id)
+	return containerID, err
+}
+
+// readyContainerImage returns the container and the catalog image of a
+// ready session, read together so that neither belongs to a removed session
+func (dm *DockerManager) readyContainerImage(id string) (string, string, error) {
+	dm.containerStats.RLock()
+	defer dm.containerStats.RUnlock()
+	status, ok := dm.containerStats.statuses[id]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if status.Status != "ready" || status.Endpoints == nil {
+		return "", "", fmt.Errorf("%w: session %s is %s", ErrNotReady, id, status.Status)
+	}
+	return status.Endpoints.ContainerID, status.ImageID, nil
+}
+
+// StartExec starts a command in a ready session and attaches to it. The
+// command runs under timeout(1), so it is terminated inside the container
+// when it overruns rather than left behind.
+func (dm *DockerManager) StartExec(ctx context.Context, sessionID string, opts ExecOptions) (*ExecStream, error) {
+	if len(opts.Cmd) == 0 {
+		return nil, fmt.Errorf("%w: cmd must not be empty", ErrInvalidExec)
+	}
+	for _, kv := range opts.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return nil, fmt.Errorf("%w: env entry %q must be KEY=value", ErrInvalidExec, kv)
+		}
+	}
+	containerID, err := dm.readyContainer(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := opts.Cmd
+	if opts.Timeout > 0 {
+		wrapper := []string{"timeout", "-k", strconv.Itoa(int(killGrace / time.Second))}
+		if opts.TTY {
+			// Interactive programs must stay in the foreground to read the terminal
+			wrapper = append(wrapper, "--foreground")
+		}
+		wrapper = append(wrapper, strconv.Itoa(int(opts.Timeout.Round(time.Second)/time.Second)))
+		cmd = append(wrapper, cmd...)
+	}
+
+	exec, err := dm.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		User:         opts.User,
+		WorkingDir:   opts.WorkingDir,
+		Env:          opts.Env,
+		Tty:          opts.TTY,
+		AttachStdin:  opts.Stdin,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %v", err)
+	}
+	hijacked, err := dm.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{Tty: opts.TTY})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start exec: %v", err)
+	}
+	return &ExecStream{dm: dm, id: exec.ID, tty: opts.TTY, timeout: opts.Timeout, started: time.Now(), hijacked: hijacked}, nil
+}
+
+// Write sends input to the command
+func (s *ExecStream) Write(p []byte) (int, error) {
+	return s.hijacked.Conn.Write(p)
+}
+
+// CloseStdin signals the end of input
+func (s *ExecStream) CloseStdin() error {
+	return s.hijacked.CloseWrite()
+}
+
+// Copy copies the output of the command until it exits. With a terminal
+// everything is written to stdout.
+func (s *ExecStream) Copy(stdout, stderr io.Writer) error {
+	if s.tty {
+		_, err := io.Copy(stdout, s.hijacked.Reader)
+		return err
+	}
+	_, err := stdcopy.StdCopy(stdout, stderr, s.hijacked.Reader)
+	return err
+}
+
+// Resize changes the size of the terminal
+func (s *ExecStream) Resize(ctx context.Context, cols, rows uint) error {
+	return s.dm.cli.ContainerExecResize(ctx, s.id, container.ResizeOptions{Width: cols, Height: rows})
+}
+
+// Wait returns the exit code once the output has been copied, and whether
+// the command was terminated by its timeout
+func (s *ExecStream) Wait(ctx context.Context) (int, bool, error) {
+	inspect, err := s.dm.cli.ContainerExecInspect(ctx, s.id)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to inspect exec: %v", err)
+	}
+	// timeout(1) exits with 124 after SIGTERM, or 137 after SIGKILL
+	timedOut := s.timeout > 0 && (inspect.ExitCode == 124 || inspect.ExitCode == 137) && time.Since(s.started) >= s.timeout
+	return inspect.ExitCode, timedOut, nil
+}
+
+// Close detaches from the command
+func (s *ExecStream) Close() {
+	s.hijacked.Close()
+}
+
+// Exec runs a command in a ready session and captures its output
+func (dm *DockerManager) Exec(ctx context.Context, sessionID string, opts ExecOptions) (*ExecResult, error) {
+	opts.Stdin = false
+	stream, err := dm.StartExec(ctx, sessionID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	// Reading the output does not watch the context, closing the stream does
+	stop := context.AfterFunc(ctx, stream.Close)
+	defer stop()
+
+	stdout := &cappedBuffer{limit: maxExecOutput}
+	stderr := &cappedBuffer{limit: maxExecOutput}
+	if err := stream.Copy(stdout, stderr); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to read exec output: %v", err)
+	}
+	exitCode, timedOut, err := stream.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		ExitCode:  exitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+		TimedOut:  timedOut,
+		Duration:  time.Since(stream.started).Milliseconds(),
+	}, nil
+}
+
+// cappedBuffer keeps the first limit bytes written to it and drops the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
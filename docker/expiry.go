@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/audit"
+)
+
+// reapInterval is how often sessions are checked for an expired TTL
+const reapInterval = 15 * time.Second
+
+// stopTimeout is how long an expired session may take to shut down
+const stopTimeout = 10 * time.Second
+
+// startReaper stops sessions once their TTL has expired. The event listener
+// removes them from tracking when the container stops.
+func (dm *DockerManager) startReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dm.reapExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reapExpired stops every ready session past its expiry
+func (dm *DockerManager) reapExpired() {
+	now := time.Now()
+	var expired []*ContainerStatus
+
+	dm.containerStats.Lock()
+	for key, status := range dm.containerStats.statuses {
+		if key != status.TrackingID || status.Status != "ready" || status.ExpiresAt == nil || now.Before(*status.ExpiresAt) {
+			continue
+		}
+		status.Status = "stopping"
+		status.Message = "Session TTL expired"
+		snapshot := *status
+		expired = append(expired, &snapshot)
+	}
+	dm.containerStats.Unlock()
+
+	for _, status := range expired {
+		log.Printf("Stopping session %s (container %s), TTL expired at %s", status.TrackingID, status.Endpoints.ContainerID, status.ExpiresAt.Format(time.RFC3339))
+		err := dm.StopContainer(status.Endpoints.ContainerID, stopTimeout)
+		event := audit.Event{
+			Actor:   audit.ActorSystem,
+			Tenant:  status.Tenant,
+			Action:  audit.ActionSessionStop,
+			Session: status.TrackingID,
+			Params:  map[string]interface{}{"reason": "ttl expired", "owner": status.Owner, "expires_at": status.ExpiresAt},
+			Outcome: audit.OutcomeSuccess,
+		}
+		if err != nil {
+			event.Outcome, event.Error = audit.OutcomeFailure, err.Error()
+		}
+		dm.audit.Record(event)
+		if err != nil {
+			log.Printf("Error stopping expired session %s, retrying: %v", status.TrackingID, err)
+			// Mark it ready again so the next pass retries
+			dm.containerStats.Lock()
+			if current, ok := dm.containerStats.statuses[status.TrackingID]; ok && current.Status == "stopping" {
+				current.Status = "ready"
+				current.Message = "Container is ready"
+			}
+			dm.containerStats.Unlock()
+		}
+	}
+}
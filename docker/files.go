@@ -0,0 +1,322 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-units"
+)
+
+// maxDirEntries bounds the entries returned by ListDir
+const maxDirEntries = 1000
+
+// FileInfo describes a file or directory in a session
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path,omitempty"`
+	Type       string    `json:"type"` // file, dir, symlink or other
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"` // Permission bits in octal, e.g. 0644
+	ModTime    time.Time `json:"mod_time"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+// DirListing is the content of a directory in a session
+type DirListing struct {
+	Path      string     `json:"path"`
+	Entries   []FileInfo `json:"entries"`
+	Truncated bool       `json:"truncated,omitempty"` // More than 1000 entries
+}
+
+// FileReader streams a file out of a session
+type FileReader struct {
+	io.Reader
+	Info   FileInfo
+	closer io.Closer
+}
+
+// Close releases the copy from the container
+func (f *FileReader) Close() error {
+	return f.closer.Close()
+}
+
+// filePaths returns the directories files may be transferred under for an image
+func (dm *DockerManager) filePaths(imageID string) []string {
+	if paths, ok := dm.cfg.Files.ImagePaths[imageID]; ok {
+		return paths
+	}
+	if img := findImage(imageID); img != nil && len(img.FilePaths) > 0 {
+		return img.FilePaths
+	}
+	return dm.cfg.Files.AllowedPaths
+}
+
+// withinPaths reports whether p is one of the directories or below one
+func withinPaths(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFilePath checks a path of a ready session against the transfer
+// directories of its image. Docker follows symlinks in paths, so every
+// existing component below the allowed directory must also resolve inside
+// the allowed directories. It returns the container and the cleaned path.
+func (dm *DockerManager) resolveFilePath(ctx context.Context, sessionID string, p string) (string, string, error) {
+	status := dm.GetContainerStatus(sessionID)
+	if status == nil {
+		return "", "", fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	if status.Status != "ready" || status.Endpoints == nil {
+		return "", "", fmt.Errorf("%w: session %s is %s", ErrNotReady, sessionID, status.Status)
+	}
+	if !path.IsAbs(p) {
+		return "", "", fmt.Errorf("%w: %q must be absolute", ErrInvalidPath, p)
+	}
+	p = path.Clean(p)
+	allowed := dm.filePaths(status.ImageID)
+	if !withinPaths(p, allowed) {
+		return "", "", fmt.Errorf("%w: %s is outside %s", ErrPathNotAllowed, p, strings.Join(allowed, ", "))
+	}
+
+	containerID := status.Endpoints.ContainerID
+	for dir := p; withinPaths(dir, allowed); dir = path.Dir(dir) {
+		stat, err := dm.cli.ContainerStatPath(ctx, containerID, dir)
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to stat %s: %v", dir, err)
+		}
+		if stat.LinkTarget != "" && !withinPaths(stat.LinkTarget, allowed) {
+			return "", "", fmt.Errorf("%w: %s links outside %s", ErrPathNotAllowed, dir, strings.Join(allowed, ", "))
+		}
+	}
+	return containerID, p, nil
+}
+
+// StatFile describes a path in a session
+func (dm *DockerManager) StatFile(ctx context.Context, sessionID string, p string) (*FileInfo, error) {
+	containerID, p, err := dm.resolveFilePath(ctx, sessionID, p)
+	if err != nil {
+		return nil, err
+	}
+	return dm.statFile(ctx, containerID, p)
+}
+
+// statFile describes a resolved path in a container. Symlinks are followed,
+// their target is reported in LinkTarget.
+func (dm *DockerManager) statFile(ctx context.Context, containerID string, p string) (*FileInfo, error) {
+	stat, err := dm.cli.ContainerStatPath(ctx, containerID, p)
+	if errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchFile, p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", p, err)
+	}
+	if stat.LinkTarget != "" {
+		target, err := dm.statFile(ctx, containerID, stat.LinkTarget)
+		if err != nil {
+			return nil, err
+		}
+		target.Name, target.Path, target.LinkTarget = stat.Name, p, stat.LinkTarget
+		return target, nil
+	}
+	return &FileInfo{
+		Name:       stat.Name,
+		Path:       p,
+		Type:       fileType(stat.Mode),
+		Size:       stat.Size,
+		Mode:       fmt.Sprintf("%04o", stat.Mode.Perm()),
+		ModTime:    stat.Mtime,
+		LinkTarget: stat.LinkTarget,
+	}, nil
+}
+
+// ListDir lists a directory of a session. It runs find(1) as the desktop
+// user, so the listing does not copy the content of the directory.
+func (dm *DockerManager) ListDir(ctx context.Context, sessionID string, p string) (*DirListing, error) {
+	info, err := dm.StatFile(ctx, sessionID, p)
+	if err != nil {
+		return nil, err
+	}
+	if info.Type != "dir" {
+		return nil, fmt.Errorf("%w: %s is not a directory", ErrInvalidPath, info.Path)
+	}
+	dir := info.Path
+	if info.LinkTarget != "" {
+		dir = info.LinkTarget
+	}
+
+	result, err := dm.Exec(ctx, sessionID, ExecOptions{
+		Cmd:     []string{"find", dir, "-mindepth", "1", "-maxdepth", "1", "-printf", `%y\t%s\t%T@\t%m\t%l\t%f\0`},
+		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 && result.Stdout == "" {
+		return nil, fmt.Errorf("failed to list %s: %s", info.Path, strings.TrimSpace(result.Stderr))
+	}
+
+	listing := &DirListing{Path: info.Path, Entries: []FileInfo{}, Truncated: result.Truncated}
+	for _, record := range strings.Split(result.Stdout, "\x00") {
+		fields := strings.SplitN(record, "\t", 6)
+		if len(fields) != 6 {
+			// The last record is empty, or cut off by the output limit
+			continue
+		}
+		if len(listing.Entries) == maxDirEntries {
+			listing.Truncated = true
+			break
+		}
+		entry := FileInfo{Name: fields[5], LinkTarget: fields[4]}
+		if perm, err := strconv.ParseUint(fields[3], 8, 32); err == nil {
+			entry.Mode = fmt.Sprintf("%04o", perm)
+		}
+		switch fields[0] {
+		case "f":
+			entry.Type = "file"
+		case "d":
+			entry.Type = "dir"
+		case "l":
+			entry.Type = "symlink"
+		default:
+			entry.Type = "other"
+		}
+		entry.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+		if seconds, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			entry.ModTime = time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing, nil
+}
+
+// OpenFile streams a regular file out of a session, following a symlink
+// that resolves inside the transfer directories
+func (dm *DockerManager) OpenFile(ctx context.Context, sessionID string, p string) (*FileReader, error) {
+	containerID, p, err := dm.resolveFilePath(ctx, sessionID, p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := dm.statFile(ctx, containerID, p)
+	if err != nil {
+		return nil, err
+	}
+	source := info.Path
+	if info.LinkTarget != "" {
+		source = info.LinkTarget
+	}
+	if info.Type == "dir" {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrInvalidPath, info.Path)
+	}
+	limit, _ := units.RAMInBytes(dm.cfg.Files.MaxDownloadSize)
+	if info.Size > limit {
+		return nil, fmt.Errorf("%w: %s has %s, the limit is %s", ErrFileTooLarge, info.Path, units.BytesSize(float64(info.Size)), dm.cfg.Files.MaxDownloadSize)
+	}
+
+	archive, _, err := dm.cli.CopyFromContainer(ctx, containerID, source)
+	if errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchFile, info.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s: %v", info.Path, err)
+	}
+	tr := tar.NewReader(archive)
+	header, err := tr.Next()
+	if err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to copy %s: %v", info.Path, err)
+	}
+	if header.Typeflag != tar.TypeReg {
+		archive.Close()
+		return nil, fmt.Errorf("%w: %s is not a regular file", ErrInvalidPath, info.Path)
+	}
+	info.Size = header.Size
+	return &FileReader{Reader: io.LimitReader(tr, header.Size), Info: *info, closer: archive}, nil
+}
+
+// WriteFile streams size bytes from r into a file of a session, replacing
+// it when it exists. The parent directory must exist. The file is owned by
+// the user of the container.
+func (dm *DockerManager) WriteFile(ctx context.Context, sessionID string, p string, r io.Reader, size int64) (*FileInfo, error) {
+	limit, _ := units.RAMInBytes(dm.cfg.Files.MaxUploadSize)
+	if size > limit {
+		return nil, fmt.Errorf("%w: %s exceeds the limit of %s", ErrFileTooLarge, units.BytesSize(float64(size)), dm.cfg.Files.MaxUploadSize)
+	}
+	containerID, p, err := dm.resolveFilePath(ctx, sessionID, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := path.Split(p)
+	parent, err := dm.statFile(ctx, containerID, path.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	if parent.Type != "dir" {
+		return nil, fmt.Errorf("%w: %s is not a directory", ErrInvalidPath, dir)
+	}
+	if existing, err := dm.cli.ContainerStatPath(ctx, containerID, p); err == nil && existing.Mode.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrInvalidPath, p)
+	}
+
+	// The archive is written while Docker reads it, so the file is never held in memory
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     size,
+			ModTime:  time.Now(),
+		})
+		if err == nil {
+			_, err = io.CopyN(tw, r, size)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err = dm.cli.CopyToContainer(ctx, containerID, dir, pr, container.CopyToContainerOptions{CopyUIDGID: true})
+	pr.CloseWithError(io.ErrClosedPipe)
+	if uploadErr := <-written; uploadErr != nil && uploadErr != io.ErrClosedPipe {
+		return nil, fmt.Errorf("%w: %v", ErrUploadIncomplete, uploadErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy to %s: %v", p, err)
+	}
+	return dm.statFile(ctx, containerID, p)
+}
+
+// fileType names the type of a file mode
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	}
+	return "other"
+}
@@ -3,13 +3,33 @@ package docker
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
 )
 
 func (dm *DockerManager) KillContainer(containerID string) error {
     ctx := context.Background()
     err := dm.cli.ContainerKill(ctx, containerID, "SIGKILL")
+    if errdefs.IsNotFound(err) {
+        return fmt.Errorf("%w: container %s", ErrNotFound, containerID)
+    }
     if err != nil {
         return fmt.Errorf("failed to kill container: %v", err)
     }
     return nil
-}
\ No newline at end of file
+}
+// StopContainer stops a container gracefully, killing it after the timeout
+func (dm *DockerManager) StopContainer(containerID string, timeout time.Duration) error {
+    ctx := context.Background()
+    seconds := int(timeout / time.Second)
+    err := dm.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &seconds})
+    if errdefs.IsNotFound(err) {
+        return fmt.Errorf("%w: container %s", ErrNotFound, containerID)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to stop container: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxLabels bounds the labels of a session
+const MaxLabels = 32
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabels checks label keys and values. Keys are up to 63
+// alphanumerics, '.', '_', '-' and '/', values the same without '/'.
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidLabels, MaxLabels)
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: key %q is malformed", ErrInvalidLabels, key)
+		}
+		if !labelValuePattern.MatchString(value) {
+			return fmt.Errorf("%w: value %q of %s is malformed", ErrInvalidLabels, value, key)
+		}
+	}
+	return nil
+}
+
+// mergeLabels returns the labels of base overridden by those of extra
+func mergeLabels(base, extra map[string]string) map[string]string {
+	if len(base) == 0 && len(extra) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Selector matches sessions by their labels. It is a comma-separated list
+// of requirements that must all hold: key=value, key!=value, key (present)
+// and !key (absent). The empty selector matches every session.
+type Selector []requirement
+
+type requirement struct {
+	key   string
+	value string
+	op    string // "=", "!=", "exists" or "!exists"
+}
+
+// ParseSelector parses a label selector such as "suite=login,env!=prod"
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var req requirement
+		switch {
+		case strings.Contains(part, "!="):
+			req.key, req.value, _ = strings.Cut(part, "!=")
+			req.op = "!="
+		case strings.Contains(part, "="):
+			req.key, req.value, _ = strings.Cut(part, "=")
+			req.op = "="
+		case strings.HasPrefix(part, "!"):
+			req.key, req.op = part[1:], "!exists"
+		default:
+			req.key, req.op = part, "exists"
+		}
+		req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+		if !labelKeyPattern.MatchString(req.key) || !labelValuePattern.MatchString(req.value) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSelector, part)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		value, ok := labels[req.key]
+		switch req.op {
+		case "=":
+			if !ok || value != req.value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
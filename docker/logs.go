@@ -0,0 +1,153 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// exitedRetention is how long an exited session is remembered for its logs
+// when its container is not removed
+const exitedRetention = 24 * time.Hour
+
+// LogOptions selects the logs of a session
+type LogOptions struct {
+	Since      time.Time // Zero for the start of the logs
+	Tail       int       // Number of lines from the end, negative for all
+	Timestamps bool      // Prefix every line with its RFC 3339 timestamp
+	Follow     bool      // Keep streaming until the container exits or ctx is done
+	Stdout     bool
+	Stderr     bool
+}
+
+// exitedStore remembers sessions whose container exited, keyed like the
+// tracked statuses, so their logs stay accessible to the same callers until
+// the container is removed
+type exitedStore struct {
+	sync.RWMutex
+	sessions map[string]*ContainerStatus
+}
+
+func newExitedStore() *exitedStore {
+	return &exitedStore{sessions: make(map[string]*ContainerStatus)}
+}
+
+// add records that the container of a session exited
+func (s *exitedStore) add(status *ContainerStatus, reason string) {
+	if status.Endpoints == nil {
+		return
+	}
+	now := time.Now()
+	snapshot := *status
+	snapshot.Status = "exited"
+	snapshot.ExitedAt = &now
+	snapshot.Message = "Container exited: " + reason
+	snapshot.QueuePosition = 0
+	snapshot.ExpiresAt = nil
+	snapshot.vncPassword = ""
+
+	s.Lock()
+	defer s.Unlock()
+	for key, exited := range s.sessions {
+		if now.Sub(*exited.ExitedAt) > exitedRetention {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[snapshot.TrackingID] = &snapshot
+	s.sessions[snapshot.Endpoints.ContainerID] = &snapshot
+}
+
+// remove forgets a session once its container is removed
+func (s *exitedStore) remove(shortID string) {
+	s.Lock()
+	defer s.Unlock()
+	if status, ok := s.sessions[shortID]; ok {
+		delete(s.sessions, status.TrackingID)
+		delete(s.sessions, shortID)
+	}
+}
+
+// GetExitedSession returns the status of a session whose container exited
+// but has not been removed, or nil
+func (dm *DockerManager) GetExitedSession(id string) *ContainerStatus {
+	dm.exited.RLock()
+	defer dm.exited.RUnlock()
+	status, ok := dm.exited.sessions[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *status
+	return &snapshot
+}
+
+// logsContainer returns the container of a session that has one, running or exited
+func (dm *DockerManager) logsContainer(id string) (string, error) {
+	if status := dm.GetContainerStatus(id); status != nil {
+		if status.Endpoints == nil {
+			return "", fmt.Errorf("%w: session %s is %s", ErrNotReady, id, status.Status)
+		}
+		return status.Endpoints.ContainerID, nil
+	}
+	if status := dm.GetExitedSession(id); status != nil {
+		return status.Endpoints.ContainerID, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// LogStream is the open log of a session
+type LogStream struct {
+	logs io.ReadCloser
+}
+
+// OpenLogs opens the logs of a session. They are read from Docker, so they
+// survive the container as long as it is not removed. A followed log ends
+// when the container exits or ctx is done.
+func (dm *DockerManager) OpenLogs(ctx context.Context, sessionID string, opts LogOptions) (*LogStream, error) {
+	containerID, err := dm.logsContainer(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := container.LogsOptions{
+		ShowStdout: opts.Stdout,
+		ShowStderr: opts.Stderr,
+		Timestamps: opts.Timestamps,
+		Follow:     opts.Follow,
+		Tail:       "all",
+	}
+	if !opts.Since.IsZero() {
+		options.Since = strconv.FormatInt(opts.Since.Unix(), 10)
+	}
+	if opts.Tail >= 0 {
+		options.Tail = strconv.Itoa(opts.Tail)
+	}
+
+	logs, err := dm.cli.ContainerLogs(ctx, containerID, options)
+	if errdefs.IsNotFound(err) {
+		dm.exited.remove(containerID)
+		return nil, fmt.Errorf("%w: container %s was removed", ErrNotFound, containerID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs: %v", err)
+	}
+	return &LogStream{logs: logs}, nil
+}
+
+// Copy copies the log to stdout and stderr until it ends
+func (s *LogStream) Copy(stdout, stderr io.Writer) error {
+	// Desktop containers run without a terminal, so the streams are multiplexed
+	_, err := stdcopy.StdCopy(stdout, stderr, s.logs)
+	return err
+}
+
+// Close closes the log
+func (s *LogStream) Close() error {
+	return s.logs.Close()
+}
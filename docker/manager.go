@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"fmt"
 
@@ -17,7 +20,9 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+	"github.com/shanurrahman/orchestrator/audit"
 	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/tlsutil"
 	"github.com/shanurrahman/orchestrator/utils"
 )
 
@@ -27,10 +32,18 @@ type DockerManager struct {
 	cfg            *config.Config
 	network        string
 	containerStats containerStatusMap
+	pool           *warmPool
+	sched          *scheduler
+	audit          *audit.Logger
+	registry       *http.Client
+	batches        *batchStore
+	exited         *exitedStore
+	onReady        []func(*ContainerStatus)
+	devtools       sync.Mutex // Serialises browser starts for DevTools
 }
 
 // Update NewDockerManager
-func NewDockerManager(cfg *config.Config) *DockerManager {
+func NewDockerManager(cfg *config.Config, auditLog *audit.Logger) *DockerManager {
     cli, err := client.NewClientWithOpts(client.FromEnv)
     if err != nil {
         log.Printf("Error creating Docker client: %v", err)
@@ -38,8 +51,20 @@ func NewDockerManager(cfg *config.Config) *DockerManager {
     }
     log.Println("Docker client initialized successfully")
 
+    registry := http.DefaultClient
+    if cfg.Registry.TLS.Enabled {
+        tlsConfig, err := tlsutil.ClientConfig(cfg.Registry.TLS)
+        if err != nil {
+            log.Printf("Error setting up registry TLS: %v", err)
+            return nil
+        }
+        transport := http.DefaultTransport.(*http.Transport).Clone()
+        transport.TLSClientConfig = tlsConfig
+        registry = &http.Client{Transport: transport}
+    }
+
     // Create Docker network if it doesn't exist
-    networkName := "fabio_network"
+    networkName := cfg.Network
     networks, err := cli.NetworkList(context.Background(), network.ListOptions{})
     if err != nil {
         log.Printf("Error listing networks: %v", err)
@@ -72,77 +97,232 @@ func NewDockerManager(cfg *config.Config) *DockerManager {
         containerStats: containerStatusMap{
             statuses: make(map[string]*ContainerStatus),
         },
+        pool:    newWarmPool(cfg.WarmPool),
+        sched:   newScheduler(cfg.Capacity),
+        audit:   auditLog,
+        registry: registry,
+        batches:  newBatchStore(),
+        exited:   newExitedStore(),
     }
 
     // Start the event listener with a background context
     dm.StartEventListener(context.Background())
+    dm.startWarmPool()
+    dm.startReaper(context.Background())
 
     return dm
 }
 
-// Add these new methods
+// GetContainerStatus returns a snapshot of the status tracked under a tracking or container ID
 func (dm *DockerManager) GetContainerStatus(id string) *ContainerStatus {
     dm.containerStats.RLock()
-    defer dm.containerStats.RUnlock()
-    return dm.containerStats.statuses[id]
+    status, ok := dm.containerStats.statuses[id]
+    if !ok {
+        dm.containerStats.RUnlock()
+        return nil
+    }
+    snapshot := *status
+    dm.containerStats.RUnlock()
+
+    if snapshot.Status == "queued" {
+        snapshot.QueuePosition = dm.sched.position(snapshot.TrackingID)
+    }
+    return &snapshot
+}
+
+// ListContainerStatuses returns a snapshot of every tracked session
+func (dm *DockerManager) ListContainerStatuses() []*ContainerStatus {
+    dm.containerStats.RLock()
+    seen := make(map[string]bool)
+    var ids []string
+    for _, status := range dm.containerStats.statuses {
+        if !seen[status.TrackingID] {
+            seen[status.TrackingID] = true
+            ids = append(ids, status.TrackingID)
+        }
+    }
+    dm.containerStats.RUnlock()
+
+    sort.Strings(ids)
+    statuses := make([]*ContainerStatus, 0, len(ids))
+    for _, id := range ids {
+        if status := dm.GetContainerStatus(id); status != nil {
+            statuses = append(statuses, status)
+        }
+    }
+    return statuses
 }
 
 // Add this type definition near other types
 type ContainerConfig struct {
     ImageID     string     `json:"imageId"`
     VNCConfig   config.VNCConfig  `json:"vncConfig,omitempty"`
+    Priority    int        `json:"priority,omitempty"` // Higher priorities leave the queue first
+    Resources   config.Resources `json:"resources,omitempty"`
+    Owner       string     `json:"owner,omitempty"`  // Authentication method and subject of the caller that requested the session, e.g. jwt:alice
+    Tenant      string     `json:"tenant,omitempty"` // Tenant of the caller that requested the session
+    TTL         time.Duration `json:"ttl,omitempty"` // Lifetime once ready, 0 for the tenant maximum
+    Labels      map[string]string `json:"labels,omitempty"` // Matched by label selectors in bulk operations
+    BatchID     string     `json:"batchId,omitempty"` // Set for sessions created by CreateBatch
+    Recording   bool       `json:"recording,omitempty"` // Record the desktop once the session is ready
 }
 
-// Update CreateContainerAsync to accept VNC configuration
+// CreateContainerAsync queues a creation request and returns its tracking ID.
+// The container is created once capacity allows; progress is reported through
+// GetContainerStatus.
 func (dm *DockerManager) CreateContainerAsync(configObj ContainerConfig) (string, error) {
     // Find the requested image
-    var selectedImage string
-    for _, img := range availableImages {
-        if img.ID == configObj.ImageID {
-            selectedImage = img.Name
-            break
-        }
+    img := findImage(configObj.ImageID)
+    if img == nil {
+        return "", fmt.Errorf("%w: %s", ErrInvalidImage, configObj.ImageID)
+    }
+
+    if err := ValidateLabels(configObj.Labels); err != nil {
+        return "", err
+    }
+    if limit := dm.cfg.Capacity.MaxPriority; configObj.Priority > limit || configObj.Priority < -limit {
+        return "", fmt.Errorf("%w: priority must be between %d and %d", ErrInvalidPriority, -limit, limit)
     }
-    if selectedImage == "" {
-        return "", fmt.Errorf("invalid image ID: %s", configObj.ImageID)
+
+    resources, err := dm.resolveResources(configObj.Resources, img)
+    if err != nil {
+        return "", err
+    }
+    configObj.Resources = resources
+    configObj.VNCConfig = dm.withVNCDefaults(configObj.VNCConfig)
+
+    quota := dm.cfg.Quotas.For(configObj.Tenant)
+    configObj.TTL, err = checkQuotaAccess(quota, img, configObj.TTL)
+    if err != nil {
+        return "", err
     }
 
+    // Usage is checked under the same lock that records the session, so
+    // concurrent requests of a tenant cannot overrun its quota
     dm.containerStats.Lock()
+    if err := dm.checkQuotaUsage(configObj.Tenant, quota, resources); err != nil {
+        dm.containerStats.Unlock()
+        return "", err
+    }
     tempID := utils.GenerateID()[:12]
     dm.containerStats.statuses[tempID] = &ContainerStatus{
-        Status:  "initializing",
-        Message: "Starting container creation",
+        TrackingID: tempID,
+        Status:     "queued",
+        Message:    "Waiting for capacity",
+        Owner:      configObj.Owner,
+        Tenant:     configObj.Tenant,
+        ImageID:    img.ID,
+        Labels:     configObj.Labels,
+        BatchID:    configObj.BatchID,
+        Recording:  configObj.Recording,
+        Resources:  &resources,
+        CreatedAt:  time.Now(),
     }
     dm.containerStats.Unlock()
 
-    go func() {
-        // Fix: Use selectedImage and configObj.VNCConfig instead of undefined variables
-        endpoints, err := dm.CreateContainer(selectedImage, configObj.VNCConfig)
+    err = dm.sched.enqueue(&queuedRequest{
+        trackingID: tempID,
+        imageID:    img.ID,
+        priority:   configObj.Priority,
+        start:      func() { dm.createQueuedContainer(tempID, img.Name, configObj) },
+    })
+    if err != nil {
+        dm.containerStats.Lock()
+        delete(dm.containerStats.statuses, tempID)
+        dm.containerStats.Unlock()
+        return "", err
+    }
+
+    return tempID, nil
+}
+
+// createQueuedContainer runs a creation request admitted by the scheduler
+func (dm *DockerManager) createQueuedContainer(tempID string, imageName string, configObj ContainerConfig) {
+    dm.containerStats.Lock()
+    dm.containerStats.statuses[tempID].Status = "initializing"
+    dm.containerStats.statuses[tempID].Message = "Starting container creation"
+    dm.containerStats.Unlock()
+
+    // The password is only kept server-side, for the VNC proxy
+    if configObj.VNCConfig.Password == "" {
+        configObj.VNCConfig.Password = utils.GenerateID()[:12]
+    }
+
+    var endpoints *ContainerEndpoints
+    var err error
+    if wc, ok := dm.takeWarmContainer(configObj.ImageID, configObj.VNCConfig, configObj.Resources); ok {
+        endpoints, err = dm.claimWarmContainer(wc, configObj.VNCConfig)
         if err != nil {
-            dm.containerStats.Lock()
-            dm.containerStats.statuses[tempID].Status = "failed"
-            dm.containerStats.statuses[tempID].Message = "Container creation failed"
-            dm.containerStats.statuses[tempID].Error = err.Error()
-            dm.containerStats.Unlock()
-            return
+            log.Printf("Falling back to a new container, warm container unusable: %v", err)
         }
-
-        // Instead of deleting tempID, update it with the container information
+    }
+    if endpoints == nil {
+        endpoints, err = dm.CreateContainer(imageName, configObj.VNCConfig, configObj.Resources)
+    }
+    if err != nil {
+        dm.sched.release(tempID)
         dm.containerStats.Lock()
-        dm.containerStats.statuses[tempID] = &ContainerStatus{
-            Status:    "ready",
-            Message:   "Container is ready",
-            Endpoints: endpoints,
-        }
-        // Also store the status under the real container ID for future reference
-        dm.containerStats.statuses[endpoints.ContainerID] = dm.containerStats.statuses[tempID]
+        dm.containerStats.statuses[tempID].Status = "failed"
+        dm.containerStats.statuses[tempID].Message = "Container creation failed"
+        dm.containerStats.statuses[tempID].Error = err.Error()
         dm.containerStats.Unlock()
-    }()
+        return
+    }
+    dm.sched.started(tempID)
+    endpoints.CDPWSURL = dm.devToolsURL(configObj.ImageID, endpoints.ContainerID)
+
+    startedAt := time.Now()
+    var expiresAt *time.Time
+    if configObj.TTL > 0 {
+        expiry := startedAt.Add(configObj.TTL)
+        expiresAt = &expiry
+    }
 
-    return tempID, nil
+    // Instead of deleting tempID, update it with the container information
+    dm.containerStats.Lock()
+    dm.containerStats.statuses[tempID] = &ContainerStatus{
+        TrackingID: tempID,
+        Status:     "ready",
+        Message:    "Container is ready",
+        Owner:      configObj.Owner,
+        Tenant:     configObj.Tenant,
+        ImageID:    configObj.ImageID,
+        Labels:     configObj.Labels,
+        BatchID:    configObj.BatchID,
+        Recording:  configObj.Recording,
+        Resources:  &configObj.Resources,
+        CreatedAt:  dm.containerStats.statuses[tempID].CreatedAt,
+        StartedAt:  &startedAt,
+        ExpiresAt:  expiresAt,
+        Endpoints:  endpoints,
+        vncPassword: configObj.VNCConfig.Password,
+    }
+    // Also store the status under the real container ID for future reference
+    dm.containerStats.statuses[endpoints.ContainerID] = dm.containerStats.statuses[tempID]
+    dm.containerStats.Unlock()
+
+    // A container that died before its ID was stored had its events ignored
+    if !dm.containerRunning(context.Background(), endpoints.ContainerID) {
+        log.Printf("Container %s of session %s stopped while starting", endpoints.ContainerID, tempID)
+        dm.forgetContainer(endpoints.ContainerID, "die")
+        return
+    }
+
+    for _, fn := range dm.onReady {
+        go fn(dm.GetContainerStatus(tempID))
+    }
+}
+
+// OnReady registers a function called with every session that became
+// ready. Functions must be registered before sessions are created.
+func (dm *DockerManager) OnReady(fn func(*ContainerStatus)) {
+    dm.onReady = append(dm.onReady, fn)
 }
 
-func (dm *DockerManager) registerWithConsul(containerID string, containerIP string, consulAddr string) error {
+// registerWithConsul registers the container services and their health checks
+// with Consul. Routing tags for fabio are only added when routes is set, so
+// idle pool containers are monitored without being reachable.
+func (dm *DockerManager) registerWithConsul(containerID string, containerIP string, consulAddr string, routes bool) error {
     shortID := containerID[:12]
     
     // Register Chat Commands endpoint
@@ -185,16 +365,23 @@ func (dm *DockerManager) registerWithConsul(containerID string, containerIP stri
     vncRegistration.Check.TCP = fmt.Sprintf("%s:5901", containerIP)
     vncRegistration.Check.Interval = "10s"
 
+    registrations := []ConsulServiceRegistration{chatRegistration, novncRegistration, vncRegistration}
+    if !routes {
+        for i := range registrations {
+            registrations[i].Tags = nil
+        }
+    }
+
     // Register all services
-    for _, registration := range []ConsulServiceRegistration{chatRegistration, novncRegistration, vncRegistration} {
+    for _, registration := range registrations {
         jsonData, err := json.Marshal(registration)
         if err != nil {
             return fmt.Errorf("failed to marshal registration data: %v", err)
         }
 
-        resp, err := http.DefaultClient.Do(&http.Request{
+        resp, err := dm.registry.Do(&http.Request{
             Method: "PUT",
-            URL:    &url.URL{Scheme: "http", Host: consulAddr, Path: "/v1/agent/service/register"},
+            URL:    &url.URL{Scheme: dm.registryScheme(), Host: consulAddr, Path: "/v1/agent/service/register"},
             Body:   io.NopCloser(bytes.NewReader(jsonData)),
         })
         if err != nil {
@@ -211,6 +398,36 @@ func (dm *DockerManager) registerWithConsul(containerID string, containerIP stri
     return nil
 }
 
+// deregisterFromConsul removes the container services from Consul
+func (dm *DockerManager) deregisterFromConsul(containerID string, consulAddr string) error {
+    shortID := containerID[:12]
+
+    for _, prefix := range []string{"chat-api", "novnc", "vnc"} {
+        resp, err := dm.registry.Do(&http.Request{
+            Method: "PUT",
+            URL:    &url.URL{Scheme: dm.registryScheme(), Host: consulAddr, Path: fmt.Sprintf("/v1/agent/service/deregister/%s-%s", prefix, shortID)},
+        })
+        if err != nil {
+            return fmt.Errorf("failed to deregister service: %v", err)
+        }
+        resp.Body.Close()
+
+        if resp.StatusCode != http.StatusOK {
+            return fmt.Errorf("failed to deregister service, status: %d", resp.StatusCode)
+        }
+    }
+
+    return nil
+}
+
+// registryScheme returns the URL scheme of the service registry
+func (dm *DockerManager) registryScheme() string {
+    if dm.cfg.Registry.TLS.Enabled {
+        return "https"
+    }
+    return "http"
+}
+
 func (dm *DockerManager) ensureImageExists(imageName string) error {
     // Check if image exists locally
     _, _, err := dm.cli.ImageInspectWithRaw(context.Background(), imageName)
@@ -239,21 +456,35 @@ func (dm *DockerManager) ensureImageExists(imageName string) error {
 }
 
 // Update CreateContainer to accept VNC configuration
-func (dm *DockerManager) CreateContainer(imageName string, vncConfig config.VNCConfig) (*ContainerEndpoints, error) {
-    // Remove these lines
-    // containerID := utils.GenerateID()
-    // shortID := containerID[:12]
+func (dm *DockerManager) CreateContainer(imageName string, vncConfig config.VNCConfig, resources config.Resources) (*ContainerEndpoints, error) {
     log.Printf("Creating container using image: %s", imageName)
 
-    if err := dm.ensureImageExists(imageName); err != nil {
-        return nil, err
-    }
-
     // Generate random password if not provided
     if vncConfig.Password == "" {
         vncConfig.Password = utils.GenerateID()[:12] // Use first 12 chars as password
     }
 
+    containerID, containerIP, err := dm.startContainer(imageName, vncConfig, resources)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := dm.registerServices(containerID, containerIP, true); err != nil {
+        // Clean up the container if Consul registration fails
+        dm.cli.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+        return nil, fmt.Errorf("container creation failed: unable to register with service discovery: %v", err)
+    }
+
+    return newContainerEndpoints(containerID[:12]), nil
+}
+
+// startContainer pulls the image if needed, creates and starts a container
+// with the given VNC configuration and returns its ID and network address.
+func (dm *DockerManager) startContainer(imageName string, vncConfig config.VNCConfig, resources config.Resources) (string, string, error) {
+    if err := dm.ensureImageExists(imageName); err != nil {
+        return "", "", err
+    }
+
     // Create environment variables for VNC configuration
     env := []string{
         fmt.Sprintf("VNC_PW=%s", vncConfig.Password),
@@ -281,6 +512,7 @@ func (dm *DockerManager) CreateContainer(imageName string, vncConfig config.VNCC
         },
         NetworkMode: container.NetworkMode(dm.network),
     }
+    applyResources(hostConfig, resources)
 
     resp, err := dm.cli.ContainerCreate(
         context.Background(),
@@ -300,16 +532,12 @@ func (dm *DockerManager) CreateContainer(imageName string, vncConfig config.VNCC
     )
 
     if err != nil {
-        return nil, fmt.Errorf("failed to create container: %v", err)
+        return "", "", fmt.Errorf("failed to create container: %v", err)
     }
 
-    // Use Docker's container ID
-    containerID := resp.ID
-    shortID := containerID[:12]
-
     // Start the container
     if err := dm.cli.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
-        return nil, fmt.Errorf("failed to start container: %v", err)
+        return "", "", fmt.Errorf("failed to start container: %v", err)
     }
 
     // Get container IP address
@@ -317,33 +545,94 @@ func (dm *DockerManager) CreateContainer(imageName string, vncConfig config.VNCC
     if err != nil {
         // Clean up the container if inspection fails
         dm.cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
-        return nil, fmt.Errorf("failed to inspect container: %v", err)
+        return "", "", fmt.Errorf("failed to inspect container: %v", err)
     }
 
-    containerIP := inspect.NetworkSettings.Networks[dm.network].IPAddress
+    return resp.ID, inspect.NetworkSettings.Networks[dm.network].IPAddress, nil
+}
 
-    // Register services with Consul using environment variable for Consul address
-    consulAddr := os.Getenv("CONSUL_HTTP_ADDR")
-    if consulAddr == "" {
-        consulAddr = "localhost:8500" // fallback to default
+// newContainerEndpoints builds the public routes of a container. Desktop
+// URLs are handed out as access links instead, see VNCTarget.
+func newContainerEndpoints(shortID string) *ContainerEndpoints {
+    return &ContainerEndpoints{
+        ContainerID:  shortID,
+        ChatAPIPath:  fmt.Sprintf("/%s/chat/", shortID),
     }
+}
 
-    if err := dm.registerWithConsul(resp.ID, containerIP, consulAddr); err != nil {
-        // Clean up the container if Consul registration fails
-        dm.cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
-        return nil, fmt.Errorf("container creation failed: unable to register with service discovery: %v", err)
+// VNCTarget returns the VNC server address and password of a ready session
+func (dm *DockerManager) VNCTarget(id string) (string, string, error) {
+    dm.containerStats.RLock()
+    status, ok := dm.containerStats.statuses[id]
+    var containerID, password string
+    if ok && status.Status == "ready" {
+        containerID, password = status.Endpoints.ContainerID, status.vncPassword
+    }
+    dm.containerStats.RUnlock()
+    if containerID == "" {
+        return "", "", fmt.Errorf("%w: session %s has no running desktop", ErrNotReady, id)
     }
 
-    // In CreateContainer method, update the endpoints
-    endpoints := &ContainerEndpoints{
-        ContainerID:  shortID,
-        ChatAPIPath:  fmt.Sprintf("/%s/chat/", shortID),
-        NoVNCPath:    fmt.Sprintf("/%s/novnc/vnc_lite.html?password=%s&path=%s/novnc/websockify", shortID, vncConfig.Password, shortID),
-        VNCPath:      fmt.Sprintf("/%s/novnc/vnc.html?password=%s&path=%s/novnc/websockify", shortID, vncConfig.Password, shortID),
+    inspect, err := dm.cli.ContainerInspect(context.Background(), containerID)
+    if err != nil {
+        return "", "", fmt.Errorf("failed to inspect container: %v", err)
+    }
+    settings, ok := inspect.NetworkSettings.Networks[dm.network]
+    if !ok || settings.IPAddress == "" {
+        return "", "", fmt.Errorf("container %s has no address on network %s", containerID, dm.network)
     }
+    return net.JoinHostPort(settings.IPAddress, "5901"), password, nil
+}
+
+// SessionReady reports whether a session is tracked and ready
+func (dm *DockerManager) SessionReady(id string) bool {
+    dm.containerStats.RLock()
+    defer dm.containerStats.RUnlock()
+    status, ok := dm.containerStats.statuses[id]
+    return ok && status.Status == "ready"
+}
 
-    return endpoints, nil
+// withVNCDefaults fills unset VNC settings from the configured defaults
+func (dm *DockerManager) withVNCDefaults(vncConfig config.VNCConfig) config.VNCConfig {
+    defaults := dm.cfg.DefaultVNCConfig
+    if vncConfig.Password == "" {
+        vncConfig.Password = defaults.Password
+    }
+    if vncConfig.Resolution == "" {
+        vncConfig.Resolution = defaults.Resolution
+    }
+    if vncConfig.ColDepth == 0 {
+        vncConfig.ColDepth = defaults.ColDepth
+    }
+    if vncConfig.Display == "" {
+        vncConfig.Display = defaults.Display
+    }
+    vncConfig.ViewOnly = vncConfig.ViewOnly || defaults.ViewOnly
+    return vncConfig
 }
+
+// registerServices registers the container with the configured registry backend
+func (dm *DockerManager) registerServices(containerID string, containerIP string, routes bool) error {
+    if dm.cfg.Registry.Backend == "none" {
+        return nil
+    }
+    if err := dm.registerWithConsul(containerID, containerIP, dm.cfg.Registry.Address, routes); err != nil {
+        return fmt.Errorf("%w: %v", ErrRegistry, err)
+    }
+    return nil
+}
+
+// deregisterServices removes the container from the configured registry backend
+func (dm *DockerManager) deregisterServices(containerID string) error {
+    if dm.cfg.Registry.Backend == "none" {
+        return nil
+    }
+    if err := dm.deregisterFromConsul(containerID, dm.cfg.Registry.Address); err != nil {
+        return fmt.Errorf("%w: %v", ErrRegistry, err)
+    }
+    return nil
+}
+
 // Add at the top after type definitions
 type ImageInfo struct {
     ID          string   `json:"id"`
@@ -351,8 +640,15 @@ type ImageInfo struct {
     Description string   `json:"description"`
     Category    string   `json:"category"`
     Tags        []string `json:"tags"`
+    Resources   *config.Resources `json:"resources,omitempty"` // Defaults overriding the global ones
+    FilePaths   []string `json:"file_paths,omitempty"` // Directories files may be transferred under, the server default when empty
+    CDP         bool     `json:"cdp,omitempty"` // Chromium can be driven over the Chrome DevTools Protocol
 }
 
+// availableImages is the catalog sessions are created from. Every image
+// serves VNC on 5901 and noVNC on 6901, which the sessions are routed to;
+// containers_images/docker-chromium serves a KasmVNC desktop on 3000 instead
+// and is therefore not listed.
 var availableImages = []ImageInfo{
     // Generic Ubuntu images
     {
@@ -368,6 +664,7 @@ var availableImages = []ImageInfo{
         Description: "Ubuntu with Chromium browser",
         Category:    "Generic Ubuntu",
         Tags:        []string{"ubuntu", "chromium", "browser"},
+        CDP:         true,
     },
     {
         ID:          "ubuntu-firefox",
@@ -383,6 +680,7 @@ var availableImages = []ImageInfo{
         Description: "Ubuntu with Mesa3D and VirtualGL support",
         Category:    "Generic Ubuntu",
         Tags:        []string{"ubuntu", "opengl", "graphics", "3d"},
+        Resources:   &config.Resources{CPUs: 4, Memory: "4g"},
     },
     // Generic Debian images
     {
@@ -398,6 +696,7 @@ var availableImages = []ImageInfo{
         Description: "Debian with Chromium browser",
         Category:    "Generic Debian",
         Tags:        []string{"debian", "chromium", "browser"},
+        CDP:         true,
     },
     {
         ID:          "debian-firefox",
@@ -413,6 +712,7 @@ var availableImages = []ImageInfo{
         Description: "Ubuntu with Blender for 3D modeling",
         Category:    "Graphics and Modeling",
         Tags:        []string{"ubuntu", "blender", "3d", "modeling"},
+        Resources:   &config.Resources{CPUs: 4, Memory: "4g"},
     },
     {
         ID:          "ubuntu-drawio",
@@ -427,6 +727,7 @@ var availableImages = []ImageInfo{
         Description: "Ubuntu with FreeCAD for CAD modeling",
         Category:    "Graphics and Modeling",
         Tags:        []string{"ubuntu", "freecad", "cad", "modeling"},
+        Resources:   &config.Resources{CPUs: 4, Memory: "4g"},
     },
     {
         ID:          "ubuntu-gimp",
@@ -477,10 +778,21 @@ var availableImages = []ImageInfo{
         Description: "Debian with Visual Studio Code",
         Category:    "Development",
         Tags:        []string{"debian", "vscode", "ide", "development"},
+        Resources:   &config.Resources{Memory: "4g"},
     },
 }
 
 // Add this method to DockerManager
 func (dm *DockerManager) ListAvailableImages() []ImageInfo {
     return availableImages
+}
+
+// findImage looks up a catalog image by its ID
+func findImage(imageID string) *ImageInfo {
+    for i := range availableImages {
+        if availableImages[i].ID == imageID {
+            return &availableImages[i]
+        }
+    }
+    return nil
 }
\ No newline at end of file
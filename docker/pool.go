@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// warmContainer is a started, registered and healthy container waiting to be handed out
+type warmContainer struct {
+	containerID string
+	containerIP string
+}
+
+// warmPool keeps idle containers per catalog image ID
+type warmPool struct {
+	sync.Mutex
+	size    map[string]int
+	idle    map[string][]warmContainer
+	filling map[string]int
+}
+
+func newWarmPool(sizes map[string]int) *warmPool {
+	pool := &warmPool{
+		size:    make(map[string]int),
+		idle:    make(map[string][]warmContainer),
+		filling: make(map[string]int),
+	}
+	for imageID, size := range sizes {
+		if findImage(imageID) == nil {
+			log.Printf("Ignoring warm pool for unknown image ID: %s", imageID)
+			continue
+		}
+		pool.size[imageID] = size
+	}
+	return pool
+}
+
+// take removes the oldest idle container for the image from the pool
+func (p *warmPool) take(imageID string) (warmContainer, bool) {
+	p.Lock()
+	defer p.Unlock()
+	idle := p.idle[imageID]
+	if len(idle) == 0 {
+		return warmContainer{}, false
+	}
+	wc := idle[0]
+	p.idle[imageID] = idle[1:]
+	return wc, true
+}
+
+// remove drops a container from the pool, returning the image it was kept for
+func (p *warmPool) remove(containerID string) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+	for imageID, idle := range p.idle {
+		for i, wc := range idle {
+			if wc.containerID == containerID {
+				p.idle[imageID] = append(idle[:i:i], idle[i+1:]...)
+				return imageID, true
+			}
+		}
+	}
+	return "", false
+}
+
+// startWarmPool fills the pool for every configured image
+func (dm *DockerManager) startWarmPool() {
+	for imageID, size := range dm.pool.size {
+		log.Printf("Warming %d container(s) for image %s", size, imageID)
+		go dm.fillPool(imageID)
+	}
+}
+
+// Backoff between failed warm-ups of an image
+const (
+	warmRetryMin = 5 * time.Second
+	warmRetryMax = 5 * time.Minute
+)
+
+// fillPool starts containers until the pool for the image reaches its
+// configured size. Failed warm-ups are retried with exponential backoff, so a
+// registry or Consul outage does not leave the pool empty.
+func (dm *DockerManager) fillPool(imageID string) {
+	img := findImage(imageID)
+	backoff := warmRetryMin
+	for {
+		dm.pool.Lock()
+		if len(dm.pool.idle[imageID])+dm.pool.filling[imageID] >= dm.pool.size[imageID] {
+			dm.pool.Unlock()
+			return
+		}
+		dm.pool.filling[imageID]++
+		dm.pool.Unlock()
+
+		wc, err := dm.startWarmContainer(img)
+
+		dm.pool.Lock()
+		dm.pool.filling[imageID]--
+		if err == nil {
+			dm.pool.idle[imageID] = append(dm.pool.idle[imageID], wc)
+		}
+		dm.pool.Unlock()
+
+		if err != nil {
+			log.Printf("Error warming container for image %s, retrying in %s: %v", imageID, backoff, err)
+			time.Sleep(backoff)
+			backoff = min(2*backoff, warmRetryMax)
+			continue
+		}
+		backoff = warmRetryMin
+		log.Printf("Warm container %s ready for image %s", wc.containerID[:12], imageID)
+	}
+}
+
+// startWarmContainer starts a container with the default VNC configuration and
+// waits until it is healthy. Its services are registered without routes.
+func (dm *DockerManager) startWarmContainer(img *ImageInfo) (warmContainer, error) {
+	vncConfig := dm.cfg.DefaultVNCConfig
+	vncConfig.Password = utils.GenerateID()[:12]
+
+	resources, err := dm.resolveResources(config.Resources{}, img)
+	if err != nil {
+		return warmContainer{}, err
+	}
+
+	containerID, containerIP, err := dm.startContainer(img.Name, vncConfig, resources)
+	if err != nil {
+		return warmContainer{}, err
+	}
+
+	if err := dm.registerServices(containerID, containerIP, false); err != nil {
+		dm.cli.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+		return warmContainer{}, fmt.Errorf("unable to register with service discovery: %v", err)
+	}
+
+	if err := waitForPorts(containerIP, []int{5901, 6901}, 2*time.Minute); err != nil {
+		dm.deregisterServices(containerID)
+		dm.cli.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+		return warmContainer{}, err
+	}
+
+	return warmContainer{containerID: containerID, containerIP: containerIP}, nil
+}
+
+// takeWarmContainer hands out an idle container for the image if the requested
+// VNC configuration and resources match the ones pool containers are started with.
+func (dm *DockerManager) takeWarmContainer(imageID string, vncConfig config.VNCConfig, resources config.Resources) (warmContainer, bool) {
+	if !vncCompatible(vncConfig, dm.cfg.DefaultVNCConfig) {
+		return warmContainer{}, false
+	}
+	if defaults, err := dm.resolveResources(config.Resources{}, findImage(imageID)); err != nil || defaults != resources {
+		return warmContainer{}, false
+	}
+	wc, ok := dm.pool.take(imageID)
+	if ok {
+		go dm.fillPool(imageID)
+	}
+	return wc, ok
+}
+
+// claimWarmContainer re-keys the VNC password of a pool container and
+// registers its routes so it can be used as a regular session.
+func (dm *DockerManager) claimWarmContainer(wc warmContainer, vncConfig config.VNCConfig) (*ContainerEndpoints, error) {
+	if vncConfig.Password == "" {
+		vncConfig.Password = utils.GenerateID()[:12]
+	}
+
+	if err := dm.setVNCPassword(wc.containerID, vncConfig.Password); err != nil {
+		dm.discardWarmContainer(wc)
+		return nil, err
+	}
+
+	if err := dm.registerServices(wc.containerID, wc.containerIP, true); err != nil {
+		dm.discardWarmContainer(wc)
+		return nil, fmt.Errorf("unable to register with service discovery: %v", err)
+	}
+
+	log.Printf("Handed out warm container %s", wc.containerID[:12])
+	return newContainerEndpoints(wc.containerID[:12]), nil
+}
+
+// discardWarmContainer removes a pool container that could not be handed out
+func (dm *DockerManager) discardWarmContainer(wc warmContainer) {
+	dm.deregisterServices(wc.containerID)
+	dm.cli.ContainerRemove(context.Background(), wc.containerID, container.RemoveOptions{Force: true})
+}
+
+// setVNCPassword replaces the password file read by the VNC server on every new connection
+func (dm *DockerManager) setVNCPassword(containerID string, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := []string{"sh", "-c", `printf '%s\n' "$VNC_PW" | vncpasswd -f > "$HOME/.vnc/passwd"`}
+	if err := dm.runInContainer(ctx, containerID, cmd, []string{"VNC_PW=" + password}); err != nil {
+		return fmt.Errorf("failed to set VNC password: %v", err)
+	}
+	return nil
+}
+
+// vncCompatible reports whether a request can be served by a container started with base
+func vncCompatible(requested config.VNCConfig, base config.VNCConfig) bool {
+	return (requested.Resolution == "" || requested.Resolution == base.Resolution) &&
+		(requested.ColDepth == 0 || requested.ColDepth == base.ColDepth) &&
+		(requested.Display == "" || requested.Display == base.Display) &&
+		requested.ViewOnly == base.ViewOnly
+}
+
+// waitForPorts polls the TCP ports of a container until they accept connections
+func waitForPorts(ip string, ports []int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, port := range ports {
+		addr := net.JoinHostPort(ip, fmt.Sprint(port))
+		for {
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("container did not become healthy: %v", err)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// QuotaUsage is what a tenant currently holds. Queued, starting and running sessions count.
+type QuotaUsage struct {
+	Sessions    int     `json:"sessions"`
+	CPUs        float64 `json:"cpus"`
+	MemoryBytes int64   `json:"memory_bytes"`
+}
+
+// QuotaLimits is the quota of a tenant as reported by the API. Zero means unlimited.
+type QuotaLimits struct {
+	MaxSessions       int      `json:"max_sessions,omitempty"`
+	MaxCPUs           float64  `json:"max_cpus,omitempty"`
+	MaxMemory         string   `json:"max_memory,omitempty"`
+	AllowedCategories []string `json:"allowed_categories,omitempty"`
+	MaxTTLSeconds     int64    `json:"max_ttl_seconds,omitempty"`
+}
+
+// QuotaReport shows the usage of a tenant against its limits
+type QuotaReport struct {
+	Tenant string      `json:"tenant"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+}
+
+// QuotaReport returns the quota and current usage of a tenant
+func (dm *DockerManager) QuotaReport(tenant string) QuotaReport {
+	quota := dm.cfg.Quotas.For(tenant)
+
+	dm.containerStats.RLock()
+	usage := dm.tenantUsage(tenant)
+	dm.containerStats.RUnlock()
+
+	return QuotaReport{
+		Tenant: tenant,
+		Limits: QuotaLimits{
+			MaxSessions:       quota.MaxSessions,
+			MaxCPUs:           quota.MaxCPUs,
+			MaxMemory:         quota.MaxMemory,
+			AllowedCategories: quota.AllowedCategories,
+			MaxTTLSeconds:     int64(quota.MaxTTL / time.Second),
+		},
+		Usage: usage,
+	}
+}
+
+// tenantUsage sums the sessions of a tenant. The caller holds the containerStats lock.
+func (dm *DockerManager) tenantUsage(tenant string) QuotaUsage {
+	var usage QuotaUsage
+	for key, status := range dm.containerStats.statuses {
+		// Ready sessions are stored under their tracking and container IDs, count them once
+		if key != status.TrackingID || status.Tenant != tenant || status.Status == "failed" {
+			continue
+		}
+		usage.Sessions++
+		if status.Resources != nil {
+			usage.CPUs += status.Resources.CPUs
+			usage.MemoryBytes += sizeInBytes(status.Resources.Memory)
+		}
+	}
+	return usage
+}
+
+// checkQuotaAccess verifies the parts of a quota that do not depend on usage
+// and returns the session TTL, defaulting to the tenant maximum.
+func checkQuotaAccess(quota config.Quota, img *ImageInfo, ttl time.Duration) (time.Duration, error) {
+	if len(quota.AllowedCategories) > 0 && !slices.Contains(quota.AllowedCategories, img.Category) {
+		return 0, fmt.Errorf("%w: image category %q is not allowed for this tenant", ErrNotPermitted, img.Category)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("%w: must not be negative", ErrInvalidTTL)
+	}
+	if quota.MaxTTL > 0 {
+		if ttl == 0 {
+			return quota.MaxTTL, nil
+		}
+		if ttl > quota.MaxTTL {
+			return 0, fmt.Errorf("%w: ttl %s exceeds the tenant maximum of %s", ErrNotPermitted, ttl, quota.MaxTTL)
+		}
+	}
+	return ttl, nil
+}
+
+// checkQuotaUsage verifies that a tenant can hold one more session with the
+// given resources. The caller holds the containerStats lock.
+func (dm *DockerManager) checkQuotaUsage(tenant string, quota config.Quota, res config.Resources) error {
+	usage := dm.tenantUsage(tenant)
+	if quota.MaxSessions > 0 && usage.Sessions+1 > quota.MaxSessions {
+		return fmt.Errorf("%w: tenant already holds %d of %d sessions", ErrQuotaExceeded, usage.Sessions, quota.MaxSessions)
+	}
+	if quota.MaxCPUs > 0 && usage.CPUs+res.CPUs > quota.MaxCPUs {
+		return fmt.Errorf("%w: %g more CPUs would exceed the tenant limit of %g (%g in use)", ErrQuotaExceeded, res.CPUs, quota.MaxCPUs, usage.CPUs)
+	}
+	if quota.MaxMemory != "" {
+		limit := sizeInBytes(quota.MaxMemory)
+		if usage.MemoryBytes+sizeInBytes(res.Memory) > limit {
+			return fmt.Errorf("%w: %s more memory would exceed the tenant limit of %s (%s in use)",
+				ErrQuotaExceeded, res.Memory, quota.MaxMemory, units.BytesSize(float64(usage.MemoryBytes)))
+		}
+	}
+	return nil
+}
+
+// ExtendContainer moves the expiry of a ready session to ttl from now,
+// within the maximum lifetime allowed for its tenant.
+func (dm *DockerManager) ExtendContainer(id string, ttl time.Duration) (*ContainerStatus, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("%w: must be positive", ErrInvalidTTL)
+	}
+
+	dm.containerStats.Lock()
+	status, ok := dm.containerStats.statuses[id]
+	if !ok {
+		dm.containerStats.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if status.Status != "ready" || status.StartedAt == nil {
+		dm.containerStats.Unlock()
+		return nil, fmt.Errorf("%w: session %s is %s", ErrNotReady, id, status.Status)
+	}
+	expiresAt := time.Now().Add(ttl)
+	if maxTTL := dm.cfg.Quotas.For(status.Tenant).MaxTTL; maxTTL > 0 && expiresAt.Sub(*status.StartedAt) > maxTTL {
+		dm.containerStats.Unlock()
+		return nil, fmt.Errorf("%w: sessions of this tenant may run for at most %s", ErrNotPermitted, maxTTL)
+	}
+	status.ExpiresAt = &expiresAt
+	dm.containerStats.Unlock()
+
+	return dm.GetContainerStatus(id), nil
+}
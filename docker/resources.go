@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// resolveResources fills unset fields from the image and configuration defaults
+// and checks the result against the configured maxima.
+func (dm *DockerManager) resolveResources(requested config.Resources, img *ImageInfo) (config.Resources, error) {
+	layers := []config.Resources{requested, dm.cfg.DefaultResources}
+	if img.Resources != nil {
+		layers = []config.Resources{requested, *img.Resources, dm.cfg.DefaultResources}
+	}
+
+	var res config.Resources
+	for _, layer := range layers {
+		if res.CPUs == 0 {
+			res.CPUs = layer.CPUs
+		}
+		if res.Memory == "" {
+			res.Memory = layer.Memory
+		}
+		if res.MemorySwap == "" {
+			res.MemorySwap = layer.MemorySwap
+		}
+		if res.PidsLimit == 0 {
+			res.PidsLimit = layer.PidsLimit
+		}
+		if res.ShmSize == "" {
+			res.ShmSize = layer.ShmSize
+		}
+	}
+	// Docker would allow swap of twice the memory limit, which can exceed the
+	// configured maximum, so sessions without a swap limit get no swap
+	if res.Memory != "" && res.MemorySwap == "" {
+		res.MemorySwap = res.Memory
+	}
+
+	limits := dm.cfg.MaxResources
+	if res.CPUs < 0 {
+		return res, fmt.Errorf("%w: cpus must be positive", ErrInvalidResources)
+	}
+	if limits.CPUs > 0 && res.CPUs > limits.CPUs {
+		return res, fmt.Errorf("%w: cpus %g exceeds maximum %g", ErrInvalidResources, res.CPUs, limits.CPUs)
+	}
+	if res.PidsLimit < 0 {
+		return res, fmt.Errorf("%w: pids_limit must be positive", ErrInvalidResources)
+	}
+	if limits.PidsLimit > 0 && res.PidsLimit > limits.PidsLimit {
+		return res, fmt.Errorf("%w: pids_limit %d exceeds maximum %d", ErrInvalidResources, res.PidsLimit, limits.PidsLimit)
+	}
+	for _, size := range []struct{ name, value, max string }{
+		{"memory", res.Memory, limits.Memory},
+		{"memory_swap", res.MemorySwap, limits.MemorySwap},
+		{"shm_size", res.ShmSize, limits.ShmSize},
+	} {
+		if err := checkSize(size.name, size.value, size.max); err != nil {
+			return res, err
+		}
+	}
+
+	if res.Memory != "" && res.MemorySwap != "" && sizeInBytes(res.MemorySwap) < sizeInBytes(res.Memory) {
+		return res, fmt.Errorf("%w: memory_swap %s is lower than memory %s", ErrInvalidResources, res.MemorySwap, res.Memory)
+	}
+
+	return res, nil
+}
+
+// checkSize validates a size string against an optional maximum
+func checkSize(name string, value string, max string) error {
+	if value == "" {
+		return nil
+	}
+	n, err := units.RAMInBytes(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%w: %s %q is not a valid size", ErrInvalidResources, name, value)
+	}
+	if max == "" {
+		return nil
+	}
+	limit, err := units.RAMInBytes(max)
+	if err != nil {
+		return fmt.Errorf("invalid maximum for %s: %q", name, max)
+	}
+	if n > limit {
+		return fmt.Errorf("%w: %s %s exceeds maximum %s", ErrInvalidResources, name, value, max)
+	}
+	return nil
+}
+
+// applyResources sets the resolved resources on a container host config
+func applyResources(hostConfig *container.HostConfig, res config.Resources) {
+	hostConfig.NanoCPUs = int64(res.CPUs * 1e9)
+	hostConfig.Memory = sizeInBytes(res.Memory)
+	hostConfig.MemorySwap = sizeInBytes(res.MemorySwap)
+	hostConfig.ShmSize = sizeInBytes(res.ShmSize)
+	if res.PidsLimit > 0 {
+		pids := res.PidsLimit
+		hostConfig.PidsLimit = &pids
+	}
+}
+
+// sizeInBytes converts a size already checked by resolveResources, 0 when unset
+func sizeInBytes(size string) int64 {
+	if size == "" {
+		return 0
+	}
+	n, _ := units.RAMInBytes(size)
+	return n
+}
@@ -0,0 +1,150 @@
+package docker
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// queuedRequest is a creation request waiting for capacity
+type queuedRequest struct {
+	trackingID string
+	imageID    string
+	priority   int
+	seq        uint64
+	start      func()
+}
+
+// scheduler admits creation requests according to the configured capacity.
+// Requests are served by priority, then in arrival order. A request whose
+// image is at its limit does not hold back requests for other images.
+type scheduler struct {
+	sync.Mutex
+	limits   config.CapacityConfig
+	queue    []*queuedRequest
+	seq      uint64
+	starting int
+	sessions int
+	perImage map[string]int
+	holders  map[string]string // tracking ID -> image ID of admitted requests
+	pending  map[string]bool   // tracking IDs still being created
+}
+
+func newScheduler(limits config.CapacityConfig) *scheduler {
+	return &scheduler{
+		limits:   limits,
+		perImage: make(map[string]int),
+		holders:  make(map[string]string),
+		pending:  make(map[string]bool),
+	}
+}
+
+// enqueue adds a request to the queue and dispatches whatever fits
+func (s *scheduler) enqueue(req *queuedRequest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.limits.MaxQueueLength > 0 && len(s.queue) >= s.limits.MaxQueueLength && !s.admissible(req.imageID) {
+		return ErrCapacityExceeded
+	}
+
+	s.seq++
+	req.seq = s.seq
+	s.queue = append(s.queue, req)
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		if s.queue[i].priority != s.queue[j].priority {
+			return s.queue[i].priority > s.queue[j].priority
+		}
+		return s.queue[i].seq < s.queue[j].seq
+	})
+	s.dispatch()
+	return nil
+}
+
+// started marks a request as done creating while it keeps its session slot
+func (s *scheduler) started(trackingID string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.pending[trackingID] {
+		delete(s.pending, trackingID)
+		s.starting--
+	}
+	s.dispatch()
+}
+
+// release frees the slot held by a request. It is safe to call more than once.
+func (s *scheduler) release(trackingID string) {
+	s.Lock()
+	defer s.Unlock()
+	imageID, ok := s.holders[trackingID]
+	if !ok {
+		return
+	}
+	delete(s.holders, trackingID)
+	s.sessions--
+	s.perImage[imageID]--
+	if s.pending[trackingID] {
+		delete(s.pending, trackingID)
+		s.starting--
+	}
+	s.dispatch()
+}
+
+// cancel removes a request from the queue. It reports false if the request
+// is not queued, because it was already admitted or never enqueued.
+func (s *scheduler) cancel(trackingID string) bool {
+	s.Lock()
+	defer s.Unlock()
+	for i, req := range s.queue {
+		if req.trackingID == trackingID {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// position returns the 1-based queue position of a request, or 0 if it is not queued
+func (s *scheduler) position(trackingID string) int {
+	s.Lock()
+	defer s.Unlock()
+	for i, req := range s.queue {
+		if req.trackingID == trackingID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// admissible reports whether a request for the image could start right now
+func (s *scheduler) admissible(imageID string) bool {
+	if s.limits.MaxConcurrentStarts > 0 && s.starting >= s.limits.MaxConcurrentStarts {
+		return false
+	}
+	if s.limits.MaxSessions > 0 && s.sessions >= s.limits.MaxSessions {
+		return false
+	}
+	if limit := s.limits.MaxSessionsPerImage[imageID]; limit > 0 && s.perImage[imageID] >= limit {
+		return false
+	}
+	return true
+}
+
+// dispatch starts queued requests while capacity allows. Callers hold the lock.
+func (s *scheduler) dispatch() {
+	for i := 0; i < len(s.queue); {
+		req := s.queue[i]
+		if !s.admissible(req.imageID) {
+			i++
+			continue
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.holders[req.trackingID] = req.imageID
+		s.pending[req.trackingID] = true
+		s.sessions++
+		s.starting++
+		s.perImage[req.imageID]++
+		go req.start()
+	}
+}
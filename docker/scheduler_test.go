@@ -0,0 +1,307 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// testScheduler records the requests its scheduler starts
+type testScheduler struct {
+	*scheduler
+	starts chan string
+}
+
+func newTestScheduler(limits config.CapacityConfig) *testScheduler {
+	return &testScheduler{scheduler: newScheduler(limits), starts: make(chan string, 100)}
+}
+
+func (ts *testScheduler) enqueue(t *testing.T, trackingID, imageID string, priority int) error {
+	t.Helper()
+	return ts.scheduler.enqueue(&queuedRequest{
+		trackingID: trackingID,
+		imageID:    imageID,
+		priority:   priority,
+		start:      func() { ts.starts <- trackingID },
+	})
+}
+
+// expectStarted waits for the given requests to start, in any order
+func (ts *testScheduler) expectStarted(t *testing.T, trackingIDs ...string) {
+	t.Helper()
+	want := make(map[string]bool)
+	for _, id := range trackingIDs {
+		want[id] = true
+	}
+	for range trackingIDs {
+		select {
+		case id := <-ts.starts:
+			if !want[id] {
+				t.Fatalf("%s started, want one of %v", id, trackingIDs)
+			}
+			delete(want, id)
+		case <-time.After(time.Second):
+			t.Fatalf("requests %v did not start", trackingIDs)
+		}
+	}
+	ts.expectNone(t)
+}
+
+// expectNone checks that no further request starts
+func (ts *testScheduler) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-ts.starts:
+		t.Fatalf("%s started unexpectedly", id)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func (ts *testScheduler) expectCounts(t *testing.T, starting, sessions int, perImage map[string]int) {
+	t.Helper()
+	ts.Lock()
+	defer ts.Unlock()
+	if ts.starting != starting || ts.sessions != sessions {
+		t.Errorf("starting=%d sessions=%d, want %d and %d", ts.starting, ts.sessions, starting, sessions)
+	}
+	for imageID, n := range perImage {
+		if ts.perImage[imageID] != n {
+			t.Errorf("perImage[%s]=%d, want %d", imageID, ts.perImage[imageID], n)
+		}
+	}
+}
+
+// testRequest is a request enqueued with a priority
+type testRequest struct {
+	id       string
+	priority int
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []testRequest
+		order    []string
+	}{
+		{
+			name:     "equal priorities in arrival order",
+			requests: []testRequest{{"a", 0}, {"b", 0}, {"c", 0}},
+			order:    []string{"a", "b", "c"},
+		},
+		{
+			name:     "higher priorities first",
+			requests: []testRequest{{"low", -5}, {"normal", 0}, {"high", 10}, {"higher", 20}},
+			order:    []string{"higher", "high", "normal", "low"},
+		},
+		{
+			name:     "arrival order within a priority",
+			requests: []testRequest{{"a", 1}, {"b", 5}, {"c", 1}, {"d", 5}},
+			order:    []string{"b", "d", "a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestScheduler(config.CapacityConfig{MaxSessions: 1})
+			// The first request holds the only slot, so the others queue
+			if err := ts.enqueue(t, "blocker", "img", 0); err != nil {
+				t.Fatal(err)
+			}
+			ts.expectStarted(t, "blocker")
+			for _, req := range tt.requests {
+				if err := ts.enqueue(t, req.id, "img", req.priority); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, id := range tt.order {
+				if pos := ts.position(id); pos != 1 {
+					t.Errorf("%s at queue position %d, want 1", id, pos)
+				}
+				previous := "blocker"
+				if i > 0 {
+					previous = tt.order[i-1]
+				}
+				ts.release(previous)
+				ts.expectStarted(t, id)
+			}
+		})
+	}
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  config.CapacityConfig
+		enqueue []string // tracking IDs, the image is the part before the dash
+		started []string
+	}{
+		{
+			name:    "unlimited",
+			limits:  config.CapacityConfig{},
+			enqueue: []string{"a-1", "a-2", "b-1"},
+			started: []string{"a-1", "a-2", "b-1"},
+		},
+		{
+			name:    "max sessions",
+			limits:  config.CapacityConfig{MaxSessions: 2},
+			enqueue: []string{"a-1", "b-1", "a-2"},
+			started: []string{"a-1", "b-1"},
+		},
+		{
+			name:    "max concurrent starts",
+			limits:  config.CapacityConfig{MaxConcurrentStarts: 1},
+			enqueue: []string{"a-1", "a-2"},
+			started: []string{"a-1"},
+		},
+		{
+			name:    "image at its limit does not hold back other images",
+			limits:  config.CapacityConfig{MaxSessionsPerImage: map[string]int{"a": 1}},
+			enqueue: []string{"a-1", "a-2", "b-1", "b-2"},
+			started: []string{"a-1", "b-1", "b-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestScheduler(tt.limits)
+			for _, id := range tt.enqueue {
+				if err := ts.enqueue(t, id, id[:1], 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts.expectStarted(t, tt.started...)
+			ts.expectCounts(t, len(tt.started), len(tt.started), nil)
+		})
+	}
+}
+
+func TestSchedulerStarted(t *testing.T) {
+	ts := newTestScheduler(config.CapacityConfig{MaxConcurrentStarts: 1, MaxSessions: 2})
+	for _, id := range []string{"a", "b", "c"} {
+		if err := ts.enqueue(t, id, "img", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts.expectStarted(t, "a")
+
+	// A started session frees its start slot but keeps its session slot
+	ts.started("a")
+	ts.expectStarted(t, "b")
+	ts.started("b")
+	ts.expectNone(t)
+	ts.expectCounts(t, 0, 2, map[string]int{"img": 2})
+
+	ts.release("a")
+	ts.expectStarted(t, "c")
+	ts.expectCounts(t, 1, 2, map[string]int{"img": 2})
+}
+
+func TestSchedulerDoubleRelease(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps func(ts *testScheduler)
+	}{
+		{"release twice", func(ts *testScheduler) {
+			ts.release("a")
+			ts.release("a")
+		}},
+		{"release after started", func(ts *testScheduler) {
+			ts.started("a")
+			ts.release("a")
+			ts.release("a")
+		}},
+		{"started after release", func(ts *testScheduler) {
+			ts.release("a")
+			ts.started("a")
+		}},
+		{"release of an unknown request", func(ts *testScheduler) {
+			ts.release("unknown")
+			ts.release("a")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestScheduler(config.CapacityConfig{MaxSessions: 1, MaxSessionsPerImage: map[string]int{"img": 1}})
+			for _, id := range []string{"a", "b", "c"} {
+				if err := ts.enqueue(t, id, "img", 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts.expectStarted(t, "a")
+
+			tt.steps(ts)
+			// Only one slot was freed, so only the next request starts
+			ts.expectStarted(t, "b")
+			ts.expectCounts(t, 1, 1, map[string]int{"img": 1})
+		})
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	ts := newTestScheduler(config.CapacityConfig{MaxSessions: 1})
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := ts.enqueue(t, id, "img", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts.expectStarted(t, "a")
+
+	tests := []struct {
+		id        string
+		cancelled bool
+	}{
+		{"a", false}, // Already admitted
+		{"c", true},
+		{"c", false}, // No longer queued
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if got := ts.cancel(tt.id); got != tt.cancelled {
+			t.Errorf("cancel(%s) = %v, want %v", tt.id, got, tt.cancelled)
+		}
+	}
+	if pos := ts.position("d"); pos != 2 {
+		t.Errorf("d at queue position %d after cancelling c, want 2", pos)
+	}
+
+	ts.release("a")
+	ts.expectStarted(t, "b")
+	ts.release("b")
+	ts.expectStarted(t, "d")
+	ts.expectCounts(t, 1, 1, nil)
+}
+
+func TestSchedulerFullQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		imageID string
+		err     error
+	}{
+		{"request that has to wait", "a", ErrCapacityExceeded},
+		{"request that can start right away", "b", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestScheduler(config.CapacityConfig{MaxQueueLength: 2, MaxSessionsPerImage: map[string]int{"a": 1}})
+			for _, id := range []string{"a-1", "a-2", "a-3"} {
+				if err := ts.enqueue(t, id, "a", 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts.expectStarted(t, "a-1")
+
+			err := ts.enqueue(t, "new", tt.imageID, 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("enqueue returned %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if pos := ts.position("new"); pos != 0 {
+					t.Errorf("rejected request at queue position %d", pos)
+				}
+				ts.expectNone(t)
+				return
+			}
+			ts.expectStarted(t, "new")
+		})
+	}
+}
@@ -1,13 +1,33 @@
 package docker
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
 
 // ContainerStatus represents the current state of a container
 type ContainerStatus struct {
-	Status    string             `json:"status"`
-	Message   string            `json:"message"`
-	Endpoints *ContainerEndpoints `json:"endpoints,omitempty"`
-	Error     string            `json:"error,omitempty"`
+	TrackingID    string              `json:"tracking_id"`
+	Status        string              `json:"status"`
+	Message       string              `json:"message"`
+	Owner         string              `json:"owner,omitempty"`
+	Tenant        string              `json:"tenant,omitempty"`
+	ImageID       string              `json:"image_id,omitempty"` // Catalog image of the session
+	Labels        map[string]string   `json:"labels,omitempty"`
+	BatchID       string              `json:"batch_id,omitempty"` // Batch the session was created in
+	Recording     bool                `json:"recording,omitempty"` // Recorded from the moment it was ready, as requested at creation
+	QueuePosition int                 `json:"queue_position,omitempty"`
+	Resources     *config.Resources   `json:"resources,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	StartedAt     *time.Time          `json:"started_at,omitempty"`
+	ExpiresAt     *time.Time          `json:"expires_at,omitempty"` // Set once the session is ready, when it has a TTL
+	ExitedAt      *time.Time          `json:"exited_at,omitempty"`  // Set once the container exited, its logs remain until it is removed
+	Endpoints     *ContainerEndpoints `json:"endpoints,omitempty"`
+	Error         string              `json:"error,omitempty"`
+
+	vncPassword string // Never sent to clients, viewers connect through access links
 }
 
 // containerStatusMap maintains a thread-safe map of container statuses
@@ -20,8 +40,7 @@ type containerStatusMap struct {
 type ContainerEndpoints struct {
     ContainerID  string `json:"container_id"`
     ChatAPIPath  string `json:"chat_api_path"`
-    NoVNCPath    string `json:"novnc_path"`
-    VNCPath      string `json:"vnc_path"`
+    CDPWSURL     string `json:"cdp_ws_url,omitempty"` // Chrome DevTools Protocol WebSocket URL of browser images, under public_url
 }
 
 // ConsulServiceRegistration represents the registration payload for Consul
@@ -24,9 +24,123 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/audit": {
+            "get": {
+                "description": "List recorded management actions, newest first. Operators see every event, tenant admins the events of their tenant.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Query the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subject that took the action",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant of the actor or session",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, e.g. session.create",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session tracking ID",
+                        "name": "session",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 start time",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 end time",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum events returned (default 100, at most 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/audit.Event"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/containers": {
+            "get": {
+                "description": "List the sessions visible to the caller: their own, their tenant's for tenant admins, or all for operators",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "List containers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. suite=login,env!=prod",
+                        "name": "selector",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/docker.ContainerStatus"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid label selector",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Create a new container from a specified image",
+                "description": "Create a new container from a specified image. Requests retried with the same Idempotency-Key and body return the original session instead of creating another one.",
                 "consumes": [
                     "application/json"
                 ],
@@ -46,6 +160,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.CreateContainerRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client-chosen key, remembered per caller for the retention window",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -56,15 +176,224 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid request body, image or resources; field errors are listed in details.fields",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Image category or TTL not allowed by the tenant quota, or priority set by a caller other than an operator",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Idempotency-Key reused with a different body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Creation queue is full or tenant quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/batch": {
+            "post": {
+                "description": "Queue several sessions at once, count copies of spec or one per entry of items, under a single batch ID. Each session is subject to the tenant quota and the creation queue; sessions that cannot be queued are reported with their error, the others are created. Retries with the same Idempotency-Key and body return the original batch.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "batches"
+                ],
+                "summary": "Create a batch of containers",
+                "parameters": [
+                    {
+                        "description": "Sessions to create",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateBatchRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client-chosen key, remembered per caller for the retention window",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateBatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "No session allowed by the tenant quota, or priority set by a caller other than an operator",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A request with the same Idempotency-Key is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Idempotency-Key reused with a different body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "No session could be queued",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/batch/{batchID}": {
+            "get": {
+                "description": "Get the aggregated status of a batch and the status of each of its sessions",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "batches"
+                ],
+                "summary": "Get batch status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Batch ID",
+                        "name": "batchID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/docker.BatchStatus"
+                        }
+                    },
+                    "404": {
+                        "description": "Batch not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/bulk/kill": {
+            "post": {
+                "description": "Kill every session of a batch and/or matching a label selector that the caller may access. Queued sessions leave the queue and failed ones are dismissed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "batches"
+                ],
+                "summary": "Kill sessions in bulk",
+                "parameters": [
+                    {
+                        "description": "Sessions to kill",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Neither batch_id nor selector given, or invalid selector",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/bulk/stop": {
+            "post": {
+                "description": "Stop every session of a batch and/or matching a label selector that the caller may access, giving each container 10 seconds to shut down. Queued sessions leave the queue and failed ones are dismissed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "batches"
+                ],
+                "summary": "Stop sessions in bulk",
+                "parameters": [
+                    {
+                        "description": "Sessions to stop",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Neither batch_id nor selector given, or invalid selector",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
@@ -96,19 +425,16 @@ const docTemplate = `{
                 }
             }
         },
-        "/containers/{id}/status": {
+        "/containers/{id}/access-links": {
             "get": {
-                "description": "Get the current status of a container",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "List the unexpired access links of a session with their uses and revocation state",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "containers"
                 ],
-                "summary": "Get container status",
+                "summary": "List desktop access links",
                 "parameters": [
                     {
                         "type": "string",
@@ -122,70 +448,1650 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/docker.ContainerStatus"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/access.Link"
+                            }
                         }
                     },
                     "404": {
                         "description": "Container not found",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "config.VNCConfig": {
-            "type": "object",
-            "properties": {
-                "colDepth": {
-                    "type": "integer"
-                },
-                "display": {
-                    "type": "string"
-                },
-                "password": {
-                    "type": "string"
-                },
-                "resolution": {
-                    "type": "string"
-                },
-                "viewOnly": {
-                    "type": "boolean"
+            },
+            "post": {
+                "description": "Mint a short-lived signed link to the desktop of a ready session. The VNC password never leaves the server; the orchestrator authenticates to the VNC server on behalf of the viewer. View-only and interactive links to the same session can be minted side by side, each with its own expiry and number of uses.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Mint a desktop access link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Link options",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAccessLinkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AccessLinkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/access-links/{linkID}": {
+            "delete": {
+                "description": "Revoke an access link and disconnect the viewers using it",
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Revoke a desktop access link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access link ID",
+                        "name": "linkID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Container or link not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/cdp": {
+            "get": {
+                "description": "Proxy the Chrome DevTools Protocol of the Chromium browser of a ready session, for images with cdp set in the catalog. The endpoint is cdp_ws_url of the container endpoints: WebSocket clients such as Puppeteer's connect with browserWSEndpoint are connected to the browser target, other requests get /json/version. The DevTools HTTP endpoints below it, e.g. /json/version used by Playwright's connectOverCDP, are passed on with the URLs in their responses pointing back at this endpoint. Chromium is started with remote debugging on the desktop of the session when it is not running yet. Clients send the API credentials as headers.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Connect to the browser of a session over CDP",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching to the DevTools WebSocket of the browser"
+                    },
+                    "200": {
+                        "description": "Browser version, webSocketDebuggerUrl points at the proxy",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Request from a web page whose origin is not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found or its image has no Chromium browser",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Browser could not be started or reached",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/cdp/json/version": {
+            "get": {
+                "description": "Proxy the Chrome DevTools Protocol of the Chromium browser of a ready session, for images with cdp set in the catalog. The endpoint is cdp_ws_url of the container endpoints: WebSocket clients such as Puppeteer's connect with browserWSEndpoint are connected to the browser target, other requests get /json/version. The DevTools HTTP endpoints below it, e.g. /json/version used by Playwright's connectOverCDP, are passed on with the URLs in their responses pointing back at this endpoint. Chromium is started with remote debugging on the desktop of the session when it is not running yet. Clients send the API credentials as headers.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Connect to the browser of a session over CDP",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching to the DevTools WebSocket of the browser"
+                    },
+                    "200": {
+                        "description": "Browser version, webSocketDebuggerUrl points at the proxy",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Request from a web page whose origin is not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found or its image has no Chromium browser",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Browser could not be started or reached",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/clipboard": {
+            "get": {
+                "description": "Read the text clipboard of a ready session's desktop through its VNC server, e.g. text an agent selected and copied. Servers with the extended clipboard protocol, like TigerVNC and KasmVNC, are asked for the current clipboard. Other servers only report changes, so the text copied last since the orchestrator connected is returned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Read the clipboard of a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Clipboard"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "VNC server of the session unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Set the text clipboard of a ready session's desktop through its VNC server, so long text can be pasted with ctrl+v instead of typed. Pasting reads the text from the orchestrator's VNC connection, which stays open until something else is copied on the desktop. Servers without the extended clipboard protocol only take Latin-1 text, other characters become '?'.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Set the clipboard of a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Clipboard text",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Clipboard"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Clipboard"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid text; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "VNC server of the session unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/exec": {
+            "post": {
+                "description": "Run a command in a ready session and wait for it to finish. A non-zero exit code is not an error. Up to 1 MiB of stdout and stderr each is returned. Commands that overrun their timeout are sent SIGTERM, then SIGKILL 5 seconds later.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Run a command in a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Command",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ExecRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/docker.ExecResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/exec/stream": {
+            "get": {
+                "description": "Run a command in a ready session attached to a WebSocket, e.g. an interactive shell. Binary messages from the client are written to stdin, text messages are JSON controls: {\"type\":\"resize\",\"cols\":120,\"rows\":40} and {\"type\":\"eof\"} to close stdin. Output arrives as binary messages whose first byte is 1 for stdout or 2 for stderr; with a terminal everything is stdout. The last message is {\"type\":\"exit\",\"exit_code\":0} before the server closes the connection. Commands run for max_timeout unless a shorter timeout is given.",
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Run a command in a session over WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Program and arguments, repeated",
+                        "name": "cmd",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User or UID[:GID] to run as",
+                        "name": "user",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Working directory",
+                        "name": "working_dir",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "KEY=value, repeated",
+                        "name": "env",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Timeout in seconds",
+                        "name": "timeout_seconds",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Allocate a terminal",
+                        "name": "tty",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid command",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Request from a web page whose origin is not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/extend": {
+            "post": {
+                "description": "Set the expiry of a ready session to the given TTL from now, within the tenant maximum lifetime",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Extend a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New TTL",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ExtendContainerRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/docker.ContainerStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Lifetime exceeds the tenant maximum",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/files": {
+            "get": {
+                "description": "Download a file from a ready session, or list a directory as JSON. Paths must be under the transfer directories of the image, by default the home of the desktop user. Symlinks are followed when they resolve inside those directories. Files are streamed and limited to files.max_download_size.",
+                "produces": [
+                    "application/octet-stream",
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Download a file or list a directory",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Absolute path, e.g. /home/headless/Downloads/report.pdf",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Directory listing; files are returned as application/octet-stream",
+                        "schema": {
+                            "$ref": "#/definitions/docker.DirListing"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid path",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Path outside the transfer directories",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container or file not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "File exceeds the download limit",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Upload the request body to a file of a ready session, replacing it when it exists. The parent directory must exist and the path must be under the transfer directories of the image. The body is streamed into the container and needs a Content-Length within files.max_upload_size. The file is owned by the desktop user.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Upload a file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Absolute path, e.g. /home/headless/Desktop/brief.pdf",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "File content",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/docker.FileInfo"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid path or incomplete body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Path outside the transfer directories",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container or parent directory not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "411": {
+                        "description": "Content-Length missing",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "File exceeds the upload limit",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/input": {
+            "post": {
+                "description": "Perform input actions in order on the desktop of a ready session through its VNC server: move, click, double_click, drag, scroll, key and type. Positions are screen pixels; actions without one use the current pointer position. key takes a key name or a combination joined with +, e.g. Enter, ctrl+c or ctrl+shift+t. type enters text character by character. Input of concurrent requests is not interleaved. When an action fails the error names it, the actions before it have been performed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Send keyboard and mouse input to a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Input actions",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.InputRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/desktop.InputResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid actions; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "VNC server of the session unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/kill": {
+            "delete": {
+                "description": "Kill a session the caller may access. A running container is killed, a queued session leaves the queue and a failed one is dismissed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Kill a container",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is being created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/logs": {
+            "get": {
+                "description": "Get the stdout and stderr of a session's desktop container. Logs stay available after the container exited until it is removed. With follow=true the response streams until the container exits or the caller disconnects. Plain text interleaves both streams; with Accept: text/event-stream every line is an event named stdout or stderr, and a final end event closes the stream.",
+                "produces": [
+                    "text/plain",
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Get container logs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, Unix seconds, or a duration such as 10m counted back from now",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "all",
+                        "description": "Number of lines from the end, or all",
+                        "name": "tail",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Prefix every line with its RFC 3339 timestamp",
+                        "name": "timestamps",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Include stdout",
+                        "name": "stdout",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Include stderr",
+                        "name": "stderr",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep streaming new lines",
+                        "name": "follow",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Log lines",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameters; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found or removed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Session has no container yet",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/recordings": {
+            "get": {
+                "description": "List the recordings of a session, oldest first. Recordings outlive their session until the retention period ends, so they are listed for sessions that no longer exist too.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "recordings"
+                ],
+                "summary": "List the recordings of a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session tracking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/desktop.Recording"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/recordings/start": {
+            "post": {
+                "description": "Record the desktop of a ready session into a Motion JPEG AVI file on the orchestrator, at desktop.recording.frame_rate frames per second. The recording runs until it is stopped or the session ends. Sessions can also be recorded from the start with recording in the creation request.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "recordings"
+                ],
+                "summary": "Start recording a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/desktop.Recording"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running or already recorded",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "VNC server of the session unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/recordings/stop": {
+            "post": {
+                "description": "Stop the active recording of a session and return it once the video file is complete",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "recordings"
+                ],
+                "summary": "Stop recording a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/desktop.Recording"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found or not recorded",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/recordings/{recordingID}": {
+            "get": {
+                "description": "Download the video of a finished recording as a Motion JPEG AVI file. Recordings in progress must be stopped first.",
+                "produces": [
+                    "video/x-msvideo"
+                ],
+                "tags": [
+                    "recordings"
+                ],
+                "summary": "Download a recording",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session tracking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recording ID",
+                        "name": "recordingID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Video",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Session or recording not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Recording in progress",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/screenshot": {
+            "get": {
+                "description": "Capture the X display of a ready session through its VNC server. Captures are cached for desktop.screenshot_cache_ttl, so clients polling faster get the same image; X-Captured-At tells when it was taken. The format defaults to the Accept header, then PNG.",
+                "produces": [
+                    "image/png",
+                    "image/jpeg"
+                ],
+                "tags": [
+                    "desktop"
+                ],
+                "summary": "Capture the desktop of a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "png",
+                            "jpeg"
+                        ],
+                        "type": "string",
+                        "description": "Image format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "default": 1,
+                        "description": "Scale factor in (0, 1]",
+                        "name": "scale",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 80,
+                        "description": "JPEG quality from 1 to 100",
+                        "name": "quality",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Screenshot",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameters; field errors are listed in details.fields",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Container is not running",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "VNC server of the session unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/containers/{id}/status": {
+            "get": {
+                "description": "Get the current status of a container",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "containers"
+                ],
+                "summary": "Get container status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Container ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/docker.ContainerStatus"
+                        }
+                    },
+                    "404": {
+                        "description": "Container not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Expose runtime metrics in expvar format, including the state of the rate limiter under \"ratelimit\". Restricted to operators.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Runtime metrics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/quotas/me": {
+            "get": {
+                "description": "Get the quota of the caller's tenant and its current usage",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotas"
+                ],
+                "summary": "Show the caller's quota",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/docker.QuotaReport"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "access.Link": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_uses": {
+                    "description": "0 means unlimited",
+                    "type": "integer"
+                },
+                "revoked": {
+                    "type": "boolean"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "uses": {
+                    "type": "integer"
+                },
+                "view_only": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "audit.Event": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "params": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "session": {
+                    "type": "string"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "config.Resources": {
+            "type": "object",
+            "properties": {
+                "cpus": {
+                    "type": "number"
+                },
+                "memory": {
+                    "type": "string"
+                },
+                "memory_swap": {
+                    "type": "string"
+                },
+                "pids_limit": {
+                    "type": "integer"
+                },
+                "shm_size": {
+                    "type": "string"
+                }
+            }
+        },
+        "config.VNCConfig": {
+            "type": "object",
+            "properties": {
+                "colDepth": {
+                    "type": "integer"
+                },
+                "display": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "resolution": {
+                    "type": "string"
+                },
+                "viewOnly": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "desktop.Action": {
+            "type": "object",
+            "properties": {
+                "button": {
+                    "description": "left, middle or right, left when empty\n@example left",
+                    "type": "string"
+                },
+                "key": {
+                    "description": "Key or combination of a key action, e.g. Enter or ctrl+shift+t\n@example ctrl+c",
+                    "type": "string"
+                },
+                "scroll_x": {
+                    "description": "Wheel clicks of a scroll, positive to the right and down\n@example 3",
+                    "type": "integer"
+                },
+                "scroll_y": {
+                    "type": "integer"
+                },
+                "text": {
+                    "description": "Text of a type action",
+                    "type": "string"
+                },
+                "to_x": {
+                    "description": "End of a drag",
+                    "type": "integer"
+                },
+                "to_y": {
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "move, click, double_click, drag, scroll, key or type\n@example click",
+                    "type": "string"
+                },
+                "x": {
+                    "description": "Pointer position for move, click, double_click and scroll, and the\nstart of a drag. The current position when omitted.\n@example 640",
+                    "type": "integer"
+                },
+                "y": {
+                    "description": "@example 360",
+                    "type": "integer"
+                }
+            }
+        },
+        "desktop.InputResult": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "description": "Number of actions performed",
+                    "type": "integer"
+                },
+                "x": {
+                    "description": "Pointer position afterwards",
+                    "type": "integer"
+                },
+                "y": {
+                    "type": "integer"
+                }
+            }
+        },
+        "desktop.Recording": {
+            "type": "object",
+            "properties": {
+                "ended_at": {
+                    "type": "string"
+                },
+                "frame_rate": {
+                    "type": "integer"
+                },
+                "frames": {
+                    "type": "integer"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Why the recording ended",
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "session": {
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Bytes",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "recording, completed, failed or interrupted",
+                    "type": "string"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "docker.BatchStatus": {
+            "type": "object",
+            "properties": {
+                "batch_id": {
+                    "type": "string"
+                },
+                "counts": {
+                    "description": "Sessions per status; sessions no longer tracked count as terminated",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/docker.ContainerStatus"
+                    }
+                },
+                "status": {
+                    "description": "in_progress while sessions are queued or starting, then ready,\npartially_ready, failed or terminated",
+                    "type": "string"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "tracking_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "docker.ContainerEndpoints": {
+            "type": "object",
+            "properties": {
+                "cdp_ws_url": {
+                    "description": "Chrome DevTools Protocol WebSocket URL of browser images, under public_url",
+                    "type": "string"
+                },
+                "chat_api_path": {
+                    "type": "string"
+                },
+                "container_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "docker.ContainerStatus": {
+            "type": "object",
+            "properties": {
+                "batch_id": {
+                    "description": "Batch the session was created in",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "endpoints": {
+                    "$ref": "#/definitions/docker.ContainerEndpoints"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "exited_at": {
+                    "description": "Set once the container exited, its logs remain until it is removed",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "Set once the session is ready, when it has a TTL",
+                    "type": "string"
+                },
+                "image_id": {
+                    "description": "Catalog image of the session",
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "queue_position": {
+                    "type": "integer"
+                },
+                "recording": {
+                    "description": "Recorded from the moment it was ready, as requested at creation",
+                    "type": "boolean"
+                },
+                "resources": {
+                    "$ref": "#/definitions/config.Resources"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "tracking_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "docker.DirListing": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/docker.FileInfo"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                },
+                "truncated": {
+                    "description": "More than 1000 entries",
+                    "type": "boolean"
                 }
             }
         },
-        "docker.ContainerEndpoints": {
+        "docker.ExecResult": {
             "type": "object",
             "properties": {
-                "chat_api_path": {
-                    "type": "string"
+                "duration_ms": {
+                    "type": "integer"
                 },
-                "container_id": {
-                    "type": "string"
+                "exit_code": {
+                    "type": "integer"
                 },
-                "novnc_path": {
+                "stderr": {
                     "type": "string"
                 },
-                "vnc_path": {
+                "stdout": {
                     "type": "string"
+                },
+                "timed_out": {
+                    "type": "boolean"
+                },
+                "truncated": {
+                    "description": "Output beyond 1 MiB per stream was dropped",
+                    "type": "boolean"
                 }
             }
         },
-        "docker.ContainerStatus": {
+        "docker.FileInfo": {
             "type": "object",
             "properties": {
-                "endpoints": {
-                    "$ref": "#/definitions/docker.ContainerEndpoints"
+                "link_target": {
+                    "type": "string"
                 },
-                "error": {
+                "mod_time": {
                     "type": "string"
                 },
-                "message": {
+                "mode": {
+                    "description": "Permission bits in octal, e.g. 0644",
                     "type": "string"
                 },
-                "status": {
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "file, dir, symlink or other",
                     "type": "string"
                 }
             }
@@ -196,15 +2102,34 @@ const docTemplate = `{
                 "category": {
                     "type": "string"
                 },
+                "cdp": {
+                    "description": "Chromium can be driven over the Chrome DevTools Protocol",
+                    "type": "boolean"
+                },
                 "description": {
                     "type": "string"
                 },
+                "file_paths": {
+                    "description": "Directories files may be transferred under, the server default when empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "id": {
                     "type": "string"
                 },
                 "name": {
                     "type": "string"
                 },
+                "resources": {
+                    "description": "Defaults overriding the global ones",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/config.Resources"
+                        }
+                    ]
+                },
                 "tags": {
                     "type": "array",
                     "items": {
@@ -213,6 +2138,247 @@ const docTemplate = `{
                 }
             }
         },
+        "docker.QuotaLimits": {
+            "type": "object",
+            "properties": {
+                "allowed_categories": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "max_cpus": {
+                    "type": "number"
+                },
+                "max_memory": {
+                    "type": "string"
+                },
+                "max_sessions": {
+                    "type": "integer"
+                },
+                "max_ttl_seconds": {
+                    "type": "integer"
+                }
+            }
+        },
+        "docker.QuotaReport": {
+            "type": "object",
+            "properties": {
+                "limits": {
+                    "$ref": "#/definitions/docker.QuotaLimits"
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "usage": {
+                    "$ref": "#/definitions/docker.QuotaUsage"
+                }
+            }
+        },
+        "docker.QuotaUsage": {
+            "type": "object",
+            "properties": {
+                "cpus": {
+                    "type": "number"
+                },
+                "memory_bytes": {
+                    "type": "integer"
+                },
+                "sessions": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.AccessLinkResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_uses": {
+                    "description": "0 means unlimited",
+                    "type": "integer"
+                },
+                "novnc_path": {
+                    "description": "noVNC pages connecting through the orchestrator",
+                    "type": "string"
+                },
+                "revoked": {
+                    "type": "boolean"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "uses": {
+                    "type": "integer"
+                },
+                "view_only": {
+                    "type": "boolean"
+                },
+                "vnc_path": {
+                    "type": "string"
+                },
+                "websocket_path": {
+                    "description": "WebSocket path for other RFB clients",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BatchItem": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Why the session could not be queued",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    ]
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "status_url": {
+                    "type": "string"
+                },
+                "tracking_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BulkItem": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/models.ErrorResponse"
+                },
+                "tracking_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BulkRequest": {
+            "type": "object",
+            "properties": {
+                "batch_id": {
+                    "description": "@example 3f2a9c1b7d4e",
+                    "type": "string"
+                },
+                "selector": {
+                    "description": "@example suite=login,env!=prod",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BulkResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.BulkItem"
+                    }
+                },
+                "matched": {
+                    "type": "integer"
+                },
+                "succeeded": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.Clipboard": {
+            "type": "object",
+            "properties": {
+                "text": {
+                    "description": "Clipboard text\n@example Summarise the attached report in three bullet points.",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.CreateAccessLinkRequest": {
+            "type": "object",
+            "properties": {
+                "expires_in_seconds": {
+                    "description": "Link lifetime in seconds, the server default when 0\n@example 900",
+                    "type": "integer"
+                },
+                "max_uses": {
+                    "description": "Number of viewer connections the link allows, unlimited when 0\n@example 1",
+                    "type": "integer"
+                },
+                "view_only": {
+                    "description": "Drop keyboard, mouse and clipboard input of the viewer",
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.CreateBatchRequest": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "description": "Number of identical sessions to create from spec\n@example 20",
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "Sessions to create, instead of count and spec",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.CreateContainerRequest"
+                    }
+                },
+                "labels": {
+                    "description": "Labels added to every session of the batch",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "spec": {
+                    "description": "Session to create count times",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/handlers.CreateContainerRequest"
+                        }
+                    ]
+                }
+            }
+        },
+        "handlers.CreateBatchResponse": {
+            "type": "object",
+            "properties": {
+                "batch_id": {
+                    "type": "string"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.BatchItem"
+                    }
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "status_url": {
+                    "type": "string"
+                }
+            }
+        },
         "handlers.CreateContainerRequest": {
             "description": "Request body for creating a new container",
             "type": "object",
@@ -224,6 +2390,33 @@ const docTemplate = `{
                     "description": "The ID of the image to use for the container\n@example ubuntu-base",
                     "type": "string"
                 },
+                "labels": {
+                    "description": "Labels matched by selectors, e.g. in bulk operations",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "priority": {
+                    "description": "Queue priority, higher values are served first. Only operators may set it, within capacity.max_priority.\n@example 0",
+                    "type": "integer"
+                },
+                "recording": {
+                    "description": "Record the desktop from the moment the session is ready until it ends",
+                    "type": "boolean"
+                },
+                "resources": {
+                    "description": "CPU, memory, PID and shared memory limits, unset fields use the image and server defaults",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/config.Resources"
+                        }
+                    ]
+                },
+                "ttl_seconds": {
+                    "description": "Session lifetime in seconds once ready, 0 for the tenant maximum\n@example 3600",
+                    "type": "integer"
+                },
                 "vnc_config": {
                     "$ref": "#/definitions/config.VNCConfig"
                 }
@@ -236,10 +2429,95 @@ const docTemplate = `{
                 "container_id": {
                     "type": "string"
                 },
+                "status": {
+                    "description": "Current status of the session, for requests replayed with an Idempotency-Key it may have moved on\n@example queued",
+                    "type": "string"
+                },
                 "status_url": {
                     "type": "string"
                 }
             }
+        },
+        "handlers.ExecRequest": {
+            "type": "object",
+            "properties": {
+                "cmd": {
+                    "description": "Program and arguments, not interpreted by a shell\n@example [\"ls\", \"-la\", \"/home\"]",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "env": {
+                    "description": "Variables added to the environment of the command",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "timeout_seconds": {
+                    "description": "The command is terminated once it runs longer, the server default when 0\n@example 30",
+                    "type": "integer"
+                },
+                "user": {
+                    "description": "User or UID[:GID] to run as, the image default when empty\n@example root",
+                    "type": "string"
+                },
+                "working_dir": {
+                    "description": "Working directory, the image default when empty\n@example /tmp",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ExtendContainerRequest": {
+            "type": "object",
+            "required": [
+                "ttl_seconds"
+            ],
+            "properties": {
+                "ttl_seconds": {
+                    "description": "New remaining lifetime in seconds, counted from now\n@example 3600",
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.InputRequest": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "description": "Actions performed in order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/desktop.Action"
+                    }
+                }
+            }
+        },
+        "models.ErrorResponse": {
+            "description": "Error with a stable code, a human-readable message and the ID of the failed request",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Stable error code",
+                    "type": "string",
+                    "example": "not_found"
+                },
+                "details": {
+                    "description": "Additional context, depending on the code",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "message": {
+                    "description": "Human-readable description, not meant to be parsed",
+                    "type": "string",
+                    "example": "Container not found"
+                },
+                "request_id": {
+                    "description": "ID of the request, also sent in the X-Request-Id header",
+                    "type": "string",
+                    "example": "orchestrator/Xk2c9AbQ1-000042"
+                }
+            }
         }
     }
 }`
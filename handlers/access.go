@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/shanurrahman/orchestrator/access"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/rfb"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// CreateAccessLinkRequest represents the request body for minting an access link
+type CreateAccessLinkRequest struct {
+	// Link lifetime in seconds, the server default when 0
+	// @example 900
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty"`
+	// Drop keyboard, mouse and clipboard input of the viewer
+	ViewOnly bool `json:"view_only,omitempty"`
+	// Number of viewer connections the link allows, unlimited when 0
+	// @example 1
+	MaxUses int `json:"max_uses,omitempty"`
+}
+
+// AccessLinkResponse holds the URLs of a minted access link
+type AccessLinkResponse struct {
+	access.Link
+	// noVNC pages connecting through the orchestrator
+	NoVNCPath string `json:"novnc_path"`
+	VNCPath   string `json:"vnc_path"`
+	// WebSocket path for other RFB clients
+	WebSocketPath string `json:"websocket_path"`
+}
+
+// CreateAccessLinkHandler godoc
+// @Summary     Mint a desktop access link
+// @Description Mint a short-lived signed link to the desktop of a ready session. The VNC password never leaves the server; the orchestrator authenticates to the VNC server on behalf of the viewer. View-only and interactive links to the same session can be minted side by side, each with its own expiry and number of uses.
+// @Tags        containers
+// @Accept      json
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       request body CreateAccessLinkRequest false "Link options"
+// @Success     201 {object} AccessLinkResponse
+// @Failure     400 {object} models.ErrorResponse "Bad Request"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Router      /containers/{id}/access-links [post]
+func CreateAccessLinkHandler(dm *docker.DockerManager, links *access.Links, al *audit.Logger, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		if status.Status != "ready" {
+			utils.ErrorResponse(w, r, http.StatusConflict, models.CodeNotReady, "Container is not running")
+			return
+		}
+
+		var req CreateAccessLinkRequest
+		if r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+		ttl := cfg.Access.DefaultTTL
+		if req.ExpiresInSeconds > 0 {
+			ttl = time.Duration(req.ExpiresInSeconds) * time.Second
+		}
+		if ttl > cfg.Access.MaxTTL {
+			var errs fieldErrors
+			errs.add("expires_in_seconds", "exceeds the maximum of %d", int(cfg.Access.MaxTTL/time.Second))
+			invalidFields(w, r, errs)
+			return
+		}
+
+		var createdBy string
+		if caller := auth.FromContext(r.Context()); caller != nil {
+			createdBy = caller.Owner()
+		}
+		link, token := links.Mint(status.TrackingID, createdBy, req.ViewOnly, req.MaxUses, ttl)
+		recordAudit(al, r, audit.ActionLinkMint, status.TrackingID, map[string]interface{}{
+			"link_id":    link.ID,
+			"view_only":  link.ViewOnly,
+			"max_uses":   link.MaxUses,
+			"expires_at": link.ExpiresAt,
+		}, nil)
+
+		// noVNC joins the path to the host serving the page, which is the proxy
+		wsPath := "vnc/" + token
+		if cfg.BehindProxy {
+			wsPath = "orchestrator/" + wsPath
+		}
+		query := url.Values{"path": {wsPath}, "autoconnect": {"true"}}
+		if req.ViewOnly {
+			query.Set("view_only", "true")
+		}
+		shortID := status.Endpoints.ContainerID
+
+		utils.JSONResponse(w, http.StatusCreated, AccessLinkResponse{
+			Link:          link,
+			NoVNCPath:     fmt.Sprintf("/%s/novnc/vnc_lite.html?%s", shortID, query.Encode()),
+			VNCPath:       fmt.Sprintf("/%s/novnc/vnc.html?%s", shortID, query.Encode()),
+			WebSocketPath: "/" + wsPath,
+		})
+	}
+}
+
+// ListAccessLinksHandler godoc
+// @Summary     List desktop access links
+// @Description List the unexpired access links of a session with their uses and revocation state
+// @Tags        containers
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     200 {array} access.Link
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Router      /containers/{id}/access-links [get]
+func ListAccessLinksHandler(dm *docker.DockerManager, links *access.Links) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		utils.JSONResponse(w, http.StatusOK, links.List(status.TrackingID))
+	}
+}
+
+// RevokeAccessLinkHandler godoc
+// @Summary     Revoke a desktop access link
+// @Description Revoke an access link and disconnect the viewers using it
+// @Tags        containers
+// @Param       id path string true "Container ID"
+// @Param       linkID path string true "Access link ID"
+// @Success     204
+// @Failure     404 {object} models.ErrorResponse "Container or link not found"
+// @Router      /containers/{id}/access-links/{linkID} [delete]
+func RevokeAccessLinkHandler(dm *docker.DockerManager, links *access.Links, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		linkID := chi.URLParam(r, "linkID")
+		err := links.Revoke(status.TrackingID, linkID)
+		recordAudit(al, r, audit.ActionLinkRevoke, status.TrackingID, map[string]interface{}{"link_id": linkID}, err)
+		if err != nil {
+			utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Access link not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var vncUpgrader = websocket.Upgrader{
+	Subprotocols: []string{"binary"},
+	// The noVNC page is served by the container, the access token authenticates the viewer
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// VNCProxyHandler serves the desktop of a session over WebSocket to viewers
+// holding an access token. It authenticates to the VNC server with the
+// session password, presents an unauthenticated server to the viewer and
+// drops input for view-only links. The connection closes when the link
+// expires or is revoked.
+func VNCProxyHandler(dm *docker.DockerManager, links *access.Links, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, revoked, err := links.Use(chi.URLParam(r, "token"))
+		if err != nil && link.ID == "" {
+			utils.ErrorResponse(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
+			return
+		}
+
+		// Viewers are only known by the link they use
+		event := audit.Event{
+			Actor:   "link:" + link.ID,
+			Action:  audit.ActionLinkUse,
+			Session: link.Session,
+			Params: map[string]interface{}{
+				"link_id":     link.ID,
+				"created_by":  link.CreatedBy,
+				"view_only":   link.ViewOnly,
+				"use":         link.Uses,
+				"remote_addr": r.RemoteAddr,
+			},
+			Outcome: audit.OutcomeSuccess,
+		}
+		if status := dm.GetContainerStatus(link.Session); status != nil {
+			event.Tenant = status.Tenant
+		}
+		fail := func(err error) {
+			event.Outcome, event.Error = audit.OutcomeFailure, err.Error()
+			al.Record(event)
+		}
+		if err != nil {
+			fail(err)
+			utils.ErrorResponse(w, r, http.StatusUnauthorized, models.CodeUnauthorized, err.Error())
+			return
+		}
+
+		addr, password, err := dm.VNCTarget(link.Session)
+		if errors.Is(err, docker.ErrNotReady) {
+			fail(err)
+			utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Container is not running")
+			return
+		}
+		if err != nil {
+			fail(err)
+			log.Printf("Error resolving VNC server of session %s: %v", link.Session, err)
+			utils.ErrorResponse(w, r, http.StatusBadGateway, models.CodeDesktopUnavailable, "Desktop unavailable")
+			return
+		}
+
+		upstream, err := net.DialTimeout("tcp", addr, 10*time.Second)
+		if err != nil {
+			fail(err)
+			log.Printf("Error connecting to VNC server of session %s: %v", link.Session, err)
+			utils.ErrorResponse(w, r, http.StatusBadGateway, models.CodeDesktopUnavailable, "Desktop unavailable")
+			return
+		}
+		defer upstream.Close()
+
+		upstream.SetDeadline(time.Now().Add(10 * time.Second))
+		init, err := rfb.ClientHandshake(upstream, password)
+		if err != nil {
+			fail(err)
+			log.Printf("Error authenticating to VNC server of session %s: %v", link.Session, err)
+			utils.ErrorResponse(w, r, http.StatusBadGateway, models.CodeDesktopUnavailable, "Desktop unavailable")
+			return
+		}
+		upstream.SetDeadline(time.Time{})
+
+		ws, err := vncUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already answered the viewer
+			return
+		}
+		viewer := &wsStream{conn: ws}
+		defer viewer.Close()
+
+		if err := rfb.ServerHandshake(viewer, init); err != nil {
+			fail(err)
+			log.Printf("VNC handshake with viewer of session %s failed: %v", link.Session, err)
+			return
+		}
+		al.Record(event)
+		log.Printf("Viewer connected to session %s with link %s (view only: %v)", link.Session, link.ID, link.ViewOnly)
+
+		done := make(chan struct{}, 2)
+		go func() {
+			if link.ViewOnly {
+				rfb.FilterInput(upstream, viewer)
+			} else {
+				io.Copy(upstream, viewer)
+			}
+			done <- struct{}{}
+		}()
+		go func() {
+			io.Copy(viewer, upstream)
+			done <- struct{}{}
+		}()
+		expiry := time.NewTimer(time.Until(link.ExpiresAt))
+		defer expiry.Stop()
+		select {
+		case <-done:
+		case <-expiry.C:
+		case <-revoked:
+		}
+		log.Printf("Viewer disconnected from session %s (link %s)", link.Session, link.ID)
+	}
+}
+
+// wsStream adapts a WebSocket connection carrying binary messages to a byte stream
+type wsStream struct {
+	conn   *websocket.Conn
+	reader io.Reader
+}
+
+func (s *wsStream) Read(p []byte) (int, error) {
+	for {
+		if s.reader == nil {
+			messageType, reader, err := s.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			s.reader = reader
+		}
+		n, err := s.reader.Read(p)
+		if err == io.EOF {
+			s.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (s *wsStream) Write(p []byte) (int, error) {
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *wsStream) Close() error {
+	return s.conn.Close()
+}
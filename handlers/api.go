@@ -1,14 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
 	"github.com/shanurrahman/orchestrator/config"
 	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/idempotency"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
 )
 
 // CreateContainerHandler handles the creation of a new container
@@ -18,12 +22,15 @@ import (
 // @Accept json
 // @Produce json
 // @Success 200 {object} models.ContainerResponse
-// @Failure 500 {string} string "Internal Server Error"
+// @Failure 500 {object} models.ErrorResponse "Internal Server Error"
 // @Router /containers [post]
 // Add these types
 type CreateContainerResponse struct {
     ContainerID string `json:"container_id"`
     StatusURL   string `json:"status_url"`
+    // Current status of the session, for requests replayed with an Idempotency-Key it may have moved on
+    // @example queued
+    Status      string `json:"status,omitempty"`
 }
 
 // Add new types
@@ -34,6 +41,25 @@ type CreateContainerRequest struct {
     // @example ubuntu-base
     ImageID     string            `json:"image_id" validate:"required"`
     VNCConfig   config.VNCConfig  `json:"vnc_config,omitempty"`
+    // Queue priority, higher values are served first. Only operators may set it, within capacity.max_priority.
+    // @example 0
+    Priority    int               `json:"priority,omitempty"`
+    // CPU, memory, PID and shared memory limits, unset fields use the image and server defaults
+    Resources   config.Resources  `json:"resources,omitempty"`
+    // Session lifetime in seconds once ready, 0 for the tenant maximum
+    // @example 3600
+    TTLSeconds  int               `json:"ttl_seconds,omitempty"`
+    // Labels matched by selectors, e.g. in bulk operations
+    Labels      map[string]string `json:"labels,omitempty"`
+    // Record the desktop from the moment the session is ready until it ends
+    Recording   bool              `json:"recording,omitempty"`
+}
+
+// ExtendContainerRequest represents the request body for extending a session
+type ExtendContainerRequest struct {
+    // New remaining lifetime in seconds, counted from now
+    // @example 3600
+    TTLSeconds  int               `json:"ttl_seconds" validate:"required"`
 }
 
 // Add new handler
@@ -48,50 +74,116 @@ type CreateContainerRequest struct {
 func ListImagesHandler(dm *docker.DockerManager) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         images := dm.ListAvailableImages()
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(images)
+        utils.JSONResponse(w, http.StatusOK, images)
     }
 }
 
 // Modify CreateContainerHandler
 // CreateContainerHandler godoc
 // @Summary     Create a new container
-// @Description Create a new container from a specified image
+// @Description Create a new container from a specified image. Requests retried with the same Idempotency-Key and body return the original session instead of creating another one.
 // @Tags        containers
 // @Accept      json
 // @Produce     json
 // @Param       request body CreateContainerRequest true "Container creation request"
+// @Param       Idempotency-Key header string false "Client-chosen key, remembered per caller for the retention window"
 // @Success     200 {object} CreateContainerResponse
-// @Failure     400 {string} string "Bad Request"
-// @Failure     500 {string} string "Internal Server Error"
+// @Failure     400 {object} models.ErrorResponse "Invalid request body, image or resources; field errors are listed in details.fields"
+// @Failure     403 {object} models.ErrorResponse "Image category or TTL not allowed by the tenant quota, or priority set by a caller other than an operator"
+// @Failure     409 {object} models.ErrorResponse "A request with the same Idempotency-Key is in progress"
+// @Failure     422 {object} models.ErrorResponse "Idempotency-Key reused with a different body"
+// @Failure     429 {object} models.ErrorResponse "Creation queue is full or tenant quota exceeded"
+// @Failure     500 {object} models.ErrorResponse "Internal Server Error"
 // @Router      /containers [post]
-func CreateContainerHandler(dm *docker.DockerManager) http.HandlerFunc {
+func CreateContainerHandler(dm *docker.DockerManager, al *audit.Logger, idem *idempotency.Store) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         var req CreateContainerRequest
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-            http.Error(w, "Invalid request body", http.StatusBadRequest)
+        if !decodeRequest(w, r, &req) {
+            return
+        }
+        if errs := req.Validate(); len(errs) > 0 {
+            invalidFields(w, r, errs)
+            return
+        }
+        if !checkPriority(w, r, req.Priority) {
+            return
+        }
+
+        idempotent, replayed, ok := beginIdempotent(w, r, idem, req)
+        if !ok {
+            return
+        }
+        if replayed != "" {
+            response := CreateContainerResponse{
+                ContainerID: replayed,
+                StatusURL:   fmt.Sprintf("/containers/%s/status", replayed),
+            }
+            if status := dm.GetContainerStatus(replayed); status != nil {
+                response.Status = status.Status
+            }
+            utils.JSONResponse(w, http.StatusOK, response)
             return
         }
 
         config := docker.ContainerConfig{
             ImageID:   req.ImageID,
             VNCConfig: req.VNCConfig,
+            Priority:  req.Priority,
+            Resources: req.Resources,
+            TTL:       time.Duration(req.TTLSeconds) * time.Second,
+            Labels:    req.Labels,
+            Recording: req.Recording,
+        }
+        if id := auth.FromContext(r.Context()); id != nil {
+            config.Owner = id.Owner()
+            config.Tenant = id.Tenant
         }
 
         containerID, err := dm.CreateContainerAsync(config)
+        recordAudit(al, r, audit.ActionSessionCreate, containerID, audit.Params(req), err)
         if err != nil {
-            log.Printf("Error initiating container creation: %v", err)
-            http.Error(w, err.Error(), http.StatusBadRequest)
+            idempotent.release()
+            writeError(w, r, err)
             return
         }
+        idempotent.complete(containerID)
 
         response := CreateContainerResponse{
             ContainerID: containerID,
             StatusURL:   fmt.Sprintf("/containers/%s/status", containerID),
+            Status:      "queued",
+        }
+
+        utils.JSONResponse(w, http.StatusOK, response)
+    }
+}
+
+// ListContainersHandler godoc
+// @Summary     List containers
+// @Description List the sessions visible to the caller: their own, their tenant's for tenant admins, or all for operators
+// @Tags        containers
+// @Produce     json
+// @Param       selector query string false "Label selector, e.g. suite=login,env!=prod"
+// @Success     200 {array} docker.ContainerStatus
+// @Failure     400 {object} models.ErrorResponse "Invalid label selector"
+// @Router      /containers [get]
+func ListContainersHandler(dm *docker.DockerManager) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        selector, err := docker.ParseSelector(r.URL.Query().Get("selector"))
+        if err != nil {
+            writeError(w, r, err)
+            return
+        }
+
+        caller := auth.FromContext(r.Context())
+        visible := []*docker.ContainerStatus{}
+        for _, status := range dm.SelectSessions("", selector) {
+            if caller != nil && caller.CanAccess(status.Owner, status.Tenant) {
+                visible = append(visible, status)
+            }
         }
 
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(response)
+        utils.JSONResponse(w, http.StatusOK, visible)
     }
 }
 
@@ -103,38 +195,102 @@ func CreateContainerHandler(dm *docker.DockerManager) http.HandlerFunc {
 // @Produce     json
 // @Param       id path string true "Container ID"
 // @Success     200 {object} docker.ContainerStatus
-// @Failure     404 {string} string "Container not found"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
 // @Router      /containers/{id}/status [get]
 func GetContainerStatusHandler(dm *docker.DockerManager) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        containerID := chi.URLParam(r, "id")
-        status := dm.GetContainerStatus(containerID)
-        
+        status := sessionFromRequest(dm, w, r)
         if status == nil {
-            http.Error(w, "Container not found", http.StatusNotFound)
             return
         }
 
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(status)
+        utils.JSONResponse(w, http.StatusOK, status)
     }
 }
 
-func KillContainerHandler(dm *docker.DockerManager) http.HandlerFunc {
+// KillContainerHandler godoc
+// @Summary     Kill a container
+// @Description Kill a session the caller may access. A running container is killed, a queued session leaves the queue and a failed one is dismissed.
+// @Tags        containers
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     200 {object} map[string]string
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is being created"
+// @Failure     500 {object} models.ErrorResponse "Internal Server Error"
+// @Router      /containers/{id}/kill [delete]
+func KillContainerHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        containerID := chi.URLParam(r, "id")
-        if containerID == "" {
-            http.Error(w, "container ID is required", http.StatusBadRequest)
+        status := sessionFromRequest(dm, w, r)
+        if status == nil {
             return
         }
 
-        err := dm.KillContainer(containerID)
+        params := map[string]interface{}{"owner": status.Owner, "status": status.Status}
+        if status.Endpoints != nil {
+            params["container_id"] = status.Endpoints.ContainerID
+        }
+        err := dm.TerminateSession(status.TrackingID, 0)
+        recordAudit(al, r, audit.ActionSessionKill, status.TrackingID, params, err)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            writeError(w, r, err)
             return
         }
 
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"message": "Container killed successfully"})
+        utils.JSONResponse(w, http.StatusOK, map[string]string{"message": "Container killed successfully"})
     }
-}
\ No newline at end of file
+}
+
+// ExtendContainerHandler godoc
+// @Summary     Extend a session
+// @Description Set the expiry of a ready session to the given TTL from now, within the tenant maximum lifetime
+// @Tags        containers
+// @Accept      json
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       request body ExtendContainerRequest true "New TTL"
+// @Success     200 {object} docker.ContainerStatus
+// @Failure     400 {object} models.ErrorResponse "Bad Request"
+// @Failure     403 {object} models.ErrorResponse "Lifetime exceeds the tenant maximum"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Router      /containers/{id}/extend [post]
+func ExtendContainerHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        status := sessionFromRequest(dm, w, r)
+        if status == nil {
+            return
+        }
+
+        var req ExtendContainerRequest
+        if !decodeRequest(w, r, &req) {
+            return
+        }
+        if errs := req.Validate(); len(errs) > 0 {
+            invalidFields(w, r, errs)
+            return
+        }
+
+        extended, err := dm.ExtendContainer(status.TrackingID, time.Duration(req.TTLSeconds)*time.Second)
+        recordAudit(al, r, audit.ActionSessionExtend, status.TrackingID, audit.Params(req), err)
+        if err != nil {
+            writeError(w, r, err)
+            return
+        }
+
+        utils.JSONResponse(w, http.StatusOK, extended)
+    }
+}
+
+// sessionFromRequest resolves the {id} URL parameter to a session the caller
+// may access. Otherwise it answers 404, so callers cannot probe for the
+// sessions of others, and returns nil.
+func sessionFromRequest(dm *docker.DockerManager, w http.ResponseWriter, r *http.Request) *docker.ContainerStatus {
+    caller := auth.FromContext(r.Context())
+    status := dm.GetContainerStatus(chi.URLParam(r, "id"))
+    if status == nil || caller == nil || !caller.CanAccess(status.Owner, status.Tenant) {
+        utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Container not found")
+        return nil
+    }
+    return status
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// recordAudit records an action taken by the caller of a request
+func recordAudit(al *audit.Logger, r *http.Request, action string, session string, params map[string]interface{}, err error) {
+	event := audit.Event{
+		Action:  action,
+		Session: session,
+		Params:  params,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if caller := auth.FromContext(r.Context()); caller != nil {
+		event.Actor, event.Tenant = caller.Owner(), caller.Tenant
+	}
+	if err != nil {
+		event.Outcome, event.Error = audit.OutcomeFailure, err.Error()
+	}
+	al.Record(event)
+}
+
+// GetAuditHandler godoc
+// @Summary     Query the audit log
+// @Description List recorded management actions, newest first. Operators see every event, tenant admins the events of their tenant.
+// @Tags        audit
+// @Produce     json
+// @Param       actor   query string false "Subject that took the action"
+// @Param       tenant  query string false "Tenant of the actor or session"
+// @Param       action  query string false "Action, e.g. session.create"
+// @Param       session query string false "Session tracking ID"
+// @Param       since   query string false "RFC 3339 start time"
+// @Param       until   query string false "RFC 3339 end time"
+// @Param       limit   query int    false "Maximum events returned (default 100, at most 1000)"
+// @Success     200 {array} audit.Event
+// @Failure     400 {object} models.ErrorResponse "Bad Request"
+// @Failure     403 {object} models.ErrorResponse "Forbidden"
+// @Router      /audit [get]
+func GetAuditHandler(al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller := auth.FromContext(r.Context())
+		isOperator := caller != nil && caller.HasRole(auth.RoleOperator)
+		isTenantAdmin := caller != nil && caller.HasRole(auth.RoleTenantAdmin) && caller.Tenant != ""
+		if !isOperator && !isTenantAdmin {
+			forbidden(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		filter := audit.Filter{
+			Actor:   q.Get("actor"),
+			Tenant:  q.Get("tenant"),
+			Action:  q.Get("action"),
+			Session: q.Get("session"),
+			Limit:   100,
+		}
+		if !isOperator {
+			filter.Tenant = caller.Tenant
+		}
+
+		var err error
+		if filter.Since, err = parseTime(q.Get("since")); err != nil {
+			badRequest(w, r, "since must be an RFC 3339 time")
+			return
+		}
+		if filter.Until, err = parseTime(q.Get("until")); err != nil {
+			badRequest(w, r, "until must be an RFC 3339 time")
+			return
+		}
+		if limit := q.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n < 1 || n > 1000 {
+				badRequest(w, r, "limit must be between 1 and 1000")
+				return
+			}
+			filter.Limit = n
+		}
+
+		events, err := al.Query(filter)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		utils.JSONResponse(w, http.StatusOK, events)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/idempotency"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// maxBatchSize bounds the sessions of one batch request
+const maxBatchSize = 100
+
+// bulkWorkers is how many sessions a bulk operation terminates at once
+const bulkWorkers = 8
+
+// CreateBatchRequest creates several sessions at once, either count copies
+// of spec or one session per entry of items
+type CreateBatchRequest struct {
+	// Number of identical sessions to create from spec
+	// @example 20
+	Count int `json:"count,omitempty"`
+	// Session to create count times
+	Spec *CreateContainerRequest `json:"spec,omitempty"`
+	// Sessions to create, instead of count and spec
+	Items []CreateContainerRequest `json:"items,omitempty"`
+	// Labels added to every session of the batch
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BatchItem is the outcome of one session of a batch request
+type BatchItem struct {
+	Index      int                   `json:"index"`
+	TrackingID string                `json:"tracking_id,omitempty"`
+	StatusURL  string                `json:"status_url,omitempty"`
+	Error      *models.ErrorResponse `json:"error,omitempty"` // Why the session could not be queued
+}
+
+// CreateBatchResponse identifies a batch and its sessions
+type CreateBatchResponse struct {
+	BatchID   string      `json:"batch_id"`
+	StatusURL string      `json:"status_url"`
+	Queued    int         `json:"queued"`
+	Failed    int         `json:"failed"`
+	Items     []BatchItem `json:"items"`
+}
+
+// BulkRequest selects the sessions of a bulk operation, by batch, by label
+// selector or both
+type BulkRequest struct {
+	// @example 3f2a9c1b7d4e
+	BatchID string `json:"batch_id,omitempty"`
+	// @example suite=login,env!=prod
+	Selector string `json:"selector,omitempty"`
+}
+
+// BulkItem is the outcome of a bulk operation on one session
+type BulkItem struct {
+	TrackingID string                `json:"tracking_id"`
+	Error      *models.ErrorResponse `json:"error,omitempty"`
+}
+
+// BulkResponse reports a bulk operation on every selected session
+type BulkResponse struct {
+	Matched   int        `json:"matched"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Items     []BulkItem `json:"items"`
+}
+
+// Validate reports every problem of a batch request
+func (req CreateBatchRequest) Validate() []models.FieldError {
+	var errs fieldErrors
+	if len(req.Items) > 0 {
+		if req.Count != 0 || req.Spec != nil {
+			errs.add("items", "cannot be combined with count and spec")
+		}
+		if len(req.Items) > maxBatchSize {
+			errs.add("items", "must hold at most %d sessions", maxBatchSize)
+		}
+	} else {
+		if req.Spec == nil {
+			errs.add("spec", "is required unless items are given")
+		}
+		if req.Count < 1 || req.Count > maxBatchSize {
+			errs.add("count", "must be between 1 and %d", maxBatchSize)
+		}
+	}
+	if req.Spec != nil {
+		for _, e := range req.Spec.Validate() {
+			errs.add("spec."+e.Field, "%s", e.Message)
+		}
+	}
+	for i, item := range req.Items {
+		for _, e := range item.Validate() {
+			errs.add(fmt.Sprintf("items[%d].%s", i, e.Field), "%s", e.Message)
+		}
+	}
+	if err := docker.ValidateLabels(req.Labels); err != nil {
+		errs.add("labels", "%s", labelProblem(err))
+	}
+	return errs
+}
+
+// CreateBatchHandler godoc
+// @Summary     Create a batch of containers
+// @Description Queue several sessions at once, count copies of spec or one per entry of items, under a single batch ID. Each session is subject to the tenant quota and the creation queue; sessions that cannot be queued are reported with their error, the others are created. Retries with the same Idempotency-Key and body return the original batch.
+// @Tags        batches
+// @Accept      json
+// @Produce     json
+// @Param       request body CreateBatchRequest true "Sessions to create"
+// @Param       Idempotency-Key header string false "Client-chosen key, remembered per caller for the retention window"
+// @Success     202 {object} CreateBatchResponse
+// @Failure     400 {object} models.ErrorResponse "Invalid request body; field errors are listed in details.fields"
+// @Failure     403 {object} models.ErrorResponse "No session allowed by the tenant quota, or priority set by a caller other than an operator"
+// @Failure     409 {object} models.ErrorResponse "A request with the same Idempotency-Key is in progress"
+// @Failure     422 {object} models.ErrorResponse "Idempotency-Key reused with a different body"
+// @Failure     429 {object} models.ErrorResponse "No session could be queued"
+// @Router      /containers/batch [post]
+func CreateBatchHandler(dm *docker.DockerManager, al *audit.Logger, idem *idempotency.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateBatchRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+		var priorities []int
+		if req.Spec != nil {
+			priorities = append(priorities, req.Spec.Priority)
+		}
+		for _, item := range req.Items {
+			priorities = append(priorities, item.Priority)
+		}
+		if !checkPriority(w, r, priorities...) {
+			return
+		}
+
+		idempotent, replayed, ok := beginIdempotent(w, r, idem, req)
+		if !ok {
+			return
+		}
+		if replayed != "" {
+			batch := dm.GetBatch(replayed)
+			if batch == nil {
+				utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Batch no longer exists")
+				return
+			}
+			response := CreateBatchResponse{BatchID: batch.ID, StatusURL: batchStatusURL(batch.ID), Queued: len(batch.TrackingIDs)}
+			for i, trackingID := range batch.TrackingIDs {
+				response.Items = append(response.Items, BatchItem{Index: i, TrackingID: trackingID, StatusURL: containerStatusURL(trackingID)})
+			}
+			utils.JSONResponse(w, http.StatusAccepted, response)
+			return
+		}
+
+		specs := req.Items
+		for i := 0; i < req.Count && len(req.Items) == 0; i++ {
+			specs = append(specs, *req.Spec)
+		}
+		configs := make([]docker.ContainerConfig, len(specs))
+		for i, spec := range specs {
+			configs[i] = docker.ContainerConfig{
+				ImageID:   spec.ImageID,
+				VNCConfig: spec.VNCConfig,
+				Priority:  spec.Priority,
+				Resources: spec.Resources,
+				TTL:       time.Duration(spec.TTLSeconds) * time.Second,
+				Labels:    spec.Labels,
+				Recording: spec.Recording,
+			}
+		}
+
+		var owner, tenant string
+		if caller := auth.FromContext(r.Context()); caller != nil {
+			owner, tenant = caller.Owner(), caller.Tenant
+		}
+		batch, errs := dm.CreateBatch(owner, tenant, req.Labels, configs)
+
+		var firstErr error
+		response := CreateBatchResponse{Items: make([]BatchItem, len(configs))}
+		queued := 0
+		for i, err := range errs {
+			item := BatchItem{Index: i}
+			if err != nil {
+				_, code, message := errorFor(r, err)
+				item.Error = &models.ErrorResponse{Code: code, Message: message}
+				if firstErr == nil {
+					firstErr = err
+				}
+				response.Failed++
+			} else {
+				item.TrackingID = batch.TrackingIDs[queued]
+				item.StatusURL = containerStatusURL(item.TrackingID)
+				queued++
+			}
+			response.Items[i] = item
+		}
+		response.Queued = queued
+
+		params := audit.Params(req)
+		if batch != nil {
+			params["batch_id"] = batch.ID
+		}
+		params["queued"], params["failed"] = response.Queued, response.Failed
+		recordAudit(al, r, audit.ActionBatchCreate, "", params, firstErr)
+
+		if batch == nil {
+			idempotent.release()
+			writeError(w, r, firstErr)
+			return
+		}
+		idempotent.complete(batch.ID)
+
+		response.BatchID = batch.ID
+		response.StatusURL = batchStatusURL(batch.ID)
+		utils.JSONResponse(w, http.StatusAccepted, response)
+	}
+}
+
+// GetBatchHandler godoc
+// @Summary     Get batch status
+// @Description Get the aggregated status of a batch and the status of each of its sessions
+// @Tags        batches
+// @Produce     json
+// @Param       batchID path string true "Batch ID"
+// @Success     200 {object} docker.BatchStatus
+// @Failure     404 {object} models.ErrorResponse "Batch not found"
+// @Router      /containers/batch/{batchID} [get]
+func GetBatchHandler(dm *docker.DockerManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller := auth.FromContext(r.Context())
+		status, err := dm.GetBatchStatus(chi.URLParam(r, "batchID"))
+		if err != nil || caller == nil || !caller.CanAccess(status.Owner, status.Tenant) {
+			utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Batch not found")
+			return
+		}
+		utils.JSONResponse(w, http.StatusOK, status)
+	}
+}
+
+// BulkKillHandler godoc
+// @Summary     Kill sessions in bulk
+// @Description Kill every session of a batch and/or matching a label selector that the caller may access. Queued sessions leave the queue and failed ones are dismissed.
+// @Tags        batches
+// @Accept      json
+// @Produce     json
+// @Param       request body BulkRequest true "Sessions to kill"
+// @Success     200 {object} BulkResponse
+// @Failure     400 {object} models.ErrorResponse "Neither batch_id nor selector given, or invalid selector"
+// @Router      /containers/bulk/kill [post]
+func BulkKillHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
+	return bulkTerminate(dm, al, audit.ActionSessionKill, 0)
+}
+
+// BulkStopHandler godoc
+// @Summary     Stop sessions in bulk
+// @Description Stop every session of a batch and/or matching a label selector that the caller may access, giving each container 10 seconds to shut down. Queued sessions leave the queue and failed ones are dismissed.
+// @Tags        batches
+// @Accept      json
+// @Produce     json
+// @Param       request body BulkRequest true "Sessions to stop"
+// @Success     200 {object} BulkResponse
+// @Failure     400 {object} models.ErrorResponse "Neither batch_id nor selector given, or invalid selector"
+// @Router      /containers/bulk/stop [post]
+func BulkStopHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
+	return bulkTerminate(dm, al, audit.ActionSessionStop, 10*time.Second)
+}
+
+// bulkTerminate terminates the selected sessions, killing them when timeout is zero
+func bulkTerminate(dm *docker.DockerManager, al *audit.Logger, action string, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BulkRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if req.BatchID == "" && req.Selector == "" {
+			var errs fieldErrors
+			errs.add("batch_id", "batch_id or selector is required")
+			invalidFields(w, r, errs)
+			return
+		}
+		selector, err := docker.ParseSelector(req.Selector)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		caller := auth.FromContext(r.Context())
+		var sessions []*docker.ContainerStatus
+		for _, status := range dm.SelectSessions(req.BatchID, selector) {
+			if caller != nil && caller.CanAccess(status.Owner, status.Tenant) {
+				sessions = append(sessions, status)
+			}
+		}
+
+		// Sessions are terminated bulkWorkers at a time, each in up to its
+		// grace period plus the time Docker takes to kill and remove it
+		rounds := (len(sessions) + bulkWorkers - 1) / bulkWorkers
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(rounds)*(timeout+30*time.Second) + time.Minute))
+
+		response := BulkResponse{Matched: len(sessions), Items: make([]BulkItem, len(sessions))}
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, bulkWorkers)
+		for i, status := range sessions {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int, status *docker.ContainerStatus) {
+				defer func() { <-slots; wg.Done() }()
+				err := dm.TerminateSession(status.TrackingID, timeout)
+				recordAudit(al, r, action, status.TrackingID, map[string]interface{}{
+					"owner":    status.Owner,
+					"batch_id": req.BatchID,
+					"selector": req.Selector,
+					"status":   status.Status,
+				}, err)
+				item := BulkItem{TrackingID: status.TrackingID}
+				if err != nil {
+					_, code, message := errorFor(r, err)
+					item.Error = &models.ErrorResponse{Code: code, Message: message}
+				}
+				response.Items[i] = item
+			}(i, status)
+		}
+		wg.Wait()
+
+		for _, item := range response.Items {
+			if item.Error != nil {
+				response.Failed++
+			} else {
+				response.Succeeded++
+			}
+		}
+		utils.JSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func containerStatusURL(trackingID string) string {
+	return fmt.Sprintf("/containers/%s/status", trackingID)
+}
+
+func batchStatusURL(batchID string) string {
+	return fmt.Sprintf("/containers/batch/%s", batchID)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/desktop"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// maxClipboardText is the clipboard size VNC servers accept by default,
+// TigerVNC drops larger clipboards
+const maxClipboardText = 256 << 10
+
+// Clipboard is the text clipboard of a session's desktop
+type Clipboard struct {
+	// Clipboard text
+	// @example Summarise the attached report in three bullet points.
+	Text string `json:"text"`
+}
+
+// Validate reports every problem of a clipboard to set
+func (c Clipboard) Validate() []models.FieldError {
+	var errs fieldErrors
+	if len(c.Text) > maxClipboardText {
+		errs.add("text", "must not be longer than %d bytes", maxClipboardText)
+	}
+	if strings.ContainsRune(c.Text, 0) {
+		errs.add("text", "must not contain NUL characters")
+	}
+	return errs
+}
+
+// GetClipboardHandler godoc
+// @Summary     Read the clipboard of a session
+// @Description Read the text clipboard of a ready session's desktop through its VNC server, e.g. text an agent selected and copied. Servers with the extended clipboard protocol, like TigerVNC and KasmVNC, are asked for the current clipboard. Other servers only report changes, so the text copied last since the orchestrator connected is returned.
+// @Tags        desktop
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     200 {object} Clipboard
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     502 {object} models.ErrorResponse "VNC server of the session unavailable"
+// @Router      /containers/{id}/clipboard [get]
+func GetClipboardHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		text, err := desktops.Clipboard(status.TrackingID)
+		recordAudit(al, r, audit.ActionClipboardRead, status.TrackingID, map[string]interface{}{"size": len(text)}, err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusOK, Clipboard{Text: text})
+	}
+}
+
+// SetClipboardHandler godoc
+// @Summary     Set the clipboard of a session
+// @Description Set the text clipboard of a ready session's desktop through its VNC server, so long text can be pasted with ctrl+v instead of typed. Pasting reads the text from the orchestrator's VNC connection, which stays open until something else is copied on the desktop. Servers without the extended clipboard protocol only take Latin-1 text, other characters become '?'.
+// @Tags        desktop
+// @Accept      json
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       request body Clipboard true "Clipboard text"
+// @Success     200 {object} Clipboard
+// @Failure     400 {object} models.ErrorResponse "Invalid text; field errors are listed in details.fields"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     502 {object} models.ErrorResponse "VNC server of the session unavailable"
+// @Router      /containers/{id}/clipboard [put]
+func SetClipboardHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		var req Clipboard
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+
+		// The text is not recorded, it may be a secret
+		err := desktops.SetClipboard(status.TrackingID, req.Text)
+		recordAudit(al, r, audit.ActionClipboardWrite, status.TrackingID, map[string]interface{}{"size": len(req.Text)}, err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusOK, req)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/docker"
+)
+
+// maxDevToolsListing bounds the DevTools responses whose URLs are rewritten
+const maxDevToolsListing = 10 << 20
+
+// DevToolsHandler godoc
+// @Summary     Connect to the browser of a session over CDP
+// @Description Proxy the Chrome DevTools Protocol of the Chromium browser of a ready session, for images with cdp set in the catalog. The endpoint is cdp_ws_url of the container endpoints: WebSocket clients such as Puppeteer's connect with browserWSEndpoint are connected to the browser target, other requests get /json/version. The DevTools HTTP endpoints below it, e.g. /json/version used by Playwright's connectOverCDP, are passed on with the URLs in their responses pointing back at this endpoint. Chromium is started with remote debugging on the desktop of the session when it is not running yet. Clients send the API credentials as headers.
+// @Tags        desktop
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     101 "Switching to the DevTools WebSocket of the browser"
+// @Success     200 {object} map[string]string "Browser version, webSocketDebuggerUrl points at the proxy"
+// @Failure     403 {object} models.ErrorResponse "Request from a web page whose origin is not allowed"
+// @Failure     404 {object} models.ErrorResponse "Container not found or its image has no Chromium browser"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     502 {object} models.ErrorResponse "Browser could not be started or reached"
+// @Router      /containers/{id}/cdp [get]
+// @Router      /containers/{id}/cdp/json/version [get]
+func DevToolsHandler(dm *docker.DockerManager, al *audit.Logger, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Chromium's own Origin check is bypassed below, so pages are
+		// checked here, like for exec streams
+		if !checkOrigin(w, r, cfg.Auth.AllowedOrigins) {
+			return
+		}
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dm.DialDevTools(ctx, status.TrackingID)
+			},
+			// Every connection is a command in the container, none is kept idle
+			DisableKeepAlives: true,
+		}
+
+		target := "/" + chi.URLParam(r, "*")
+		upgrade := websocket.IsWebSocketUpgrade(r)
+		if target == "/" {
+			// The endpoint itself stands for the browser target
+			if !upgrade {
+				target = "/json/version"
+			} else {
+				path, err := browserTarget(r.Context(), transport)
+				if err != nil {
+					writeError(w, r, err)
+					return
+				}
+				target = path
+			}
+		}
+
+		var proxyErr error
+		proxy := &httputil.ReverseProxy{
+			Transport: transport,
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Scheme = "http"
+				pr.Out.URL.Host = docker.DevToolsHost
+				pr.Out.URL.Path = target
+				pr.Out.URL.RawPath = ""
+				// Chromium only answers requests addressed to localhost or an
+				// IP, and rejects WebSockets opened by web pages; the origin
+				// was checked against the API's own rules above
+				pr.Out.Host = docker.DevToolsHost
+				pr.Out.Header.Del("Origin")
+				pr.Out.Header.Del("Authorization")
+				pr.Out.Header.Del(auth.APIKeyHeader)
+				pr.Out.Header.Del("Cookie")
+				// Listings are rewritten, so they must arrive uncompressed
+				pr.Out.Header.Del("Accept-Encoding")
+			},
+			ModifyResponse: func(resp *http.Response) error {
+				if !strings.HasPrefix(target, "/json") {
+					return nil
+				}
+				public, err := devToolsPublicURL(dm, status.TrackingID)
+				if err != nil {
+					return err
+				}
+				return rewriteDevToolsURLs(resp, public)
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				proxyErr = err
+				writeError(w, r, err)
+			},
+		}
+
+		if !upgrade {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+
+		// Automation sessions outlive the server timeouts
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		started := time.Now()
+		proxy.ServeHTTP(w, r)
+		recordAudit(al, r, audit.ActionDevToolsConnect, status.TrackingID, map[string]interface{}{
+			"target":      target,
+			"duration_ms": time.Since(started).Milliseconds(),
+		}, proxyErr)
+	}
+}
+
+// browserTarget returns the WebSocket path of the browser target, which
+// Chromium makes up when it starts
+func browserTarget(ctx context.Context, transport http.RoundTripper) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+docker.DevToolsHost+"/json/version", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDevToolsListing)).Decode(&version); err != nil {
+		return "", fmt.Errorf("%w: invalid DevTools version: %v", docker.ErrBrowserUnavailable, err)
+	}
+	u, err := url.Parse(version.WebSocketDebuggerURL)
+	if err != nil || u.Path == "" {
+		return "", fmt.Errorf("%w: no browser target in DevTools version", docker.ErrBrowserUnavailable)
+	}
+	return u.Path, nil
+}
+
+// devToolsPublicURL returns the WebSocket URL the caller reaches the
+// DevTools endpoint of a session at: cdp_ws_url of its endpoints, built from
+// the API base URL. The session is ready once its browser was reached.
+func devToolsPublicURL(dm *docker.DockerManager, sessionID string) (url.URL, error) {
+	status := dm.GetContainerStatus(sessionID)
+	if status == nil || status.Endpoints == nil || status.Endpoints.CDPWSURL == "" {
+		return url.URL{}, fmt.Errorf("%w: session %s has no DevTools endpoint", docker.ErrBrowserUnavailable, sessionID)
+	}
+	u, err := url.Parse(status.Endpoints.CDPWSURL)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("%w: invalid DevTools endpoint: %v", docker.ErrBrowserUnavailable, err)
+	}
+	return *u, nil
+}
+
+// rewriteDevToolsURLs points the WebSocket URLs in a DevTools listing at
+// the proxy: webSocketDebuggerUrl, and the ws parameter of
+// devtoolsFrontendUrl
+func rewriteDevToolsURLs(resp *http.Response, public url.URL) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDevToolsListing))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = bytes.ReplaceAll(body, []byte("ws://"+docker.DevToolsHost+"/"), []byte(public.String()+"/"))
+	body = bytes.ReplaceAll(body, []byte("ws="+docker.DevToolsHost+"/"), []byte(public.Scheme+"="+public.Host+public.Path+"/"))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/shanurrahman/orchestrator/desktop"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// dockerErrors maps the sentinel errors of the docker and desktop packages
+// to a status and code
+var dockerErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{docker.ErrNotFound, http.StatusNotFound, models.CodeNotFound},
+	{docker.ErrInvalidImage, http.StatusBadRequest, models.CodeInvalidImage},
+	{docker.ErrInvalidResources, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidTTL, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidPriority, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidLabels, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidSelector, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidExec, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrInvalidPath, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrUploadIncomplete, http.StatusBadRequest, models.CodeInvalidRequest},
+	{docker.ErrNoSuchFile, http.StatusNotFound, models.CodeNotFound},
+	{docker.ErrPathNotAllowed, http.StatusForbidden, models.CodeForbidden},
+	{docker.ErrFileTooLarge, http.StatusRequestEntityTooLarge, models.CodeFileTooLarge},
+	{docker.ErrNotPermitted, http.StatusForbidden, models.CodeForbidden},
+	{docker.ErrNotReady, http.StatusConflict, models.CodeNotReady},
+	{docker.ErrQuotaExceeded, http.StatusTooManyRequests, models.CodeQuotaExceeded},
+	{docker.ErrCapacityExceeded, http.StatusTooManyRequests, models.CodeCapacityExceeded},
+	{docker.ErrRegistry, http.StatusBadGateway, models.CodeRegistryUnavailable},
+	{docker.ErrNoDevTools, http.StatusNotFound, models.CodeNotFound},
+	{docker.ErrBrowserUnavailable, http.StatusBadGateway, models.CodeBrowserUnavailable},
+	{desktop.ErrInvalidInput, http.StatusBadRequest, models.CodeInvalidRequest},
+	{desktop.ErrNoRecording, http.StatusNotFound, models.CodeNotFound},
+	{desktop.ErrRecordingInProgress, http.StatusConflict, models.CodeRecordingInProgress},
+	{desktop.ErrUnavailable, http.StatusBadGateway, models.CodeDesktopUnavailable},
+}
+
+// errorFor returns the status, code and message a docker or desktop error is
+// answered with. Unexpected errors are logged and get a generic message, so
+// Docker internals do not leak to callers.
+func errorFor(r *http.Request, err error) (int, string, string) {
+	for _, e := range dockerErrors {
+		if errors.Is(err, e.err) {
+			return e.status, e.code, err.Error()
+		}
+	}
+	log.Printf("Error handling %s %s [%s]: %v", r.Method, r.URL.Path, middleware.GetReqID(r.Context()), err)
+	return http.StatusInternalServerError, models.CodeInternal, "Internal server error"
+}
+
+// writeError answers with the status and code of a docker or desktop error
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := errorFor(r, err)
+	if errors.Is(err, docker.ErrCapacityExceeded) {
+		w.Header().Set("Retry-After", "30")
+	}
+	utils.ErrorResponse(w, r, status, code, message)
+}
+
+// badRequest answers with an invalid_request error
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	utils.ErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidRequest, message)
+}
+
+// forbidden answers with a forbidden error
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	utils.ErrorResponse(w, r, http.StatusForbidden, models.CodeForbidden, "Forbidden")
+}
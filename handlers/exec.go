@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// envNamePattern matches the environment variable names a command may set
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Stream bytes prefixed to output messages of streamed commands
+const (
+	execStdout = 1
+	execStderr = 2
+)
+
+// ExecRequest represents the request body for running a command in a session
+type ExecRequest struct {
+	// Program and arguments, not interpreted by a shell
+	// @example ["ls", "-la", "/home"]
+	Cmd []string `json:"cmd"`
+	// User or UID[:GID] to run as, the image default when empty
+	// @example root
+	User string `json:"user,omitempty"`
+	// Working directory, the image default when empty
+	// @example /tmp
+	WorkingDir string `json:"working_dir,omitempty"`
+	// Variables added to the environment of the command
+	Env map[string]string `json:"env,omitempty"`
+	// The command is terminated once it runs longer, the server default when 0
+	// @example 30
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// Validate reports every problem of an exec request
+func (req ExecRequest) Validate(limits config.ExecConfig) []models.FieldError {
+	var errs fieldErrors
+	if len(req.Cmd) == 0 || req.Cmd[0] == "" {
+		errs.add("cmd", "is required")
+	}
+	for _, name := range sortedKeys(req.Env) {
+		if !envNamePattern.MatchString(name) {
+			errs.add("env."+name, "is not a valid variable name")
+		}
+	}
+	if req.TimeoutSeconds < 0 {
+		errs.add("timeout_seconds", "must not be negative")
+	} else if time.Duration(req.TimeoutSeconds)*time.Second > limits.MaxTimeout {
+		errs.add("timeout_seconds", "exceeds the maximum of %d", int(limits.MaxTimeout/time.Second))
+	}
+	return errs
+}
+
+// options returns the docker options of a request, with the given timeout
+// when it sets none
+func (req ExecRequest) options(timeout time.Duration) docker.ExecOptions {
+	opts := docker.ExecOptions{
+		Cmd:        req.Cmd,
+		User:       req.User,
+		WorkingDir: req.WorkingDir,
+		Timeout:    timeout,
+	}
+	if req.TimeoutSeconds > 0 {
+		opts.Timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	for _, name := range sortedKeys(req.Env) {
+		opts.Env = append(opts.Env, name+"="+req.Env[name])
+	}
+	return opts
+}
+
+// auditParams describes a command for the audit log. Only the names of
+// environment variables are recorded, their values may be secrets.
+func (req ExecRequest) auditParams(opts docker.ExecOptions) map[string]interface{} {
+	params := map[string]interface{}{
+		"cmd":             req.Cmd,
+		"timeout_seconds": int(opts.Timeout / time.Second),
+	}
+	if req.User != "" {
+		params["user"] = req.User
+	}
+	if req.WorkingDir != "" {
+		params["working_dir"] = req.WorkingDir
+	}
+	if len(req.Env) > 0 {
+		params["env"] = sortedKeys(req.Env)
+	}
+	return params
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExecHandler godoc
+// @Summary     Run a command in a session
+// @Description Run a command in a ready session and wait for it to finish. A non-zero exit code is not an error. Up to 1 MiB of stdout and stderr each is returned. Commands that overrun their timeout are sent SIGTERM, then SIGKILL 5 seconds later.
+// @Tags        containers
+// @Accept      json
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       request body ExecRequest true "Command"
+// @Success     200 {object} docker.ExecResult
+// @Failure     400 {object} models.ErrorResponse "Invalid request body; field errors are listed in details.fields"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     500 {object} models.ErrorResponse "Internal Server Error"
+// @Router      /containers/{id}/exec [post]
+func ExecHandler(dm *docker.DockerManager, al *audit.Logger, limits config.ExecConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		var req ExecRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if errs := req.Validate(limits); len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+		opts := req.options(limits.DefaultTimeout)
+
+		// The command may outlive the server write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(opts.Timeout + time.Minute))
+		result, err := dm.Exec(r.Context(), status.TrackingID, opts)
+		params := req.auditParams(opts)
+		if result != nil {
+			params["exit_code"] = result.ExitCode
+			params["timed_out"] = result.TimedOut
+		}
+		recordAudit(al, r, audit.ActionSessionExec, status.TrackingID, params, err)
+		if errors.Is(err, context.Canceled) {
+			// The caller went away
+			return
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusOK, result)
+	}
+}
+
+// execControl is a text message of a streamed command
+type execControl struct {
+	Type     string `json:"type"` // resize or eof from the client; exit or error from the server
+	Cols     uint   `json:"cols,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ExecStreamHandler godoc
+// @Summary     Run a command in a session over WebSocket
+// @Description Run a command in a ready session attached to a WebSocket, e.g. an interactive shell. Binary messages from the client are written to stdin, text messages are JSON controls: {"type":"resize","cols":120,"rows":40} and {"type":"eof"} to close stdin. Output arrives as binary messages whose first byte is 1 for stdout or 2 for stderr; with a terminal everything is stdout. The last message is {"type":"exit","exit_code":0} before the server closes the connection. Commands run for max_timeout unless a shorter timeout is given.
+// @Tags        containers
+// @Param       id path string true "Container ID"
+// @Param       cmd query []string true "Program and arguments, repeated" collectionFormat(multi)
+// @Param       user query string false "User or UID[:GID] to run as"
+// @Param       working_dir query string false "Working directory"
+// @Param       env query []string false "KEY=value, repeated" collectionFormat(multi)
+// @Param       timeout_seconds query int false "Timeout in seconds"
+// @Param       tty query bool false "Allocate a terminal"
+// @Success     101 {string} string "Switching Protocols"
+// @Failure     400 {object} models.ErrorResponse "Invalid command"
+// @Failure     403 {object} models.ErrorResponse "Request from a web page whose origin is not allowed"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Router      /containers/{id}/exec/stream [get]
+func ExecStreamHandler(dm *docker.DockerManager, al *audit.Logger, limits config.ExecConfig, origins []string) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return originAllowed(r, origins) },
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Checked before the command starts, not only by the upgrader
+		if !checkOrigin(w, r, origins) {
+			return
+		}
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		query := r.URL.Query()
+		req := ExecRequest{
+			Cmd:        query["cmd"],
+			User:       query.Get("user"),
+			WorkingDir: query.Get("working_dir"),
+		}
+		var errs fieldErrors
+		for _, kv := range query["env"] {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || name == "" {
+				errs.add("env", "%q must be KEY=value", kv)
+				continue
+			}
+			if req.Env == nil {
+				req.Env = map[string]string{}
+			}
+			req.Env[name] = value
+		}
+		if s := query.Get("timeout_seconds"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				errs.add("timeout_seconds", "must be a number")
+			}
+			req.TimeoutSeconds = n
+		}
+		tty, err := strconv.ParseBool(query.Get("tty"))
+		if err != nil && query.Get("tty") != "" {
+			errs.add("tty", "must be a boolean")
+		}
+		errs = append(errs, req.Validate(limits)...)
+		if len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+		opts := req.options(limits.MaxTimeout)
+		opts.TTY = tty
+		opts.Stdin = true
+		params := req.auditParams(opts)
+		params["tty"] = tty
+
+		// The command is not tied to the request, it ends with the connection
+		stream, err := dm.StartExec(context.Background(), status.TrackingID, opts)
+		if err != nil {
+			recordAudit(al, r, audit.ActionSessionExec, status.TrackingID, params, err)
+			writeError(w, r, err)
+			return
+		}
+		defer stream.Close()
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already answered the caller
+			recordAudit(al, r, audit.ActionSessionExec, status.TrackingID, params, err)
+			return
+		}
+		defer ws.Close()
+
+		gone := make(chan struct{})
+		go func() {
+			for {
+				messageType, data, err := ws.ReadMessage()
+				if err != nil {
+					// Without a caller there is nobody to read the output
+					close(gone)
+					stream.Close()
+					return
+				}
+				if messageType == websocket.BinaryMessage {
+					if _, err := stream.Write(data); err != nil {
+						return
+					}
+					continue
+				}
+				var control execControl
+				if err := json.Unmarshal(data, &control); err != nil {
+					continue
+				}
+				switch control.Type {
+				case "resize":
+					if tty && control.Cols > 0 && control.Rows > 0 {
+						stream.Resize(context.Background(), control.Cols, control.Rows)
+					}
+				case "eof":
+					stream.CloseStdin()
+				}
+			}
+		}()
+
+		copyErr := stream.Copy(&execWriter{ws: ws, stream: execStdout}, &execWriter{ws: ws, stream: execStderr})
+		select {
+		case <-gone:
+			// The command is left to its timeout, or to the hangup of its terminal
+			params["disconnected"] = true
+			recordAudit(al, r, audit.ActionSessionExec, status.TrackingID, params, nil)
+			return
+		default:
+		}
+		exitCode, timedOut, err := stream.Wait(context.Background())
+		if err == nil && copyErr != nil {
+			err = copyErr
+		}
+		if err == nil {
+			params["exit_code"] = exitCode
+			params["timed_out"] = timedOut
+		}
+		recordAudit(al, r, audit.ActionSessionExec, status.TrackingID, params, err)
+
+		final := execControl{Type: "exit", ExitCode: &exitCode, TimedOut: timedOut}
+		if err != nil {
+			log.Printf("Error streaming command in session %s: %v", status.TrackingID, err)
+			final = execControl{Type: "error", Message: "Command output was interrupted"}
+		}
+		ws.WriteJSON(final)
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	}
+}
+
+// execWriter sends output of a streamed command as binary messages
+// prefixed by the stream they were written to
+type execWriter struct {
+	ws     *websocket.Conn
+	stream byte
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+	message := make([]byte, 0, len(p)+1)
+	message = append(append(message, w.stream), p...)
+	if err := w.ws.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// GetFileHandler godoc
+// @Summary     Download a file or list a directory
+// @Description Download a file from a ready session, or list a directory as JSON. Paths must be under the transfer directories of the image, by default the home of the desktop user. Symlinks are followed when they resolve inside those directories. Files are streamed and limited to files.max_download_size.
+// @Tags        files
+// @Produce     octet-stream
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       path query string true "Absolute path, e.g. /home/headless/Downloads/report.pdf"
+// @Success     200 {object} docker.DirListing "Directory listing; files are returned as application/octet-stream"
+// @Failure     400 {object} models.ErrorResponse "Invalid path"
+// @Failure     403 {object} models.ErrorResponse "Path outside the transfer directories"
+// @Failure     404 {object} models.ErrorResponse "Container or file not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     413 {object} models.ErrorResponse "File exceeds the download limit"
+// @Router      /containers/{id}/files [get]
+func GetFileHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		p := r.URL.Query().Get("path")
+		if p == "" {
+			invalidFields(w, r, []models.FieldError{{Field: "path", Message: "is required"}})
+			return
+		}
+
+		info, err := dm.StatFile(r.Context(), status.TrackingID, p)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if info.Type == "dir" {
+			listing, err := dm.ListDir(r.Context(), status.TrackingID, p)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			utils.JSONResponse(w, http.StatusOK, listing)
+			return
+		}
+
+		file, err := dm.OpenFile(r.Context(), status.TrackingID, p)
+		if err != nil {
+			recordAudit(al, r, audit.ActionFileDownload, status.TrackingID, map[string]interface{}{"path": p}, err)
+			writeError(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		// Large files take longer than the server write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Info.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Info.Name}))
+		w.Header().Set("Last-Modified", file.Info.ModTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		n, err := io.Copy(w, file)
+		params := map[string]interface{}{"path": file.Info.Path, "size": n}
+		if err != nil && r.Context().Err() == nil {
+			log.Printf("Error downloading %s from session %s: %v", file.Info.Path, status.TrackingID, err)
+		}
+		recordAudit(al, r, audit.ActionFileDownload, status.TrackingID, params, err)
+	}
+}
+
+// PutFileHandler godoc
+// @Summary     Upload a file
+// @Description Upload the request body to a file of a ready session, replacing it when it exists. The parent directory must exist and the path must be under the transfer directories of the image. The body is streamed into the container and needs a Content-Length within files.max_upload_size. The file is owned by the desktop user.
+// @Tags        files
+// @Accept      octet-stream
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       path query string true "Absolute path, e.g. /home/headless/Desktop/brief.pdf"
+// @Param       file body string true "File content"
+// @Success     201 {object} docker.FileInfo
+// @Failure     400 {object} models.ErrorResponse "Invalid path or incomplete body"
+// @Failure     403 {object} models.ErrorResponse "Path outside the transfer directories"
+// @Failure     404 {object} models.ErrorResponse "Container or parent directory not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     411 {object} models.ErrorResponse "Content-Length missing"
+// @Failure     413 {object} models.ErrorResponse "File exceeds the upload limit"
+// @Router      /containers/{id}/files [put]
+func PutFileHandler(dm *docker.DockerManager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		p := r.URL.Query().Get("path")
+		if p == "" {
+			invalidFields(w, r, []models.FieldError{{Field: "path", Message: "is required"}})
+			return
+		}
+		if r.ContentLength < 0 {
+			utils.ErrorResponse(w, r, http.StatusLengthRequired, models.CodeInvalidRequest, "Content-Length is required")
+			return
+		}
+
+		// Large files take longer than the server read timeout
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		info, err := dm.WriteFile(r.Context(), status.TrackingID, p, r.Body, r.ContentLength)
+		recordAudit(al, r, audit.ActionFileUpload, status.TrackingID, map[string]interface{}{"path": p, "size": r.ContentLength}, err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusCreated, info)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/idempotency"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// idempotentRequest is a request reserved under an Idempotency-Key. Without
+// a key its methods do nothing.
+type idempotentRequest struct {
+	store *idempotency.Store
+	scope string
+	key   string
+}
+
+// beginIdempotent reserves the Idempotency-Key of a request, if any. It
+// returns the result of an earlier request with the same key and body, if
+// there is one. When the key cannot be used it answers the request and
+// returns false.
+func beginIdempotent(w http.ResponseWriter, r *http.Request, store *idempotency.Store, request interface{}) (*idempotentRequest, string, bool) {
+	ir := &idempotentRequest{store: store, key: r.Header.Get(idempotency.Header)}
+	if ir.key == "" {
+		return ir, "", true
+	}
+	if len(ir.key) > idempotency.MaxKeyLength {
+		badRequest(w, r, "Idempotency-Key must not be longer than 255 characters")
+		return nil, "", false
+	}
+
+	// Keys are per caller, so callers cannot collide or replay each other's requests
+	if caller := auth.FromContext(r.Context()); caller != nil {
+		ir.scope = caller.Tenant + "/" + caller.Owner()
+	}
+	// The decoded request is compared rather than the raw body, so
+	// formatting differences between retries do not matter
+	body, err := json.Marshal(request)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, "", false
+	}
+
+	result, done, err := store.Begin(ir.scope, ir.key, body)
+	switch {
+	case errors.Is(err, idempotency.ErrKeyReused):
+		utils.ErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeKeyReused, err.Error())
+		return nil, "", false
+	case errors.Is(err, idempotency.ErrInProgress):
+		w.Header().Set("Retry-After", "1")
+		utils.ErrorResponse(w, r, http.StatusConflict, models.CodeInProgress, err.Error())
+		return nil, "", false
+	case err != nil:
+		writeError(w, r, err)
+		return nil, "", false
+	}
+	if done {
+		w.Header().Set("Idempotent-Replayed", "true")
+		return ir, result, true
+	}
+	return ir, "", true
+}
+
+// complete remembers the result of the request
+func (ir *idempotentRequest) complete(result string) {
+	if ir.key != "" {
+		ir.store.Complete(ir.scope, ir.key, result)
+	}
+}
+
+// release lets a failed request be retried with the same key
+func (ir *idempotentRequest) release() {
+	if ir.key != "" {
+		ir.store.Release(ir.scope, ir.key)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/desktop"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// Limits of one input request
+const (
+	maxInputActions = 100
+	maxInputText    = 10000
+	maxInputScroll  = 100 // Wheel clicks per direction, each is sent as a press and a release
+)
+
+// InputRequest represents the request body for sending input to a session
+type InputRequest struct {
+	// Actions performed in order
+	Actions []desktop.Action `json:"actions"`
+}
+
+// Validate reports every problem of an input request. Positions are checked
+// against the screen when the actions are performed.
+func (req InputRequest) Validate() []models.FieldError {
+	var errs fieldErrors
+	if len(req.Actions) == 0 {
+		errs.add("actions", "is required")
+	} else if len(req.Actions) > maxInputActions {
+		errs.add("actions", "must not have more than %d entries", maxInputActions)
+	}
+	for i, action := range req.Actions {
+		field := func(name string) string {
+			return fmt.Sprintf("actions[%d].%s", i, name)
+		}
+		pointer := false
+		switch action.Type {
+		case desktop.ActionMove:
+			pointer = true
+		case desktop.ActionClick, desktop.ActionDoubleClick, desktop.ActionDrag:
+			pointer = true
+			if _, ok := desktop.ButtonMask(action.Button); !ok {
+				errs.add(field("button"), "must be left, middle or right")
+			}
+			if action.Type == desktop.ActionDrag && (action.ToX == nil || action.ToY == nil) {
+				errs.add(field("to_x"), "to_x and to_y are required")
+			}
+		case desktop.ActionScroll:
+			pointer = true
+			if action.ScrollX == 0 && action.ScrollY == 0 {
+				errs.add(field("scroll_y"), "scroll_x or scroll_y is required")
+			}
+			if action.ScrollX < -maxInputScroll || action.ScrollX > maxInputScroll {
+				errs.add(field("scroll_x"), "must be between %d and %d", -maxInputScroll, maxInputScroll)
+			}
+			if action.ScrollY < -maxInputScroll || action.ScrollY > maxInputScroll {
+				errs.add(field("scroll_y"), "must be between %d and %d", -maxInputScroll, maxInputScroll)
+			}
+		case desktop.ActionKey:
+			if _, err := desktop.ParseKeys(action.Key); err != nil {
+				errs.add(field("key"), "%v", err)
+			}
+		case desktop.ActionType:
+			if action.Text == "" {
+				errs.add(field("text"), "is required")
+			} else if utf8.RuneCountInString(action.Text) > maxInputText {
+				errs.add(field("text"), "must not be longer than %d characters", maxInputText)
+			} else if !typeable(action.Text) {
+				errs.add(field("text"), "must not contain control characters other than newlines and tabs")
+			}
+		case "":
+			errs.add(field("type"), "is required")
+		default:
+			errs.add(field("type"), "must be move, click, double_click, drag, scroll, key or type")
+		}
+		if !pointer && (action.X != nil || action.Y != nil) {
+			errs.add(field("x"), "only applies to pointer actions")
+		}
+	}
+	return errs
+}
+
+// typeable reports whether text can be typed key by key
+func typeable(text string) bool {
+	for _, r := range text {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// auditParams describes input for the audit log. Typed text and keys are
+// not recorded, they may be secrets.
+func (req InputRequest) auditParams() map[string]interface{} {
+	types := make([]string, len(req.Actions))
+	for i, action := range req.Actions {
+		types[i] = action.Type
+	}
+	return map[string]interface{}{"actions": types}
+}
+
+// InputHandler godoc
+// @Summary     Send keyboard and mouse input to a session
+// @Description Perform input actions in order on the desktop of a ready session through its VNC server: move, click, double_click, drag, scroll, key and type. Positions are screen pixels; actions without one use the current pointer position. key takes a key name or a combination joined with +, e.g. Enter, ctrl+c or ctrl+shift+t. type enters text character by character. Input of concurrent requests is not interleaved. When an action fails the error names it, the actions before it have been performed.
+// @Tags        desktop
+// @Accept      json
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Param       request body InputRequest true "Input actions"
+// @Success     200 {object} desktop.InputResult
+// @Failure     400 {object} models.ErrorResponse "Invalid actions; field errors are listed in details.fields"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     502 {object} models.ErrorResponse "VNC server of the session unavailable"
+// @Router      /containers/{id}/input [post]
+func InputHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		var req InputRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if errs := req.Validate(); len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+
+		result, err := desktops.Input(status.TrackingID, req.Actions)
+		recordAudit(al, r, audit.ActionSessionInput, status.TrackingID, req.auditParams(), err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusOK, result)
+	}
+}
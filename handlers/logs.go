@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment, so proxies
+// do not close it
+const sseKeepAlive = 15 * time.Second
+
+// maxLogLine bounds the partial line buffered per stream of an event stream
+const maxLogLine = 64 << 10
+
+// GetLogsHandler godoc
+// @Summary     Get container logs
+// @Description Get the stdout and stderr of a session's desktop container. Logs stay available after the container exited until it is removed. With follow=true the response streams until the container exits or the caller disconnects. Plain text interleaves both streams; with Accept: text/event-stream every line is an event named stdout or stderr, and a final end event closes the stream.
+// @Tags        containers
+// @Produce     plain
+// @Produce     text/event-stream
+// @Param       id path string true "Container ID"
+// @Param       since query string false "RFC 3339 time, Unix seconds, or a duration such as 10m counted back from now"
+// @Param       tail query string false "Number of lines from the end, or all" default(all)
+// @Param       timestamps query bool false "Prefix every line with its RFC 3339 timestamp"
+// @Param       stdout query bool false "Include stdout" default(true)
+// @Param       stderr query bool false "Include stderr" default(true)
+// @Param       follow query bool false "Keep streaming new lines"
+// @Success     200 {string} string "Log lines"
+// @Failure     400 {object} models.ErrorResponse "Invalid query parameters; field errors are listed in details.fields"
+// @Failure     404 {object} models.ErrorResponse "Container not found or removed"
+// @Failure     409 {object} models.ErrorResponse "Session has no container yet"
+// @Router      /containers/{id}/logs [get]
+func GetLogsHandler(dm *docker.DockerManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := logSessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		opts, errs := parseLogOptions(r)
+		if len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+
+		logs, err := dm.OpenLogs(r.Context(), status.TrackingID, opts)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer logs.Close()
+
+		// Logs are only bounded by their size, or by the caller for followed logs
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Time{})
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			events := &sseLogs{w: w, rc: rc}
+			events.comment("logs of " + status.TrackingID)
+			stop := events.keepAlive(sseKeepAlive)
+			stdout, stderr := events.stream("stdout"), events.stream("stderr")
+			err = logs.Copy(stdout, stderr)
+			stop()
+			stdout.flush()
+			stderr.flush()
+			if err != nil && r.Context().Err() == nil {
+				log.Printf("Error streaming logs of session %s: %v", status.TrackingID, err)
+				events.send("error", []byte("Log stream interrupted"))
+				return
+			}
+			events.send("end", []byte("end"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		rc.Flush()
+		out := &flushWriter{w: w, rc: rc, flush: opts.Follow}
+		if err := logs.Copy(out, out); err != nil && r.Context().Err() == nil {
+			log.Printf("Error streaming logs of session %s: %v", status.TrackingID, err)
+		}
+	}
+}
+
+// logSessionFromRequest resolves the {id} URL parameter like
+// sessionFromRequest, but also to sessions whose container exited
+func logSessionFromRequest(dm *docker.DockerManager, w http.ResponseWriter, r *http.Request) *docker.ContainerStatus {
+	caller := auth.FromContext(r.Context())
+	status := dm.GetContainerStatus(chi.URLParam(r, "id"))
+	if status == nil {
+		status = dm.GetExitedSession(chi.URLParam(r, "id"))
+	}
+	if status == nil || caller == nil || !caller.CanAccess(status.Owner, status.Tenant) {
+		utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Container not found")
+		return nil
+	}
+	return status
+}
+
+// parseLogOptions reads the log query parameters of a request
+func parseLogOptions(r *http.Request) (docker.LogOptions, []models.FieldError) {
+	query := r.URL.Query()
+	opts := docker.LogOptions{Tail: -1, Stdout: true, Stderr: true}
+	var errs fieldErrors
+
+	if since := query.Get("since"); since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			errs.add("since", "must be an RFC 3339 time, Unix seconds or a duration such as 10m")
+		}
+		opts.Since = t
+	}
+	if tail := query.Get("tail"); tail != "" && tail != "all" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			errs.add("tail", "must be a non-negative number or all")
+		}
+		opts.Tail = n
+	}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{
+		{"timestamps", &opts.Timestamps},
+		{"follow", &opts.Follow},
+		{"stdout", &opts.Stdout},
+		{"stderr", &opts.Stderr},
+	} {
+		s := query.Get(flag.name)
+		if s == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			errs.add(flag.name, "must be a boolean")
+			continue
+		}
+		*flag.value = b
+	}
+	if !opts.Stdout && !opts.Stderr {
+		errs.add("stdout", "at least one of stdout and stderr must be selected")
+	}
+	return opts, errs
+}
+
+// parseSince parses an absolute time or a duration counted back from now
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return time.Unix(n, 0), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// flushWriter writes a chunked response, flushing every write when the
+// caller follows it
+type flushWriter struct {
+	w     io.Writer
+	rc    *http.ResponseController
+	flush bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil && f.flush {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
+
+// sseLogs writes log lines as server-sent events
+type sseLogs struct {
+	mu sync.Mutex
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+// send writes one event. Carriage returns end SSE lines, so they split the
+// data into several fields, which clients join with newlines.
+func (s *sseLogs) send(event string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\r")), []byte("\r")) {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// comment writes a comment, which clients ignore
+func (s *sseLogs) comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// keepAlive writes a comment at every interval until the returned function is called
+func (s *sseLogs) keepAlive(interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.comment("keep-alive")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// stream returns a writer sending every line written to it as an event
+func (s *sseLogs) stream(event string) *sseStream {
+	return &sseStream{logs: s, event: event}
+}
+
+// sseStream splits the output of one stream into lines
+type sseStream struct {
+	logs    *sseLogs
+	event   string
+	partial []byte
+}
+
+func (s *sseStream) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if err := s.logs.send(s.event, s.partial[:i]); err != nil {
+			return 0, err
+		}
+		s.partial = s.partial[i+1:]
+	}
+	if len(s.partial) > maxLogLine {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush sends a trailing partial line
+func (s *sseStream) flush() error {
+	if len(s.partial) == 0 {
+		return nil
+	}
+	err := s.logs.send(s.event, s.partial)
+	s.partial = nil
+	return err
+}
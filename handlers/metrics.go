@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/shanurrahman/orchestrator/auth"
+)
+
+// MetricsHandler godoc
+// @Summary     Runtime metrics
+// @Description Expose runtime metrics in expvar format, including the state of the rate limiter under "ratelimit". Restricted to operators.
+// @Tags        metrics
+// @Produce     json
+// @Success     200 {object} map[string]interface{}
+// @Failure     403 {object} models.ErrorResponse "Forbidden"
+// @Router      /metrics [get]
+func MetricsHandler(metrics http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller := auth.FromContext(r.Context())
+		if caller == nil || !caller.HasRole(auth.RoleOperator) {
+			forbidden(w, r)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// ambientMethods are the authentication methods whose credentials browsers
+// send on their own, whichever page makes the request
+var ambientMethods = map[string]bool{"basic": true, "client_cert": true, "none": true}
+
+// originAllowed reports whether a request may have been made by the page it
+// comes from. Requests without an Origin do not come from a page, and the
+// API's own origin is always allowed. Other origins must be listed in
+// allowed, and their requests must carry their credentials explicitly:
+// with basic auth, client certificates or authentication disabled, any
+// page the caller visits could open the connection in their name.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	if id := auth.FromContext(r.Context()); id == nil || ambientMethods[id.Method] {
+		return false
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin answers 403 to requests whose origin is not allowed and
+// reports whether the request may go on
+func checkOrigin(w http.ResponseWriter, r *http.Request, allowed []string) bool {
+	if originAllowed(r, allowed) {
+		return true
+	}
+	utils.ErrorResponseWithDetails(w, r, http.StatusForbidden, models.CodeForbidden, "Origin not allowed",
+		map[string]interface{}{"origin": r.Header.Get("Origin")})
+	return false
+}
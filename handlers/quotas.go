@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// GetMyQuotaHandler godoc
+// @Summary     Show the caller's quota
+// @Description Get the quota of the caller's tenant and its current usage
+// @Tags        quotas
+// @Produce     json
+// @Success     200 {object} docker.QuotaReport
+// @Router      /quotas/me [get]
+func GetMyQuotaHandler(dm *docker.DockerManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tenant string
+		if id := auth.FromContext(r.Context()); id != nil {
+			tenant = id.Tenant
+		}
+
+		utils.JSONResponse(w, http.StatusOK, dm.QuotaReport(tenant))
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/desktop"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// StartRecordingHandler godoc
+// @Summary     Start recording a session
+// @Description Record the desktop of a ready session into a Motion JPEG AVI file on the orchestrator, at desktop.recording.frame_rate frames per second. The recording runs until it is stopped or the session ends. Sessions can also be recorded from the start with recording in the creation request.
+// @Tags        recordings
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     201 {object} desktop.Recording
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running or already recorded"
+// @Failure     502 {object} models.ErrorResponse "VNC server of the session unavailable"
+// @Router      /containers/{id}/recordings/start [post]
+func StartRecordingHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		rec, err := desktops.StartRecording(status.TrackingID, status.Owner, status.Tenant)
+		params := map[string]interface{}{}
+		if rec != nil {
+			params["recording_id"] = rec.ID
+		}
+		recordAudit(al, r, audit.ActionRecordingStart, status.TrackingID, params, err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusCreated, rec)
+	}
+}
+
+// StopRecordingHandler godoc
+// @Summary     Stop recording a session
+// @Description Stop the active recording of a session and return it once the video file is complete
+// @Tags        recordings
+// @Produce     json
+// @Param       id path string true "Container ID"
+// @Success     200 {object} desktop.Recording
+// @Failure     404 {object} models.ErrorResponse "Container not found or not recorded"
+// @Router      /containers/{id}/recordings/stop [post]
+func StopRecordingHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+
+		rec, err := desktops.StopRecording(status.TrackingID)
+		params := map[string]interface{}{}
+		if rec != nil {
+			params["recording_id"] = rec.ID
+			params["frames"] = rec.Frames
+		}
+		recordAudit(al, r, audit.ActionRecordingStop, status.TrackingID, params, err)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		utils.JSONResponse(w, http.StatusOK, rec)
+	}
+}
+
+// ListRecordingsHandler godoc
+// @Summary     List the recordings of a session
+// @Description List the recordings of a session, oldest first. Recordings outlive their session until the retention period ends, so they are listed for sessions that no longer exist too.
+// @Tags        recordings
+// @Produce     json
+// @Param       id path string true "Session tracking ID"
+// @Success     200 {array} desktop.Recording
+// @Failure     404 {object} models.ErrorResponse "Session not found"
+// @Router      /containers/{id}/recordings [get]
+func ListRecordingsHandler(dm *docker.DockerManager, desktops *desktop.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, recordings := recordingSession(dm, desktops, w, r)
+		if sessionID == "" {
+			return
+		}
+		if recordings == nil {
+			var err error
+			if recordings, err = desktops.Recordings(sessionID); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+		utils.JSONResponse(w, http.StatusOK, recordings)
+	}
+}
+
+// GetRecordingHandler godoc
+// @Summary     Download a recording
+// @Description Download the video of a finished recording as a Motion JPEG AVI file. Recordings in progress must be stopped first.
+// @Tags        recordings
+// @Produce     video/x-msvideo
+// @Param       id path string true "Session tracking ID"
+// @Param       recordingID path string true "Recording ID"
+// @Success     200 {file} file "Video"
+// @Failure     404 {object} models.ErrorResponse "Session or recording not found"
+// @Failure     409 {object} models.ErrorResponse "Recording in progress"
+// @Router      /containers/{id}/recordings/{recordingID} [get]
+func GetRecordingHandler(dm *docker.DockerManager, desktops *desktop.Manager, al *audit.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, _ := recordingSession(dm, desktops, w, r)
+		if sessionID == "" {
+			return
+		}
+
+		f, rec, err := desktops.OpenRecording(sessionID, chi.URLParam(r, "recordingID"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer f.Close()
+
+		// Long recordings take longer than the server write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		name := sessionID + "-" + rec.ID + ".avi"
+		w.Header().Set("Content-Type", "video/x-msvideo")
+		w.Header().Set("Content-Length", strconv.FormatInt(rec.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.WriteHeader(http.StatusOK)
+		n, err := io.Copy(w, io.LimitReader(f, rec.Size))
+		if err != nil && r.Context().Err() == nil {
+			log.Printf("Error downloading recording %s of session %s: %v", rec.ID, sessionID, err)
+		}
+		recordAudit(al, r, audit.ActionRecordingDownload, sessionID, map[string]interface{}{"recording_id": rec.ID, "size": n}, err)
+	}
+}
+
+// recordingSession resolves the {id} URL parameter to the session whose
+// recordings the caller may access. Sessions that no longer exist are
+// authorised by the owner stored with their recordings, which are returned
+// as well. It answers 404 and returns an empty ID otherwise.
+func recordingSession(dm *docker.DockerManager, desktops *desktop.Manager, w http.ResponseWriter, r *http.Request) (string, []desktop.Recording) {
+	caller := auth.FromContext(r.Context())
+	id := chi.URLParam(r, "id")
+	status := dm.GetContainerStatus(id)
+	if status == nil {
+		status = dm.GetExitedSession(id)
+	}
+	if status != nil {
+		if caller != nil && caller.CanAccess(status.Owner, status.Tenant) {
+			return status.TrackingID, nil
+		}
+	} else if recordings, err := desktops.Recordings(id); err == nil && len(recordings) > 0 {
+		if caller != nil && caller.CanAccess(recordings[0].Owner, recordings[0].Tenant) {
+			return id, recordings
+		}
+	}
+	utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Container not found")
+	return "", nil
+}
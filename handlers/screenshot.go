@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/desktop"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+)
+
+// ScreenshotHandler godoc
+// @Summary     Capture the desktop of a session
+// @Description Capture the X display of a ready session through its VNC server. Captures are cached for desktop.screenshot_cache_ttl, so clients polling faster get the same image; X-Captured-At tells when it was taken. The format defaults to the Accept header, then PNG.
+// @Tags        desktop
+// @Produce     png
+// @Produce     jpeg
+// @Param       id path string true "Container ID"
+// @Param       format query string false "Image format" Enums(png, jpeg)
+// @Param       scale query number false "Scale factor in (0, 1]" default(1)
+// @Param       quality query int false "JPEG quality from 1 to 100" default(80)
+// @Success     200 {file} file "Screenshot"
+// @Failure     400 {object} models.ErrorResponse "Invalid query parameters; field errors are listed in details.fields"
+// @Failure     404 {object} models.ErrorResponse "Container not found"
+// @Failure     409 {object} models.ErrorResponse "Container is not running"
+// @Failure     502 {object} models.ErrorResponse "VNC server of the session unavailable"
+// @Router      /containers/{id}/screenshot [get]
+func ScreenshotHandler(dm *docker.DockerManager, desktops *desktop.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := sessionFromRequest(dm, w, r)
+		if status == nil {
+			return
+		}
+		opts, errs := parseScreenshotOptions(r)
+		if len(errs) > 0 {
+			invalidFields(w, r, errs)
+			return
+		}
+
+		shot, err := desktops.Screenshot(status.TrackingID, opts)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", shot.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(shot.Data)))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Captured-At", shot.CapturedAt.UTC().Format(time.RFC3339Nano))
+		w.WriteHeader(http.StatusOK)
+		w.Write(shot.Data)
+	}
+}
+
+// parseScreenshotOptions reads the screenshot query parameters of a request
+func parseScreenshotOptions(r *http.Request) (desktop.ScreenshotOptions, []models.FieldError) {
+	query := r.URL.Query()
+	opts := desktop.ScreenshotOptions{Format: "png", Scale: 1, Quality: 80}
+	var errs fieldErrors
+
+	switch format := strings.ToLower(query.Get("format")); format {
+	case "":
+		accept := r.Header.Get("Accept")
+		if strings.Contains(accept, "image/jpeg") && !strings.Contains(accept, "image/png") {
+			opts.Format = "jpeg"
+		}
+	case "png":
+	case "jpeg", "jpg":
+		opts.Format = "jpeg"
+	default:
+		errs.add("format", "must be png or jpeg")
+	}
+	if scale := query.Get("scale"); scale != "" {
+		f, err := strconv.ParseFloat(scale, 64)
+		if err != nil || f <= 0 || f > 1 {
+			errs.add("scale", "must be a number greater than 0 and at most 1")
+		}
+		opts.Scale = f
+	}
+	if quality := query.Get("quality"); quality != "" {
+		n, err := strconv.Atoi(quality)
+		if err != nil || n < 1 || n > 100 {
+			errs.add("quality", "must be between 1 and 100")
+		}
+		opts.Quality = n
+	}
+	if opts.Format == "png" {
+		// Quality only applies to JPEG, ignoring it shares cached encodings
+		opts.Quality = 0
+	}
+	return opts, errs
+}
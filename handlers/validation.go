@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/docker"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+)
+
+// fieldErrors collects the problems of a request body
+type fieldErrors []models.FieldError
+
+func (e *fieldErrors) add(field string, format string, args ...interface{}) {
+	*e = append(*e, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// decodeRequest decodes a JSON request body into v, rejecting unknown
+// fields. It answers 400 and returns false when the body is malformed.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := utils.ValidateRequestBody(r, v)
+	if err == nil {
+		return true
+	}
+
+	var errs fieldErrors
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		errs.add(typeErr.Field, "must be a %s", jsonType(typeErr.Type.Kind().String()))
+	} else if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name, _ := strconv.Unquote(field)
+		errs.add(name, "unknown field")
+	}
+	if len(errs) > 0 {
+		invalidFields(w, r, errs)
+		return false
+	}
+	badRequest(w, r, "Invalid request body: "+err.Error())
+	return false
+}
+
+// jsonType names a Go kind the way JSON does
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "struct", kind == "map":
+		return "object"
+	case kind == "slice", kind == "array":
+		return "array"
+	}
+	return kind
+}
+
+// invalidFields answers 400 with every field error of a request
+func invalidFields(w http.ResponseWriter, r *http.Request, errs []models.FieldError) {
+	utils.ErrorResponseWithDetails(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "Invalid request body",
+		map[string]interface{}{"fields": errs})
+}
+
+// checkPriority answers 403 when a caller other than an operator sets a
+// queue priority, which would let it overtake the requests of every other
+// tenant, and reports whether the request may go on
+func checkPriority(w http.ResponseWriter, r *http.Request, priorities ...int) bool {
+	if caller := auth.FromContext(r.Context()); caller != nil && caller.HasRole(auth.RoleOperator) {
+		return true
+	}
+	for _, priority := range priorities {
+		if priority != 0 {
+			utils.ErrorResponse(w, r, http.StatusForbidden, models.CodeForbidden, "Only operators may set a priority")
+			return false
+		}
+	}
+	return true
+}
+
+// Validate reports every problem of a creation request
+func (req CreateContainerRequest) Validate() []models.FieldError {
+	var errs fieldErrors
+	if strings.TrimSpace(req.ImageID) == "" {
+		errs.add("image_id", "is required")
+	}
+	validateVNCConfig("vnc_config", req.VNCConfig, &errs)
+	if req.TTLSeconds < 0 {
+		errs.add("ttl_seconds", "must not be negative")
+	}
+	if err := docker.ValidateLabels(req.Labels); err != nil {
+		errs.add("labels", "%s", labelProblem(err))
+	}
+	if req.Resources.CPUs < 0 {
+		errs.add("resources.cpus", "must not be negative")
+	}
+	if req.Resources.PidsLimit < 0 {
+		errs.add("resources.pids_limit", "must not be negative")
+	}
+	return errs
+}
+
+// Validate reports every problem of an extension request
+func (req ExtendContainerRequest) Validate() []models.FieldError {
+	var errs fieldErrors
+	if req.TTLSeconds <= 0 {
+		errs.add("ttl_seconds", "must be positive")
+	}
+	return errs
+}
+
+// Validate reports every problem of an access link request
+func (req CreateAccessLinkRequest) Validate() []models.FieldError {
+	var errs fieldErrors
+	if req.ExpiresInSeconds < 0 {
+		errs.add("expires_in_seconds", "must not be negative")
+	}
+	if req.MaxUses < 0 {
+		errs.add("max_uses", "must not be negative")
+	}
+	return errs
+}
+
+// labelProblem describes a label error without the sentinel prefix
+func labelProblem(err error) string {
+	return strings.TrimPrefix(err.Error(), docker.ErrInvalidLabels.Error()+": ")
+}
+
+// validateVNCConfig checks the VNC settings of a request. Unset fields are
+// filled from the server defaults later.
+func validateVNCConfig(prefix string, vnc config.VNCConfig, errs *fieldErrors) {
+	if vnc.Resolution != "" && !config.ValidResolution(vnc.Resolution) {
+		errs.add(prefix+".resolution", "%s", config.ResolutionRule)
+	}
+	if vnc.ColDepth != 0 && !config.ValidColDepth(vnc.ColDepth) {
+		errs.add(prefix+".colDepth", "must be 16, 24 or 32")
+	}
+	if vnc.Display != "" && !config.ValidDisplay(vnc.Display) {
+		errs.add(prefix+".display", "must be an X display such as :1")
+	}
+	if vnc.Password != "" && !config.ValidVNCPassword(vnc.Password) {
+		errs.add(prefix+".password", "%s", config.VNCPasswordRule)
+	}
+}
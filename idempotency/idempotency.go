@@ -0,0 +1,103 @@
+// Package idempotency remembers the results of requests sent with an
+// Idempotency-Key, so that retries do not repeat their side effects.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Header carries the key chosen by the client
+const Header = "Idempotency-Key"
+
+// MaxKeyLength bounds the keys clients may send
+const MaxKeyLength = 255
+
+var (
+	// ErrKeyReused is returned when a key is sent again with a different request
+	ErrKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrInProgress is returned when the first request with a key has not finished yet
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Store keeps the results of keyed requests for a retention window. Keys
+// are scoped, typically per caller, so callers cannot see each other's
+// results. Results are kept in memory, so a restart forgets them.
+type Store struct {
+	retention time.Duration
+
+	mu      sync.Mutex
+	entries map[entryKey]*entry
+}
+
+type entryKey struct {
+	scope string
+	key   string
+}
+
+type entry struct {
+	fingerprint [sha256.Size]byte
+	result      string
+	done        bool
+	expiresAt   time.Time
+}
+
+// NewStore returns a store keeping results for the retention window
+func NewStore(retention time.Duration) *Store {
+	return &Store{retention: retention, entries: make(map[entryKey]*entry)}
+}
+
+// Begin looks up a key. When the key was completed with the same request,
+// it returns the result and true. When the key is new, it is reserved for
+// the caller, who must then call Complete or Release.
+func (s *Store) Begin(scope, key string, request []byte) (string, bool, error) {
+	fingerprint := sha256.Sum256(request)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+
+	k := entryKey{scope: scope, key: key}
+	if e, ok := s.entries[k]; ok {
+		switch {
+		case e.fingerprint != fingerprint:
+			return "", false, ErrKeyReused
+		case !e.done:
+			return "", false, ErrInProgress
+		}
+		return e.result, true, nil
+	}
+	s.entries[k] = &entry{fingerprint: fingerprint, expiresAt: now.Add(s.retention)}
+	return "", false, nil
+}
+
+// Complete records the result of a reserved key
+func (s *Store) Complete(scope, key string, result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[entryKey{scope: scope, key: key}]; ok {
+		e.result, e.done = result, true
+		e.expiresAt = time.Now().Add(s.retention)
+	}
+}
+
+// Release forgets a reserved key whose request failed, so it can be retried
+func (s *Store) Release(scope, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[entryKey{scope: scope, key: key}]; ok && !e.done {
+		delete(s.entries, entryKey{scope: scope, key: key})
+	}
+}
+
+// prune forgets expired keys. The caller holds the lock.
+func (s *Store) prune(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"errors"
+	"expvar"
+	"flag"
 	"log"
+	"net"
 	"net/http"
-	"time"
+	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/shanurrahman/orchestrator/access"
+	"github.com/shanurrahman/orchestrator/audit"
+	"github.com/shanurrahman/orchestrator/auth"
 	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/desktop"
 	"github.com/shanurrahman/orchestrator/docker"
 	"github.com/shanurrahman/orchestrator/docs"
 	"github.com/shanurrahman/orchestrator/handlers"
+	"github.com/shanurrahman/orchestrator/idempotency"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/ratelimit"
+	"github.com/shanurrahman/orchestrator/tlsutil"
+	"github.com/shanurrahman/orchestrator/utils"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -32,7 +45,13 @@ import (
 func main() {
 	log.Println("Starting the orchestrator service...")
 	
-	cfg := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 	log.Println("Configuration loaded successfully")
 	
 	// Update Swagger host and base path based on proxy configuration
@@ -40,59 +59,173 @@ func main() {
 		docs.SwaggerInfo.Host = "localhost:9999"
 		docs.SwaggerInfo.BasePath = "/orchestrator"
 	} else {
-		docs.SwaggerInfo.Host = "localhost:8090"
+		_, port, _ := net.SplitHostPort(cfg.ListenAddr)
+		docs.SwaggerInfo.Host = "localhost:" + port
 		docs.SwaggerInfo.BasePath = "/"
 	}
 	
-	dockerClient := docker.NewDockerManager(cfg)
+	var auditSink audit.Sink = audit.NewMemorySink(10000)
+	if cfg.Audit.File != "" {
+		auditSink, err = audit.NewFileSink(cfg.Audit.File)
+		if err != nil {
+			log.Fatalf("Failed to set up the audit log: %v", err)
+		}
+	} else {
+		log.Println("No audit log file configured, recent audit events are only kept in memory")
+	}
+	auditLog := audit.NewLogger(auditSink)
+	auditLog.Record(audit.Event{
+		Actor:   audit.ActorSystem,
+		Action:  audit.ActionConfigLoad,
+		Params:  cfg.Map(),
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	dockerClient := docker.NewDockerManager(cfg, auditLog)
 	log.Println("Docker manager initialized")
 	
 	// Create a new chi router
 	r := chi.NewRouter()
 	
 	// Add middleware
+	r.Use(middleware.RequestID)
+	r.Use(utils.RequestIDHeader)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
-	
-	// Health check endpoint
-	healthHandler := func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("OK"))
-	}
-	r.Get("/health", healthHandler)
-	r.Head("/health", healthHandler)
-	
-	// Serve Swagger documentation
-	swaggerURL := "/swagger/doc.json"
-	if cfg.BehindProxy {  // Add this configuration in your config package
-		swaggerURL = "swagger/doc.json"
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		utils.ErrorResponse(w, r, http.StatusNotFound, models.CodeNotFound, "Not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		utils.ErrorResponse(w, r, http.StatusMethodNotAllowed, models.CodeInvalidRequest, "Method not allowed")
+	})
+
+	if cfg.Access.Secret == "" {
+		log.Println("No access secret configured, desktop access links are signed with a random key")
 	}
-	r.Handle("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL(swaggerURL),
-		httpSwagger.DeepLinking(true),
-		httpSwagger.DocExpansion("none"),
-	))
-
-	// Register API routes
-	// Modify the routes section
-	r.Route("/containers", func(r chi.Router) {
-	    r.Get("/images", handlers.ListImagesHandler(dockerClient))
-	    r.Post("/", handlers.CreateContainerHandler(dockerClient))
-	    r.Get("/{id}/status", handlers.GetContainerStatusHandler(dockerClient))
-	    r.Delete("/{id}/kill", handlers.KillContainerHandler(dockerClient))
+	links := access.NewLinks(access.NewSigner(cfg.Access.Secret))
+	idempotencyKeys := idempotency.NewStore(cfg.Idempotency.Retention)
+	desktops := desktop.NewManager(dockerClient, cfg.Desktop)
+	dockerClient.OnReady(func(status *docker.ContainerStatus) {
+		if status.Recording {
+			desktops.RecordNewSession(status.TrackingID, status.Owner, status.Tenant)
+		}
 	})
-	
+
+	// Desktop connections are long-lived and authenticated by their access
+	// token, so they bypass the request timeout and API authentication
+	r.Get("/vnc/{token}", handlers.VNCProxyHandler(dockerClient, links, auditLog))
+
+	r.Group(func(r chi.Router) {
+		// Failed authentications are counted per client IP before any
+		// credentials are checked, so floods of bad ones are cut off early
+		limiter := ratelimit.New(cfg.RateLimit, cfg.BehindProxy, r)
+		limiter.Publish("ratelimit")
+		r.Use(limiter.FailedAuthMiddleware)
+
+		if cfg.Auth.Disabled {
+			log.Println("WARNING: authentication is disabled, anyone who can reach the API can manage containers")
+			r.Use(auth.AnonymousMiddleware)
+		} else {
+			authenticators, err := auth.FromConfig(cfg.Auth)
+			if err != nil {
+				log.Fatalf("Failed to set up authentication: %v", err)
+			}
+			if cfg.TLS.ClientCAFile != "" {
+				// A verified client certificate is tried before any other credentials
+				authenticators = append([]auth.Authenticator{auth.NewCertificateAuthenticator(cfg.Auth.Users)}, authenticators...)
+			}
+			r.Use(auth.Middleware(authenticators, "/health"))
+		}
+
+		// Route limits apply per authenticated caller, so they come after
+		// authentication; requests without an identity count per client IP
+		r.Use(limiter.Middleware)
+
+		// Commands, bulk terminations, log streams, file and recording
+		// transfers and DevTools sessions outlive the request timeout.
+		// Commands and bulk terminations are bounded by their own, the others
+		// by the caller.
+		r.Post("/containers/{id}/exec", handlers.ExecHandler(dockerClient, auditLog, cfg.Exec))
+		r.Get("/containers/{id}/exec/stream", handlers.ExecStreamHandler(dockerClient, auditLog, cfg.Exec, cfg.Auth.AllowedOrigins))
+		r.Post("/containers/bulk/kill", handlers.BulkKillHandler(dockerClient, auditLog))
+		r.Post("/containers/bulk/stop", handlers.BulkStopHandler(dockerClient, auditLog))
+		r.Get("/containers/{id}/logs", handlers.GetLogsHandler(dockerClient))
+		r.Get("/containers/{id}/files", handlers.GetFileHandler(dockerClient, auditLog))
+		r.Put("/containers/{id}/files", handlers.PutFileHandler(dockerClient, auditLog))
+		r.Get("/containers/{id}/recordings/{recordingID}", handlers.GetRecordingHandler(dockerClient, desktops, auditLog))
+		r.Handle("/containers/{id}/cdp", handlers.DevToolsHandler(dockerClient, auditLog, cfg))
+		r.Handle("/containers/{id}/cdp/*", handlers.DevToolsHandler(dockerClient, auditLog, cfg))
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(cfg.Timeouts.Request))
+
+			// Health check endpoint
+			healthHandler := func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			}
+			r.Get("/health", healthHandler)
+			r.Head("/health", healthHandler)
+
+			// Serve Swagger documentation
+			swaggerURL := "/swagger/doc.json"
+			if cfg.BehindProxy {  // Add this configuration in your config package
+				swaggerURL = "swagger/doc.json"
+			}
+			r.Handle("/swagger/*", httpSwagger.Handler(
+				httpSwagger.URL(swaggerURL),
+				httpSwagger.DeepLinking(true),
+				httpSwagger.DocExpansion("none"),
+			))
+
+			// Register API routes
+			// Modify the routes section
+			r.Route("/containers", func(r chi.Router) {
+			    r.Get("/images", handlers.ListImagesHandler(dockerClient))
+			    r.Get("/", handlers.ListContainersHandler(dockerClient))
+			    r.Post("/", handlers.CreateContainerHandler(dockerClient, auditLog, idempotencyKeys))
+			    r.Post("/batch", handlers.CreateBatchHandler(dockerClient, auditLog, idempotencyKeys))
+			    r.Get("/batch/{batchID}", handlers.GetBatchHandler(dockerClient))
+			    r.Get("/{id}/status", handlers.GetContainerStatusHandler(dockerClient))
+			    r.Delete("/{id}/kill", handlers.KillContainerHandler(dockerClient, auditLog))
+			    r.Post("/{id}/extend", handlers.ExtendContainerHandler(dockerClient, auditLog))
+			    r.Post("/{id}/access-links", handlers.CreateAccessLinkHandler(dockerClient, links, auditLog, cfg))
+			    r.Get("/{id}/access-links", handlers.ListAccessLinksHandler(dockerClient, links))
+			    r.Delete("/{id}/access-links/{linkID}", handlers.RevokeAccessLinkHandler(dockerClient, links, auditLog))
+			    r.Get("/{id}/screenshot", handlers.ScreenshotHandler(dockerClient, desktops))
+			    r.Post("/{id}/input", handlers.InputHandler(dockerClient, desktops, auditLog))
+			    r.Get("/{id}/clipboard", handlers.GetClipboardHandler(dockerClient, desktops, auditLog))
+			    r.Put("/{id}/clipboard", handlers.SetClipboardHandler(dockerClient, desktops, auditLog))
+			    r.Get("/{id}/recordings", handlers.ListRecordingsHandler(dockerClient, desktops))
+			    r.Post("/{id}/recordings/start", handlers.StartRecordingHandler(dockerClient, desktops, auditLog))
+			    r.Post("/{id}/recordings/stop", handlers.StopRecordingHandler(dockerClient, desktops, auditLog))
+			})
+			r.Get("/quotas/me", handlers.GetMyQuotaHandler(dockerClient))
+			r.Get("/audit", handlers.GetAuditHandler(auditLog))
+			r.Get("/metrics", handlers.MetricsHandler(expvar.Handler()))
+		})
+	})
+
 	// Configure server with timeouts
 	server := &http.Server{
-		Addr:         "0.0.0.0:8090",
+		Addr:         cfg.ListenAddr,
 		Handler:      r,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		ReadTimeout:  cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write,
+		IdleTimeout:  cfg.Timeouts.Idle,
 	}
 	
-	log.Printf("Server starting on %s", server.Addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if cfg.TLS.Enabled() {
+		server.TLSConfig, err = tlsutil.ServerConfig(cfg.TLS)
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		log.Printf("Server starting on %s with TLS", server.Addr)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Server starting on %s", server.Addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
\ No newline at end of file
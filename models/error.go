@@ -0,0 +1,44 @@
+package models
+
+// Error codes. They are stable, clients may branch on them.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeInvalidImage        = "invalid_image"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeNotReady            = "not_ready"
+	CodeKeyReused           = "idempotency_key_reused"
+	CodeInProgress          = "request_in_progress"
+	CodeRecordingInProgress = "recording_in_progress"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeCapacityExceeded    = "capacity_exceeded"
+	CodeRateLimited         = "rate_limited"
+	CodeFileTooLarge        = "file_too_large"
+	CodeRegistryUnavailable = "registry_unavailable"
+	CodeDesktopUnavailable  = "desktop_unavailable"
+	CodeBrowserUnavailable  = "browser_unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// ErrorResponse is the body of every error response
+// @Description Error with a stable code, a human-readable message and the ID of the failed request
+type ErrorResponse struct {
+	// Stable error code
+	Code string `json:"code" example:"not_found"`
+	// Human-readable description, not meant to be parsed
+	Message string `json:"message" example:"Container not found"`
+	// Additional context, depending on the code
+	Details map[string]interface{} `json:"details,omitempty"`
+	// ID of the request, also sent in the X-Request-Id header
+	RequestID string `json:"request_id,omitempty" example:"orchestrator/Xk2c9AbQ1-000042"`
+}
+
+// FieldError is a problem with one field of a request body. Invalid
+// requests list every problem under details.fields.
+type FieldError struct {
+	// JSON path of the field
+	Field string `json:"field" example:"vnc_config.resolution"`
+	// What is wrong with it
+	Message string `json:"message" example:"must be WIDTHxHEIGHT between 320x200 and 7680x4320, e.g. 1360x768"`
+}
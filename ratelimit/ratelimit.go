@@ -0,0 +1,274 @@
+// Package ratelimit throttles API callers with token buckets kept per caller and route.
+package ratelimit
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/shanurrahman/orchestrator/auth"
+	"github.com/shanurrahman/orchestrator/config"
+	"github.com/shanurrahman/orchestrator/models"
+	"github.com/shanurrahman/orchestrator/utils"
+	"golang.org/x/time/rate"
+)
+
+// failedAuthRule names the bucket of failed authentications in the state
+const failedAuthRule = "failed_auth"
+
+// idleTimeout is how long an unused bucket is kept. A bucket idle for
+// longer than it takes to refill is equivalent to a new one.
+const idleTimeout = 10 * time.Minute
+
+// Limiter holds the buckets of every caller
+type Limiter struct {
+	cfg         config.RateLimitConfig
+	behindProxy bool
+	routes      chi.Routes
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	stats   map[string]*ruleStats // Keyed by rule name
+}
+
+type bucketKey struct {
+	rule   string
+	caller string
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type ruleStats struct {
+	Allowed  uint64
+	Rejected uint64
+}
+
+// New returns a limiter for the routes of a router. Route rules are looked
+// up by the pattern chi matches, so they apply to every path of a route.
+func New(cfg config.RateLimitConfig, behindProxy bool, routes chi.Routes) *Limiter {
+	l := &Limiter{
+		cfg:         cfg,
+		behindProxy: behindProxy,
+		routes:      routes,
+		buckets:     make(map[bucketKey]*bucket),
+		stats:       make(map[string]*ruleStats),
+	}
+	go l.evictIdle()
+	return l
+}
+
+// Middleware rejects requests over the limit of their caller with 429 and a
+// Retry-After header. It belongs after authentication, so that callers
+// with an identity are limited as such rather than by address.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rule := l.rule(r)
+		if rule.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		key := bucketKey{rule: name, caller: l.caller(r)}
+		l.mu.Lock()
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(rate.Limit(rule.Rate), max(rule.Burst, 1))}
+			l.buckets[key] = b
+		}
+		b.lastSeen = now
+		reservation := b.limiter.ReserveN(now, 1)
+		delay := reservation.DelayFrom(now)
+		stats := l.statsFor(name)
+		if delay > 0 {
+			reservation.CancelAt(now)
+			stats.Rejected++
+		} else {
+			stats.Allowed++
+		}
+		l.mu.Unlock()
+
+		if delay > 0 {
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			utils.ErrorResponseWithDetails(w, r, http.StatusTooManyRequests, models.CodeRateLimited, "Rate limit exceeded",
+				map[string]interface{}{"rule": name, "retry_after_seconds": retryAfter})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FailedAuthMiddleware counts the requests of each client IP that fail
+// authentication and rejects the IPs out of tokens with 429 before their
+// credentials are checked, so guessing passwords or keys stays slow and
+// cannot keep the server hashing. It belongs before authentication.
+func (l *Limiter) FailedAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := l.cfg.FailedAuth
+		if rule.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := bucketKey{rule: failedAuthRule, caller: "ip:" + ClientIP(r, l.behindProxy)}
+		now := time.Now()
+		l.mu.Lock()
+		var delay time.Duration
+		if b, ok := l.buckets[key]; ok {
+			if tokens := b.limiter.TokensAt(now); tokens < 1 {
+				delay = time.Duration((1 - tokens) / rule.Rate * float64(time.Second))
+				l.statsFor(failedAuthRule).Rejected++
+			}
+		}
+		l.mu.Unlock()
+
+		if delay > 0 {
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			utils.ErrorResponseWithDetails(w, r, http.StatusTooManyRequests, models.CodeRateLimited, "Too many failed authentications",
+				map[string]interface{}{"rule": failedAuthRule, "retry_after_seconds": retryAfter})
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() != http.StatusUnauthorized {
+			return
+		}
+
+		now = time.Now()
+		l.mu.Lock()
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(rate.Limit(rule.Rate), max(rule.Burst, 1))}
+			l.buckets[key] = b
+		}
+		b.lastSeen = now
+		b.limiter.AllowN(now, 1)
+		l.statsFor(failedAuthRule).Allowed++
+		l.mu.Unlock()
+	})
+}
+
+// rule returns the name and rule that apply to a request. Rules are named
+// "METHOD /pattern", or "/pattern" for every method.
+func (l *Limiter) rule(r *http.Request) (string, config.RateRule) {
+	pattern := l.routes.Find(chi.NewRouteContext(), r.Method, r.URL.Path)
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if pattern != "" {
+		for _, name := range []string{r.Method + " " + pattern, pattern} {
+			if rule, ok := l.cfg.Routes[name]; ok {
+				return name, rule
+			}
+		}
+	}
+	return "default", l.cfg.Default
+}
+
+// caller identifies who a request is counted against
+func (l *Limiter) caller(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); id != nil && id != auth.Anonymous {
+		return "id:" + id.Tenant + "/" + id.Owner()
+	}
+	return "ip:" + ClientIP(r, l.behindProxy)
+}
+
+// statsFor returns the counters of a rule. The caller holds the lock.
+func (l *Limiter) statsFor(name string) *ruleStats {
+	s, ok := l.stats[name]
+	if !ok {
+		s = &ruleStats{}
+		l.stats[name] = s
+	}
+	return s
+}
+
+// evictIdle forgets buckets that have not been used for a while
+func (l *Limiter) evictIdle() {
+	for range time.Tick(time.Minute) {
+		cutoff := time.Now().Add(-idleTimeout)
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if b.lastSeen.Before(cutoff) {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// RuleState is the state of the buckets of one rule
+type RuleState struct {
+	Rate           float64 `json:"rate"`
+	Burst          int     `json:"burst"`
+	Callers        int     `json:"callers"`         // Callers with a bucket
+	LimitedCallers int     `json:"limited_callers"` // Callers without a token left
+	Allowed        uint64  `json:"allowed"`
+	Rejected       uint64  `json:"rejected"`
+}
+
+// State reports the buckets and counters of every rule
+func (l *Limiter) State() map[string]RuleState {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := map[string]RuleState{
+		"default":      {Rate: l.cfg.Default.Rate, Burst: l.cfg.Default.Burst},
+		failedAuthRule: {Rate: l.cfg.FailedAuth.Rate, Burst: l.cfg.FailedAuth.Burst},
+	}
+	for name, rule := range l.cfg.Routes {
+		state[name] = RuleState{Rate: rule.Rate, Burst: rule.Burst}
+	}
+	for name, stats := range l.stats {
+		s := state[name]
+		s.Allowed, s.Rejected = stats.Allowed, stats.Rejected
+		state[name] = s
+	}
+	for key, b := range l.buckets {
+		s := state[key.rule]
+		s.Callers++
+		if b.limiter.TokensAt(now) < 1 {
+			s.LimitedCallers++
+		}
+		state[key.rule] = s
+	}
+	return state
+}
+
+// Publish exposes the limiter state as the expvar variable name
+func (l *Limiter) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return l.State() }))
+}
+
+// ClientIP returns the address of the client. Behind the proxy it is the
+// last X-Forwarded-For entry, the one the proxy added; earlier entries
+// come from the client and cannot be trusted.
+func ClientIP(r *http.Request, behindProxy bool) string {
+	if behindProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
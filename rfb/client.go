@@ -0,0 +1,397 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server to client message types
+const (
+	msgFramebufferUpdate   = 0
+	msgSetColourMapEntries = 1
+	msgBell                = 2
+	msgServerCutText       = 3
+)
+
+// Encodings
+const (
+	encodingRaw         = 0
+	encodingCopyRect    = 1
+	encodingDesktopSize = -223
+)
+
+// maxFramebuffer bounds the desktop size a server may announce
+const maxFramebuffer = 8192
+
+// ErrClosed is returned by a client whose connection has ended
+var ErrClosed = errors.New("rfb: connection closed")
+
+// clientPixelFormat is requested from servers: 32 bits per pixel, red in
+// the lowest byte, so little endian pixels are laid out like image.RGBA
+var clientPixelFormat = PixelFormat{
+	BitsPerPixel: 32,
+	Depth:        24,
+	TrueColor:    true,
+	RedMax:       255,
+	GreenMax:     255,
+	BlueMax:      255,
+	RedShift:     0,
+	GreenShift:   8,
+	BlueShift:    16,
+}
+
+// Client is a shared connection to a VNC server. It mirrors the framebuffer
+// of the server from the updates it requests and sends input on behalf of
+// the orchestrator. A client is safe for concurrent use.
+type Client struct {
+	conn net.Conn
+	name string
+
+	wmu sync.Mutex // Serialises messages to the server
+
+	mu      sync.Mutex
+	fb      *image.RGBA
+	waiters []chan struct{} // Woken when the next framebuffer update is complete
+	updates uint64          // Framebuffer updates applied so far
+	err     error
+	done    chan struct{}
+
+	connected     time.Time
+	caps          chan struct{}   // Closed when the server announces the extended clipboard
+	extClipboard  bool            // The server speaks the extended clipboard protocol
+	serverText    string          // Last clipboard sent by the server
+	clientText    string          // Clipboard set through this connection
+	ownsClipboard bool            // clientText is the clipboard of the desktop
+	clipWaiters   []chan struct{} // Woken when the server sends its clipboard
+}
+
+// NewClient authenticates to a VNC server on conn and starts reading its
+// messages. The client owns conn from then on. A deadline set on conn
+// bounds the handshake.
+func NewClient(conn net.Conn, password string) (*Client, error) {
+	init, err := ClientHandshake(conn, password)
+	if err != nil {
+		return nil, err
+	}
+	if init.Width == 0 || init.Height == 0 || init.Width > maxFramebuffer || init.Height > maxFramebuffer {
+		return nil, fmt.Errorf("rfb: unsupported desktop size %dx%d", init.Width, init.Height)
+	}
+
+	c := &Client{
+		conn: conn,
+		name: init.Name,
+		fb:   image.NewRGBA(image.Rect(0, 0, int(init.Width), int(init.Height))),
+		done: make(chan struct{}),
+
+		connected: time.Now(),
+		caps:      make(chan struct{}),
+	}
+	pixelFormat := make([]byte, 20)
+	pixelFormat[0] = msgSetPixelFormat
+	clientPixelFormat.marshalTo(pixelFormat[4:])
+	encodings := []int32{encodingCopyRect, encodingRaw, encodingDesktopSize, encodingExtendedClipboard}
+	setEncodings := make([]byte, 4, 4+4*len(encodings))
+	setEncodings[0] = msgSetEncodings
+	binary.BigEndian.PutUint16(setEncodings[2:4], uint16(len(encodings)))
+	for _, e := range encodings {
+		setEncodings = binary.BigEndian.AppendUint32(setEncodings, uint32(e))
+	}
+	if err := c.send(append(pixelFormat, setEncodings...)); err != nil {
+		return nil, err
+	}
+
+	// Servers only talk when asked or when the clipboard changes, so reads
+	// wait without a deadline
+	conn.SetReadDeadline(time.Time{})
+	go c.readLoop()
+	return c, nil
+}
+
+// Name returns the desktop name announced by the server
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Size returns the current size of the desktop
+func (c *Client) Size() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fb.Rect.Dx(), c.fb.Rect.Dy()
+}
+
+// Done is closed when the connection has ended
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close ends the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Capture requests the whole framebuffer and returns a copy of it once the
+// update has arrived
+func (c *Client) Capture(timeout time.Duration) (*image.RGBA, error) {
+	wait := c.nextUpdate()
+	width, height := c.Size()
+	if err := c.RequestUpdate(false, 0, 0, width, height); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-wait:
+	case <-c.done:
+		return nil, c.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("rfb: no framebuffer update within %s", timeout)
+	}
+	return c.Framebuffer(), nil
+}
+
+// Framebuffer returns a copy of the mirrored framebuffer
+func (c *Client) Framebuffer() *image.RGBA {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	img := image.NewRGBA(c.fb.Rect)
+	copy(img.Pix, c.fb.Pix)
+	return img
+}
+
+// Updates returns the number of framebuffer updates applied so far. An
+// unchanged count means the framebuffer is unchanged.
+func (c *Client) Updates() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updates
+}
+
+// RequestUpdate asks the server for the given area. Incremental requests
+// are only answered once something changed.
+func (c *Client) RequestUpdate(incremental bool, x, y, width, height int) error {
+	msg := make([]byte, 10)
+	msg[0] = msgFramebufferUpdateRequest
+	msg[1] = boolByte(incremental)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(x))
+	binary.BigEndian.PutUint16(msg[4:6], uint16(y))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(width))
+	binary.BigEndian.PutUint16(msg[8:10], uint16(height))
+	return c.send(msg)
+}
+
+// KeyEvent presses or releases the key of an X keysym
+func (c *Client) KeyEvent(keysym uint32, down bool) error {
+	msg := make([]byte, 8)
+	msg[0] = msgKeyEvent
+	msg[1] = boolByte(down)
+	binary.BigEndian.PutUint32(msg[4:8], keysym)
+	return c.send(msg)
+}
+
+// Pointer buttons of PointerEvent masks. The wheel is reported as clicks
+// of buttons 4 to 7.
+const (
+	ButtonLeft       = 1 << 0
+	ButtonMiddle     = 1 << 1
+	ButtonRight      = 1 << 2
+	ButtonWheelUp    = 1 << 3
+	ButtonWheelDown  = 1 << 4
+	ButtonWheelLeft  = 1 << 5
+	ButtonWheelRight = 1 << 6
+)
+
+// PointerEvent moves the pointer to x, y with the buttons of the mask held
+func (c *Client) PointerEvent(buttons uint8, x, y int) error {
+	msg := make([]byte, 6)
+	msg[0] = msgPointerEvent
+	msg[1] = buttons
+	binary.BigEndian.PutUint16(msg[2:4], uint16(x))
+	binary.BigEndian.PutUint16(msg[4:6], uint16(y))
+	return c.send(msg)
+}
+
+// nextUpdate returns a channel closed when the next framebuffer update is complete
+func (c *Client) nextUpdate() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wait := make(chan struct{})
+	c.waiters = append(c.waiters, wait)
+	return wait
+}
+
+// send writes one or more complete messages
+func (c *Client) send(msg []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// readLoop handles server messages until the connection fails
+func (c *Client) readLoop() {
+	err := c.readMessages()
+	c.conn.Close()
+	c.mu.Lock()
+	if err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+		err = ErrClosed
+	}
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) readMessages() error {
+	head := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(c.conn, head); err != nil {
+			return err
+		}
+		var err error
+		switch head[0] {
+		case msgFramebufferUpdate:
+			err = c.readFramebufferUpdate()
+		case msgSetColourMapEntries:
+			buf := make([]byte, 5)
+			if _, err = io.ReadFull(c.conn, buf); err == nil {
+				_, err = io.CopyN(io.Discard, c.conn, 6*int64(binary.BigEndian.Uint16(buf[3:5])))
+			}
+		case msgBell:
+		case msgServerCutText:
+			err = c.readCutText()
+		default:
+			err = fmt.Errorf("rfb: unsupported server message type %d", head[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readFramebufferUpdate applies the rectangles of an update to the mirror
+func (c *Client) readFramebufferUpdate() error {
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return err
+	}
+	count := int(binary.BigEndian.Uint16(buf[1:3]))
+
+	rect := make([]byte, 12)
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(c.conn, rect); err != nil {
+			return err
+		}
+		x := int(binary.BigEndian.Uint16(rect[0:2]))
+		y := int(binary.BigEndian.Uint16(rect[2:4]))
+		w := int(binary.BigEndian.Uint16(rect[4:6]))
+		h := int(binary.BigEndian.Uint16(rect[6:8]))
+		encoding := int32(binary.BigEndian.Uint32(rect[8:12]))
+
+		var err error
+		switch encoding {
+		case encodingRaw:
+			err = c.readRaw(x, y, w, h)
+		case encodingCopyRect:
+			err = c.readCopyRect(x, y, w, h)
+		case encodingDesktopSize:
+			err = c.resize(w, h)
+		default:
+			err = fmt.Errorf("rfb: unsupported encoding %d", encoding)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.updates++
+	waiters := c.waiters
+	c.waiters = nil
+	c.mu.Unlock()
+	for _, wait := range waiters {
+		close(wait)
+	}
+	return nil
+}
+
+// readRaw copies raw pixels into the mirror, row by row
+func (c *Client) readRaw(x, y, w, h int) error {
+	row := make([]byte, 4*w)
+	for j := 0; j < h; j++ {
+		if _, err := io.ReadFull(c.conn, row); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		if bounds := c.fb.Rect; y+j < bounds.Max.Y && x < bounds.Max.X {
+			offset := c.fb.PixOffset(x, y+j)
+			n := copy(c.fb.Pix[offset:offset+4*min(w, bounds.Max.X-x)], row)
+			// The fourth byte is padding, make the pixels opaque
+			for i := offset + 3; i < offset+n; i += 4 {
+				c.fb.Pix[i] = 0xff
+			}
+		}
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// readCopyRect copies an area of the mirror to another place
+func (c *Client) readCopyRect(x, y, w, h int) error {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return err
+	}
+	srcX := int(binary.BigEndian.Uint16(buf[0:2]))
+	srcY := int(binary.BigEndian.Uint16(buf[2:4]))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	src := image.Rect(srcX, srcY, srcX+w, srcY+h).Intersect(c.fb.Rect)
+	dst := image.Rect(x, y, x+w, y+h).Intersect(c.fb.Rect)
+	w, h = min(src.Dx(), dst.Dx()), min(src.Dy(), dst.Dy())
+	tmp := make([]byte, 4*w*h)
+	for j := 0; j < h; j++ {
+		offset := c.fb.PixOffset(srcX, srcY+j)
+		copy(tmp[4*w*j:4*w*(j+1)], c.fb.Pix[offset:offset+4*w])
+	}
+	for j := 0; j < h; j++ {
+		offset := c.fb.PixOffset(x, y+j)
+		copy(c.fb.Pix[offset:offset+4*w], tmp[4*w*j:4*w*(j+1)])
+	}
+	return nil
+}
+
+// resize follows a change of the desktop size, keeping the overlapping area
+func (c *Client) resize(w, h int) error {
+	if w == 0 || h == 0 || w > maxFramebuffer || h > maxFramebuffer {
+		return fmt.Errorf("rfb: unsupported desktop size %dx%d", w, h)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fb := image.NewRGBA(image.Rect(0, 0, w, h))
+	overlap := fb.Rect.Intersect(c.fb.Rect)
+	for j := 0; j < overlap.Dy(); j++ {
+		copy(fb.Pix[fb.PixOffset(0, j):fb.PixOffset(overlap.Dx(), j)], c.fb.Pix[c.fb.PixOffset(0, j):c.fb.PixOffset(overlap.Dx(), j)])
+	}
+	c.fb = fb
+	return nil
+}
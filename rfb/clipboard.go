@@ -0,0 +1,280 @@
+package rfb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// encodingExtendedClipboard announces the extended clipboard protocol,
+// which carries UTF-8 text and lets clients ask for the clipboard
+const encodingExtendedClipboard = -1063131698 // 0xc0a1e5ce
+
+// Flags of extended clipboard messages. The low bits are formats, the high
+// bits the action.
+const (
+	clipboardText    = 1 << 0
+	clipboardCaps    = 1 << 24
+	clipboardRequest = 1 << 25
+	clipboardPeek    = 1 << 26
+	clipboardNotify  = 1 << 27
+	clipboardProvide = 1 << 28
+)
+
+// capsWait bounds how long a new connection waits for the server to
+// announce the extended clipboard before using the plain one
+const capsWait = time.Second
+
+// Clipboard returns the text clipboard of the desktop. Servers speaking the
+// extended clipboard protocol are asked for it; when one does not answer
+// within timeout, which some do for an empty clipboard, or speaks only the
+// plain protocol, the last text it announced on this connection is returned.
+func (c *Client) Clipboard(timeout time.Duration) (string, error) {
+	c.awaitCaps()
+	c.mu.Lock()
+	if c.ownsClipboard {
+		text := c.clientText
+		c.mu.Unlock()
+		return text, nil
+	}
+	if !c.extClipboard {
+		text := c.serverText
+		c.mu.Unlock()
+		return text, nil
+	}
+	wait := make(chan struct{})
+	c.clipWaiters = append(c.clipWaiters, wait)
+	c.mu.Unlock()
+
+	if err := c.send(extendedCutText(clipboardRequest|clipboardText, nil)); err != nil {
+		return "", err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-wait:
+	case <-c.done:
+		return "", c.Err()
+	case <-timer.C:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ownsClipboard {
+		return c.clientText, nil
+	}
+	return c.serverText, nil
+}
+
+// SetClipboard makes text the clipboard of the desktop. The server pastes
+// it from this connection, so the text is lost when the connection closes
+// before something else on the desktop is copied. Servers without the
+// extended clipboard get Latin-1 text, other characters become '?'.
+func (c *Client) SetClipboard(text string) error {
+	c.awaitCaps()
+	c.mu.Lock()
+	c.clientText = text
+	c.ownsClipboard = true
+	ext := c.extClipboard
+	c.mu.Unlock()
+
+	if ext {
+		// The server asks for the text when it is pasted
+		return c.send(extendedCutText(clipboardNotify|clipboardText, nil))
+	}
+	latin1 := stringToLatin1(text)
+	msg := make([]byte, 8, 8+len(latin1))
+	msg[0] = msgClientCutText
+	binary.BigEndian.PutUint32(msg[4:8], uint32(len(latin1)))
+	return c.send(append(msg, latin1...))
+}
+
+// OwnsClipboard reports whether the clipboard of the desktop was set through
+// this connection and nothing has been copied on the desktop since
+func (c *Client) OwnsClipboard() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ownsClipboard
+}
+
+// awaitCaps gives a new connection time to learn whether the server speaks
+// the extended clipboard protocol
+func (c *Client) awaitCaps() {
+	wait := capsWait - time.Since(c.connected)
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-c.caps:
+	case <-c.done:
+	case <-timer.C:
+	}
+}
+
+// readCutText reads a clipboard message of the server. Plain messages carry
+// Latin-1 text, extended ones are marked by a negative length.
+func (c *Client) readCutText() error {
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return err
+	}
+	length := int64(int32(binary.BigEndian.Uint32(buf[3:7])))
+	extended := length < 0
+	if extended {
+		length = -length
+	}
+	if length > maxCutText {
+		return fmt.Errorf("rfb: clipboard message of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return err
+	}
+	if extended {
+		return c.handleExtendedCutText(payload)
+	}
+	c.setServerText(latin1ToString(payload))
+	return nil
+}
+
+// handleExtendedCutText answers an extended clipboard message
+func (c *Client) handleExtendedCutText(payload []byte) error {
+	if len(payload) < 4 {
+		return fmt.Errorf("rfb: extended clipboard message of %d bytes is too short", len(payload))
+	}
+	flags := binary.BigEndian.Uint32(payload[0:4])
+	switch {
+	case flags&clipboardCaps != 0:
+		c.mu.Lock()
+		first := !c.extClipboard
+		c.extClipboard = true
+		c.mu.Unlock()
+		if first {
+			close(c.caps)
+		}
+		caps := binary.BigEndian.AppendUint32(nil, maxCutText)
+		return c.send(extendedCutText(clipboardCaps|clipboardRequest|clipboardPeek|clipboardNotify|clipboardProvide|clipboardText, caps))
+
+	case flags&clipboardRequest != 0:
+		c.mu.Lock()
+		owns, text := c.ownsClipboard, c.clientText
+		c.mu.Unlock()
+		if !owns || flags&clipboardText == 0 {
+			return nil
+		}
+		data, err := compressClipboardText(text)
+		if err != nil {
+			return err
+		}
+		return c.send(extendedCutText(clipboardProvide|clipboardText, data))
+
+	case flags&clipboardPeek != 0:
+		var formats uint32
+		if c.OwnsClipboard() {
+			formats = clipboardText
+		}
+		return c.send(extendedCutText(clipboardNotify|formats, nil))
+
+	case flags&clipboardNotify != 0:
+		// Something on the desktop was copied
+		c.mu.Lock()
+		c.ownsClipboard = false
+		c.mu.Unlock()
+
+	case flags&clipboardProvide != 0:
+		text := ""
+		if flags&clipboardText != 0 {
+			var err error
+			if text, err = decompressClipboardText(payload[4:]); err != nil {
+				return err
+			}
+		}
+		c.setServerText(text)
+	}
+	return nil
+}
+
+// setServerText records a clipboard sent by the server and wakes the
+// callers waiting for it
+func (c *Client) setServerText(text string) {
+	c.mu.Lock()
+	c.serverText = text
+	c.ownsClipboard = false
+	waiters := c.clipWaiters
+	c.clipWaiters = nil
+	c.mu.Unlock()
+	for _, wait := range waiters {
+		close(wait)
+	}
+}
+
+// extendedCutText frames an extended clipboard message
+func extendedCutText(flags uint32, data []byte) []byte {
+	msg := make([]byte, 8, 12+len(data))
+	msg[0] = msgClientCutText
+	binary.BigEndian.PutUint32(msg[4:8], uint32(-int32(4+len(data))))
+	msg = binary.BigEndian.AppendUint32(msg, flags)
+	return append(msg, data...)
+}
+
+// compressClipboardText encodes text the way extended clipboard messages
+// carry it: null terminated UTF-8 with CRLF line endings, prefixed by its
+// length and zlib compressed
+func compressClipboardText(text string) ([]byte, error) {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n") + "\x00"
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	binary.Write(zw, binary.BigEndian, uint32(len(text)))
+	io.WriteString(zw, text)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressClipboardText decodes the text of an extended clipboard message
+func decompressClipboardText(data []byte) (string, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("rfb: invalid clipboard data: %w", err)
+	}
+	defer zr.Close()
+	var length uint32
+	if err := binary.Read(zr, binary.BigEndian, &length); err != nil {
+		return "", fmt.Errorf("rfb: invalid clipboard data: %w", err)
+	}
+	if length > maxCutText {
+		return "", fmt.Errorf("rfb: clipboard text of %d bytes is too large", length)
+	}
+	text := make([]byte, length)
+	if _, err := io.ReadFull(zr, text); err != nil {
+		return "", fmt.Errorf("rfb: invalid clipboard data: %w", err)
+	}
+	return strings.ReplaceAll(strings.TrimRight(string(text), "\x00"), "\r\n", "\n"), nil
+}
+
+// latin1ToString decodes ISO 8859-1 text, the encoding of RFB clipboards
+func latin1ToString(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// stringToLatin1 encodes text as ISO 8859-1, replacing what it cannot hold
+func stringToLatin1(text string) []byte {
+	b := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xff {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return b
+}
@@ -0,0 +1,285 @@
+// Package rfb implements the parts of the VNC remote framebuffer protocol
+// (RFC 6143) the orchestrator needs to stand between viewers and the VNC
+// servers of its containers.
+package rfb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Security types
+const (
+	securityInvalid = 0
+	securityNone    = 1
+	securityVNCAuth = 2
+)
+
+// ErrAuthFailed is returned when the server rejects the VNC password
+var ErrAuthFailed = errors.New("rfb: authentication failed")
+
+// PixelFormat describes how pixels are encoded in framebuffer updates
+type PixelFormat struct {
+	BitsPerPixel uint8
+	Depth        uint8
+	BigEndian    bool
+	TrueColor    bool
+	RedMax       uint16
+	GreenMax     uint16
+	BlueMax      uint16
+	RedShift     uint8
+	GreenShift   uint8
+	BlueShift    uint8
+}
+
+// ServerInit describes the desktop announced by a server after the handshake
+type ServerInit struct {
+	Width       uint16
+	Height      uint16
+	PixelFormat PixelFormat
+	Name        string
+}
+
+// ClientHandshake authenticates to a VNC server as a shared client and
+// returns the server initialisation. Servers offering no authentication are
+// accepted, otherwise VNC authentication is done with password.
+func ClientHandshake(conn io.ReadWriter, password string) (*ServerInit, error) {
+	minor, err := readVersion(conn)
+	if err != nil {
+		return nil, err
+	}
+	// Answer with the highest version both sides support
+	switch {
+	case minor >= 8:
+		minor = 8
+	case minor == 7:
+	default:
+		minor = 3
+	}
+	if _, err := fmt.Fprintf(conn, "RFB 003.%03d\n", minor); err != nil {
+		return nil, err
+	}
+
+	security, err := negotiateSecurity(conn, minor)
+	if err != nil {
+		return nil, err
+	}
+	if security == securityVNCAuth {
+		challenge := make([]byte, 16)
+		if _, err := io.ReadFull(conn, challenge); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(vncAuthResponse(password, challenge)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Protocol 3.8 reports the result for every security type, older
+	// versions only after VNC authentication
+	if minor >= 8 || security == securityVNCAuth {
+		var result uint32
+		if err := binary.Read(conn, binary.BigEndian, &result); err != nil {
+			return nil, err
+		}
+		if result != 0 {
+			if minor >= 8 {
+				if reason, err := readString(conn); err == nil && reason != "" {
+					return nil, fmt.Errorf("%w: %s", ErrAuthFailed, reason)
+				}
+			}
+			return nil, ErrAuthFailed
+		}
+	}
+
+	// ClientInit: share the desktop with the other viewers
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return nil, err
+	}
+	return readServerInit(conn)
+}
+
+// negotiateSecurity picks the security type, preferring none over VNC authentication
+func negotiateSecurity(conn io.ReadWriter, minor int) (uint8, error) {
+	if minor == 3 {
+		// The server decides on its own in protocol 3.3
+		var security uint32
+		if err := binary.Read(conn, binary.BigEndian, &security); err != nil {
+			return 0, err
+		}
+		switch security {
+		case securityInvalid:
+			reason, _ := readString(conn)
+			return 0, fmt.Errorf("rfb: server refused the connection: %s", reason)
+		case securityNone, securityVNCAuth:
+			return uint8(security), nil
+		}
+		return 0, fmt.Errorf("rfb: unsupported security type %d", security)
+	}
+
+	var count uint8
+	if err := binary.Read(conn, binary.BigEndian, &count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		reason, _ := readString(conn)
+		return 0, fmt.Errorf("rfb: server refused the connection: %s", reason)
+	}
+	types := make([]byte, count)
+	if _, err := io.ReadFull(conn, types); err != nil {
+		return 0, err
+	}
+
+	var chosen uint8
+	for _, t := range types {
+		if t == securityNone {
+			chosen = securityNone
+			break
+		}
+		if t == securityVNCAuth {
+			chosen = securityVNCAuth
+		}
+	}
+	if chosen == securityInvalid {
+		return 0, fmt.Errorf("rfb: no supported security type among %v", types)
+	}
+	if _, err := conn.Write([]byte{chosen}); err != nil {
+		return 0, err
+	}
+	return chosen, nil
+}
+
+// ServerHandshake answers a viewer as a server that needs no authentication
+// and announces init as its desktop. Viewers are authenticated before they
+// reach the handshake, by the access token of their connection.
+func ServerHandshake(conn io.ReadWriter, init *ServerInit) error {
+	if _, err := io.WriteString(conn, "RFB 003.008\n"); err != nil {
+		return err
+	}
+	minor, err := readVersion(conn)
+	if err != nil {
+		return err
+	}
+
+	if minor < 7 {
+		if err := binary.Write(conn, binary.BigEndian, uint32(securityNone)); err != nil {
+			return err
+		}
+	} else {
+		if _, err := conn.Write([]byte{1, securityNone}); err != nil {
+			return err
+		}
+		chosen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, chosen); err != nil {
+			return err
+		}
+		if chosen[0] != securityNone {
+			return fmt.Errorf("rfb: viewer chose unsupported security type %d", chosen[0])
+		}
+		if minor >= 8 {
+			if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ClientInit, the shared flag does not matter as the upstream connection is always shared
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		return err
+	}
+	_, err = conn.Write(init.marshal())
+	return err
+}
+
+// readVersion reads a ProtocolVersion message and returns its minor version
+func readVersion(r io.Reader) (int, error) {
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(buf), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return 0, fmt.Errorf("rfb: unsupported protocol version %q", buf)
+	}
+	return minor, nil
+}
+
+// readString reads a length-prefixed string
+func readString(r io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > 1<<20 {
+		return "", fmt.Errorf("rfb: string of %d bytes is too long", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readServerInit(r io.Reader) (*ServerInit, error) {
+	head := make([]byte, 20)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	name, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerInit{
+		Width:       binary.BigEndian.Uint16(head[0:2]),
+		Height:      binary.BigEndian.Uint16(head[2:4]),
+		PixelFormat: unmarshalPixelFormat(head[4:20]),
+		Name:        name,
+	}, nil
+}
+
+func (s *ServerInit) marshal() []byte {
+	buf := make([]byte, 24, 24+len(s.Name))
+	binary.BigEndian.PutUint16(buf[0:2], s.Width)
+	binary.BigEndian.PutUint16(buf[2:4], s.Height)
+	s.PixelFormat.marshalTo(buf[4:20])
+	binary.BigEndian.PutUint32(buf[20:24], uint32(len(s.Name)))
+	return append(buf, s.Name...)
+}
+
+func unmarshalPixelFormat(b []byte) PixelFormat {
+	return PixelFormat{
+		BitsPerPixel: b[0],
+		Depth:        b[1],
+		BigEndian:    b[2] != 0,
+		TrueColor:    b[3] != 0,
+		RedMax:       binary.BigEndian.Uint16(b[4:6]),
+		GreenMax:     binary.BigEndian.Uint16(b[6:8]),
+		BlueMax:      binary.BigEndian.Uint16(b[8:10]),
+		RedShift:     b[10],
+		GreenShift:   b[11],
+		BlueShift:    b[12],
+	}
+}
+
+// marshalTo writes the 16 byte wire form of the pixel format
+func (p PixelFormat) marshalTo(b []byte) {
+	b[0] = p.BitsPerPixel
+	b[1] = p.Depth
+	b[2] = boolByte(p.BigEndian)
+	b[3] = boolByte(p.TrueColor)
+	binary.BigEndian.PutUint16(b[4:6], p.RedMax)
+	binary.BigEndian.PutUint16(b[6:8], p.GreenMax)
+	binary.BigEndian.PutUint16(b[8:10], p.BlueMax)
+	b[10] = p.RedShift
+	b[11] = p.GreenShift
+	b[12] = p.BlueShift
+	b[13], b[14], b[15] = 0, 0, 0
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package rfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Client to server message types
+const (
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+	msgKeyEvent                 = 4
+	msgPointerEvent             = 5
+	msgClientCutText            = 6
+	msgEnableContinuousUpdates  = 150
+	msgFence                    = 248
+	msgXvp                      = 250
+	msgSetDesktopSize           = 251
+	msgQEMU                     = 255
+)
+
+// maxCutText bounds the clipboard payload accepted from a viewer
+const maxCutText = 10 << 20
+
+// FilterInput copies client messages from a viewer to a server, dropping
+// the ones that would change the desktop: key and pointer events, clipboard
+// updates, resizes and power actions. Messages this package cannot frame end
+// the copy with an error rather than being passed on unchecked.
+func FilterInput(dst io.Writer, src io.Reader) error {
+	for {
+		msg, err := readClientMessage(src)
+		if err != nil {
+			return err
+		}
+		if isInput(msg[0]) {
+			continue
+		}
+		if _, err := dst.Write(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func isInput(msgType byte) bool {
+	switch msgType {
+	case msgKeyEvent, msgPointerEvent, msgClientCutText, msgXvp, msgSetDesktopSize, msgQEMU:
+		return true
+	}
+	return false
+}
+
+// readClientMessage reads one complete client message
+func readClientMessage(r io.Reader) ([]byte, error) {
+	msg := make([]byte, 1, 20)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	read := func(n int) error {
+		start := len(msg)
+		msg = append(msg, make([]byte, n)...)
+		_, err := io.ReadFull(r, msg[start:])
+		return err
+	}
+
+	var err error
+	switch msg[0] {
+	case msgSetPixelFormat:
+		err = read(19)
+	case msgSetEncodings:
+		if err = read(3); err == nil {
+			err = read(4 * int(binary.BigEndian.Uint16(msg[2:4])))
+		}
+	case msgFramebufferUpdateRequest, msgEnableContinuousUpdates:
+		err = read(9)
+	case msgKeyEvent:
+		err = read(7)
+	case msgPointerEvent:
+		err = read(5)
+	case msgClientCutText:
+		if err = read(7); err == nil {
+			// A negative length announces the extended clipboard format
+			length := int32(binary.BigEndian.Uint32(msg[4:8]))
+			if length < 0 {
+				length = -length
+			}
+			if length > maxCutText {
+				return nil, fmt.Errorf("rfb: clipboard message of %d bytes is too large", length)
+			}
+			err = read(int(length))
+		}
+	case msgFence:
+		if err = read(8); err == nil {
+			err = read(int(msg[8]))
+		}
+	case msgXvp:
+		err = read(3)
+	case msgSetDesktopSize:
+		if err = read(7); err == nil {
+			err = read(16 * int(msg[6]))
+		}
+	case msgQEMU:
+		if err = read(1); err == nil {
+			if msg[1] != 0 {
+				return nil, fmt.Errorf("rfb: unsupported QEMU client message subtype %d", msg[1])
+			}
+			// Extended key event
+			err = read(10)
+		}
+	default:
+		return nil, fmt.Errorf("rfb: unsupported client message type %d", msg[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
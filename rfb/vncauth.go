@@ -0,0 +1,24 @@
+package rfb
+
+import (
+	"crypto/des"
+	"math/bits"
+)
+
+// vncAuthResponse encrypts the server challenge with the password as a DES
+// key. VNC uses at most 8 password bytes, each with its bits reversed.
+func vncAuthResponse(password string, challenge []byte) []byte {
+	key := make([]byte, 8)
+	copy(key, password)
+	for i := range key {
+		key[i] = bits.Reverse8(key[i])
+	}
+
+	// The key is always 8 bytes long, so NewCipher cannot fail
+	block, _ := des.NewCipher(key)
+	response := make([]byte, len(challenge))
+	for i := 0; i+8 <= len(challenge); i += 8 {
+		block.Encrypt(response[i:i+8], challenge[i:i+8])
+	}
+	return response
+}
@@ -0,0 +1,170 @@
+// Package tlsutil builds TLS configurations from certificate files and
+// reloads them when the files are rotated.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shanurrahman/orchestrator/config"
+)
+
+// reloadInterval is how often certificate files are checked for changes
+const reloadInterval = 30 * time.Second
+
+// ServerConfig returns the TLS configuration of the API server. The
+// certificate, and the client CA bundle when set, are reloaded when their
+// files change, so rotating them does not need a restart.
+func ServerConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := watchKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert.get(), nil },
+	}
+	if cfg.ClientCAFile == "" {
+		return base, nil
+	}
+
+	pool, err := watchCAPool(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	// Without a required certificate, clients may still authenticate
+	// with the other methods
+	base.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.ClientCAs = pool.get()
+			return c, nil
+		},
+	}, nil
+}
+
+// ClientConfig returns the TLS configuration of outbound connections. The
+// client certificate, if any, is reloaded when its files change.
+func ClientConfig(cfg config.ClientTLSConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		// Outbound connections are short-lived, the bundle is read once
+		pool, err := loadCAPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := watchKeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return cert.get(), nil }
+	}
+	return c, nil
+}
+
+// watched holds a value loaded from files and reloads it when they change.
+// A failed reload keeps the previous value.
+type watched[T any] struct {
+	files []string
+	load  func() (T, error)
+
+	mu    sync.RWMutex
+	value T
+	stamp string
+}
+
+func watch[T any](load func() (T, error), files ...string) (*watched[T], error) {
+	w := &watched[T]{files: files, load: load}
+	w.stamp = w.fileStamp()
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	w.value = value
+	go func() {
+		for range time.Tick(reloadInterval) {
+			w.reload()
+		}
+	}()
+	return w, nil
+}
+
+func (w *watched[T]) get() T {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.value
+}
+
+func (w *watched[T]) reload() {
+	stamp := w.fileStamp()
+	if stamp == w.stamp {
+		return
+	}
+	value, err := w.load()
+	if err != nil {
+		// A certificate and its key are rarely replaced at the same
+		// instant, the next check will see both
+		log.Printf("Error reloading %s: %v", strings.Join(w.files, ", "), err)
+		return
+	}
+	w.mu.Lock()
+	w.value, w.stamp = value, stamp
+	w.mu.Unlock()
+	log.Printf("Reloaded %s", strings.Join(w.files, ", "))
+}
+
+// fileStamp summarizes the modification times and sizes of the files
+func (w *watched[T]) fileStamp() string {
+	var b strings.Builder
+	for _, file := range w.files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%d/%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			b.WriteString("-;")
+		}
+	}
+	return b.String()
+}
+
+func watchKeyPair(certFile, keyFile string) (*watched[*tls.Certificate], error) {
+	return watch(func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		return &cert, nil
+	}, certFile, keyFile)
+}
+
+func watchCAPool(file string) (*watched[*x509.CertPool], error) {
+	return watch(func() (*x509.CertPool, error) { return loadCAPool(file) }, file)
+}
+
+func loadCAPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", file)
+	}
+	return pool, nil
+}
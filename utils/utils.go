@@ -4,7 +4,12 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/shanurrahman/orchestrator/models"
 )
 
 // GenerateID generates a random unique identifier for containers
@@ -21,12 +26,46 @@ func JSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// ErrorResponse sends an error response with the given status code and message
-func ErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	JSONResponse(w, statusCode, map[string]string{"error": message})
+// ErrorResponse sends an error response with a stable code, a message and
+// the ID of the request
+func ErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, code string, message string) {
+	ErrorResponseWithDetails(w, r, statusCode, code, message, nil)
+}
+
+// ErrorResponseWithDetails sends an error response carrying additional context
+func ErrorResponseWithDetails(w http.ResponseWriter, r *http.Request, statusCode int, code string, message string, details map[string]interface{}) {
+	JSONResponse(w, statusCode, models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
+
+// RequestIDHeader echoes the request ID assigned by middleware.RequestID in
+// the X-Request-Id response header
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-// ValidateRequestBody validates that the request body can be decoded into the given struct
+// ValidateRequestBody decodes the request body into the given struct. Unknown
+// fields and content after the JSON value are rejected.
 func ValidateRequestBody(r *http.Request, v interface{}) error {
-	return json.NewDecoder(r.Body).Decode(v)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if err == io.EOF {
+			return errors.New("request body is empty")
+		}
+		return err
+	}
+	if dec.More() {
+		return errors.New("request body must hold a single JSON object")
+	}
+	return nil
 }
\ No newline at end of file